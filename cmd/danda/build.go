@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/stdiopt/danda/drow"
+	"github.com/stdiopt/danda/etl"
+	"github.com/stdiopt/danda/etl/etlcsv"
+	"github.com/stdiopt/danda/etl/etldrow"
+	"github.com/stdiopt/danda/etl/etlfs"
+	"github.com/stdiopt/danda/etl/etlhttp"
+	"github.com/stdiopt/danda/etl/etljson"
+	"github.com/stdiopt/danda/etl/etlsql"
+	"github.com/stdiopt/danda/etl/etlsql/mysql"
+	"github.com/stdiopt/danda/etl/etlsql/psql"
+	"github.com/stdiopt/danda/etl/etlsql/sqlite"
+	"github.com/stdiopt/danda/etl/x/etlcloud"
+	"github.com/stdiopt/danda/etl/x/etlgzip"
+	"github.com/stdiopt/danda/etl/x/etlparquet"
+	"github.com/stdiopt/danda/util/conv"
+
+	// blob drivers, others can be added here.
+	_ "gocloud.dev/blob/fileblob"
+	_ "gocloud.dev/blob/memblob"
+)
+
+var dialects = map[string]etlsql.Dialect{
+	"psql":   psql.Dialect,
+	"mysql":  mysql.Dialect,
+	"sqlite": sqlite.Dialect,
+}
+
+var defaultDrivers = map[string]string{
+	"psql":   "postgres",
+	"mysql":  "mysql",
+	"sqlite": "sqlite3",
+}
+
+var ddlSyncs = map[string]etlsql.DDLSync{
+	"":            etlsql.DDLNone,
+	"none":        etlsql.DDLNone,
+	"create":      etlsql.DDLCreate,
+	"add_columns": etlsql.DDLAddColumns,
+	"evolve":      etlsql.DDLEvolve,
+}
+
+// filterOps maps the filter ops to the result of comparing the field with
+// the value, contains is handled separately.
+var filterOps = map[string]func(c int) bool{
+	"=":        func(c int) bool { return c == 0 },
+	"!=":       func(c int) bool { return c != 0 },
+	"<":        func(c int) bool { return c < 0 },
+	"<=":       func(c int) bool { return c <= 0 },
+	">":        func(c int) bool { return c > 0 },
+	">=":       func(c int) bool { return c >= 0 },
+	"contains": nil,
+}
+
+// pipeline builds an etl.Pipeline with the spec source, decode and
+// transforms stages and the sink fn.
+func (s *Spec) pipeline(sinkName string, sink func(context.Context, etl.Iter) error) *etl.Pipeline {
+	p := etl.NewPipeline()
+	p.Source("source", s.source())
+
+	last := "source"
+	stage := func(name string, fn func(etl.Iter) etl.Iter) {
+		p.Stage(name, func(in ...etl.Iter) etl.Iter { return fn(in[0]) }, last)
+		last = name
+	}
+	for _, c := range s.Decode {
+		stage("decode."+c.Type, decoder(c))
+	}
+	for i, t := range s.Transforms {
+		stage(fmt.Sprintf("transforms[%d].%s", i, t.name()), transform(t))
+	}
+	p.Sink(sinkName, sink, last)
+	return p
+}
+
+func (s *Spec) source() etl.Iter {
+	src := s.Source
+	switch src.Type {
+	case "file":
+		return etlfs.ReadFile(src.Path)
+	case "http":
+		h := http.Header{}
+		for k, v := range src.Headers {
+			h.Set(k, v)
+		}
+		return etlhttp.Get(src.URL, etlhttp.WithGetHeader(h))
+	case "blob":
+		return etlcloud.BlobGetObject(src.URL)
+	}
+	return etl.ErrIter(fmt.Errorf("unknown source %q", src.Type))
+}
+
+func decoder(c CodecSpec) func(etl.Iter) etl.Iter {
+	switch c.Type {
+	case "gzip":
+		return func(it etl.Iter) etl.Iter { return etlgzip.Gunzip(it) }
+	case "csv":
+		var opts []etlcsv.DecodeOptFunc
+		if c.Comma != "" {
+			opts = append(opts, etlcsv.WithDecodeComma([]rune(c.Comma)[0]))
+		}
+		if c.Header != nil {
+			opts = append(opts, etlcsv.WithDecodeHeader(*c.Header))
+		}
+		return func(it etl.Iter) etl.Iter { return etlcsv.Decode(it, opts...) }
+	case "json":
+		return func(it etl.Iter) etl.Iter { return etljson.Decode[drow.Row](it) }
+	case "parquet":
+		return func(it etl.Iter) etl.Iter { return etlparquet.Decode[drow.Row](it) }
+	}
+	return func(etl.Iter) etl.Iter {
+		return etl.ErrIter(fmt.Errorf("unknown codec %q", c.Type))
+	}
+}
+
+func encoder(c CodecSpec) func(etl.Iter) etl.Iter {
+	switch c.Type {
+	case "gzip":
+		return func(it etl.Iter) etl.Iter { return etlgzip.Gzip(it) }
+	case "csv":
+		return etlcsv.Encode
+	case "json":
+		// json lines
+		return func(it etl.Iter) etl.Iter {
+			return etl.Map(etljson.Encode(it), func(data []byte) []byte {
+				return append(data, '\n')
+			})
+		}
+	case "parquet":
+		return func(it etl.Iter) etl.Iter { return etlparquet.Encode(it) }
+	}
+	return func(etl.Iter) etl.Iter {
+		return etl.ErrIter(fmt.Errorf("unknown codec %q", c.Type))
+	}
+}
+
+func transform(t TransformSpec) func(etl.Iter) etl.Iter {
+	switch {
+	case t.Select != nil:
+		names := make([]etldrow.IntOrString, len(t.Select))
+		for i, n := range t.Select {
+			names[i] = n
+		}
+		return func(it etl.Iter) etl.Iter { return etldrow.Select(it, names...) }
+	case t.Rename != nil:
+		olds := make([]string, 0, len(t.Rename))
+		for o := range t.Rename {
+			olds = append(olds, o)
+		}
+		sort.Strings(olds)
+		return func(it etl.Iter) etl.Iter {
+			for _, o := range olds {
+				it = etldrow.Rename(it, o, t.Rename[o])
+			}
+			return it
+		}
+	case t.Filter != nil && t.Filter.Expr != "":
+		return func(it etl.Iter) etl.Iter { return etldrow.FilterExpr(it, t.Filter.Expr) }
+	case t.Filter != nil:
+		f := *t.Filter
+		return func(it etl.Iter) etl.Iter {
+			return etldrow.Filter(it, func(r drow.Row) bool {
+				return f.match(r.At(f.Field).Value)
+			})
+		}
+	case t.Compute != nil:
+		return func(it etl.Iter) etl.Iter { return etldrow.Compute(it, t.Compute...) }
+	}
+	return func(it etl.Iter) etl.Iter { return it }
+}
+
+// match compares v with the filter value, numbers are compared as numbers
+// when both sides can be parsed, anything else as strings.
+func (f FilterSpec) match(v any) bool {
+	if v == nil || f.Value == nil {
+		switch f.Op {
+		case "=":
+			return v == nil && f.Value == nil
+		case "!=":
+			return (v == nil) != (f.Value == nil)
+		}
+		return false
+	}
+	a, b := conv.ToString(v), conv.ToString(f.Value)
+	if f.Op == "contains" {
+		return strings.Contains(a, b)
+	}
+	c := strings.Compare(a, b)
+	if fa, err := strconv.ParseFloat(a, 64); err == nil {
+		if fb, err := strconv.ParseFloat(b, 64); err == nil {
+			switch {
+			case fa < fb:
+				c = -1
+			case fa > fb:
+				c = 1
+			default:
+				c = 0
+			}
+		}
+	}
+	return filterOps[f.Op](c)
+}
+
+// sink returns the func that writes the rows to the spec sink.
+func (s *Spec) sink() func(context.Context, etl.Iter) error {
+	sk := s.Sink
+	switch sk.Type {
+	case "sql":
+		return func(_ context.Context, it etl.Iter) error {
+			driver := sk.Driver
+			if driver == "" {
+				driver = defaultDrivers[sk.Dialect]
+			}
+			db := etlsql.Open(dialects[sk.Dialect], driver, sk.DSN)
+			if c, ok := db.Q().(io.Closer); ok {
+				defer c.Close()
+			}
+			batchSize := sk.BatchSize
+			if batchSize <= 0 {
+				batchSize = 1000
+			}
+			return db.Insert(it, sk.Schema, sk.Table,
+				etlsql.WithBatchSize(batchSize),
+				etlsql.WithDDLSync(ddlSyncs[sk.DDL]),
+				etlsql.WithNullables(sk.Nullables...),
+				etlsql.WithUpsert(sk.Upsert...),
+			)
+		}
+	case "file":
+		return func(_ context.Context, it etl.Iter) error {
+			return etlfs.WriteFile(s.encode(it), sk.Path)
+		}
+	case "stdout":
+		return func(ctx context.Context, it etl.Iter) error {
+			return etl.ConsumeContext(ctx, s.encode(it), func(data []byte) error {
+				_, err := os.Stdout.Write(data)
+				return err
+			})
+		}
+	}
+	return func(context.Context, etl.Iter) error {
+		return fmt.Errorf("unknown sink %q", sk.Type)
+	}
+}
+
+func (s *Spec) encode(it etl.Iter) etl.Iter {
+	codecs := s.Sink.Encode
+	if len(codecs) == 0 {
+		codecs = []CodecSpec{{Type: "json"}}
+	}
+	for _, c := range codecs {
+		it = encoder(c)(it)
+	}
+	return it
+}
+
+// describe returns a short description of the sink.
+func (s SinkSpec) describe() string {
+	switch s.Type {
+	case "sql":
+		table := s.Table
+		if s.Schema != "" {
+			table = s.Schema + "." + table
+		}
+		return fmt.Sprintf("sql %s %s", s.Dialect, table)
+	case "file":
+		return "file " + s.Path
+	}
+	return s.Type
+}
@@ -0,0 +1,152 @@
+// Command danda runs pipelines described in a json or yaml spec.
+//
+// Usage:
+//
+//	danda run [-dry-run] [-limit n] spec.yaml
+//	danda schema [-sample n] spec.yaml
+//
+// run reads the source, decodes it into rows, applies the transforms and
+// writes the rows to the sink, with -dry-run the first rows are printed
+// instead of being written. schema prints the columns inferred from a sample
+// of the rows.
+//
+// A spec looks like:
+//
+//	source:
+//	  type: file               # file, http or blob
+//	  path: users.csv.gz
+//	decode: [gzip, csv]        # gzip followed by csv, json or parquet
+//	transforms:
+//	  - filter: {field: age, op: ">=", value: 18}
+//	  - filter: 'country in ("PT", "ES") && name is not null'
+//	  - compute: ["total = round(price * qty, 2)"]
+//	  - select: [id, name, age, total]
+//	  - rename: {name: full_name}
+//	sink:
+//	  type: sql                # sql, file or stdout
+//	  dialect: psql
+//	  dsn: postgres://localhost/db?sslmode=disable
+//	  table: users
+//	  ddl: create              # none, create, add_columns or evolve
+//
+// The sql sink links the lib/pq, go-sql-driver/mysql and go-sqlite3
+// drivers, sqlite requires building with cgo. Blob drivers other than
+// file:// and mem:// are added with a blank import.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/stdiopt/danda/drow"
+	"github.com/stdiopt/danda/etl"
+	"github.com/stdiopt/danda/etl/etlsql"
+)
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "danda:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprint(os.Stderr, `usage:
+	danda run [-dry-run] [-limit n] <spec>
+	danda schema [-sample n] <spec>
+`)
+}
+
+func run(args []string) error {
+	if len(args) == 0 {
+		usage()
+		return errors.New("missing command")
+	}
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	cmd, args := args[0], args[1:]
+	switch cmd {
+	case "run":
+		return runCmd(ctx, args)
+	case "schema":
+		return schemaCmd(ctx, args)
+	case "help", "-h", "-help", "--help":
+		usage()
+		return nil
+	}
+	usage()
+	return fmt.Errorf("unknown command %q", cmd)
+}
+
+func runCmd(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "print the rows instead of writing them to the sink")
+	limit := fs.Int("limit", 10, "number of rows read on dry-run, 0 reads all")
+	spec, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if !*dryRun {
+		return spec.pipeline("sink", spec.sink()).Run(ctx)
+	}
+
+	n := 0
+	err = spec.pipeline("dry-run", func(ctx context.Context, it etl.Iter) error {
+		if *limit > 0 {
+			it = etl.Limit(it, *limit)
+		}
+		return etl.ConsumeContext(ctx, it, func(row drow.Row) error {
+			n++
+			fmt.Println(row)
+			return nil
+		})
+	}).Run(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "dry-run: %d rows read, %s not written\n", n, spec.Sink.describe())
+	return nil
+}
+
+func schemaCmd(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("schema", flag.ContinueOnError)
+	sample := fs.Int("sample", 1000, "number of rows used to infer the schema, 0 reads all")
+	spec, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	var def etlsql.TableDef
+	err = spec.pipeline("schema", func(ctx context.Context, it etl.Iter) error {
+		if *sample > 0 {
+			it = etl.Limit(it, *sample)
+		}
+		rows, err := etl.CollectContext[drow.Row](ctx, it)
+		if err != nil {
+			return err
+		}
+		def, err = etlsql.DefFromRows(rows)
+		return err
+	}).Run(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Print(def)
+	return nil
+}
+
+// parseArgs parses the flags and loads the spec from the single argument.
+func parseArgs(fs *flag.FlagSet, args []string) (*Spec, error) {
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return nil, errors.New("expected a single spec file")
+	}
+	return loadSpec(fs.Arg(0))
+}
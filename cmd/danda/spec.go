@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/stdiopt/danda/drow/expr"
+	"gopkg.in/yaml.v3"
+)
+
+// Spec describes a pipeline that reads a source, decodes it into rows,
+// applies transforms in order and writes the rows to a sink.
+type Spec struct {
+	Source     SourceSpec      `json:"source"`
+	Decode     []CodecSpec     `json:"decode"`
+	Transforms []TransformSpec `json:"transforms"`
+	Sink       SinkSpec        `json:"sink"`
+}
+
+// SourceSpec is where the data is read from.
+type SourceSpec struct {
+	// Type is one of file, http or blob.
+	Type string `json:"type"`
+	// Path of the file source.
+	Path string `json:"path"`
+	// URL of the http source or the blob object, as in
+	// s3://bucket/key?region=eu-west-1.
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+}
+
+// CodecSpec is a codec name or an object with the codec options.
+type CodecSpec struct {
+	// Type is one of gzip, csv, json or parquet.
+	Type string `json:"type"`
+	// Comma is the csv delimiter.
+	Comma string `json:"comma"`
+	// Header tells if the first csv record is the header, defaults to true.
+	Header *bool `json:"header"`
+}
+
+func (c *CodecSpec) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*c = CodecSpec{Type: name}
+		return nil
+	}
+	type codecSpec CodecSpec
+	var v codecSpec
+	if err := strictUnmarshal(data, &v); err != nil {
+		return err
+	}
+	*c = CodecSpec(v)
+	return nil
+}
+
+// TransformSpec must have exactly one of its fields set.
+type TransformSpec struct {
+	// Select keeps only the named fields.
+	Select []string `json:"select"`
+	// Rename renames fields from the key to the value.
+	Rename map[string]string `json:"rename"`
+	// Filter keeps the rows that match the condition.
+	Filter *FilterSpec `json:"filter"`
+	// Compute sets fields with assignment expressions, as in
+	// "total = price * qty".
+	Compute []string `json:"compute"`
+}
+
+func (t TransformSpec) name() string {
+	switch {
+	case t.Select != nil:
+		return "select"
+	case t.Rename != nil:
+		return "rename"
+	case t.Filter != nil:
+		return "filter"
+	case t.Compute != nil:
+		return "compute"
+	}
+	return ""
+}
+
+// FilterSpec is an expression string, see package drow/expr, or an object
+// that compares a field with a value, Op is one of =, !=, <, <=, >, >= or
+// contains.
+type FilterSpec struct {
+	Expr  string `json:"expr"`
+	Field string `json:"field"`
+	Op    string `json:"op"`
+	Value any    `json:"value"`
+}
+
+func (f *FilterSpec) UnmarshalJSON(data []byte) error {
+	var src string
+	if err := json.Unmarshal(data, &src); err == nil {
+		*f = FilterSpec{Expr: src}
+		return nil
+	}
+	type filterSpec FilterSpec
+	var v filterSpec
+	if err := strictUnmarshal(data, &v); err != nil {
+		return err
+	}
+	*f = FilterSpec(v)
+	return nil
+}
+
+// SinkSpec is where the rows are written to.
+type SinkSpec struct {
+	// Type is one of sql, file or stdout.
+	Type string `json:"type"`
+
+	// Path of the file sink.
+	Path string `json:"path"`
+	// Encode are the codecs for file and stdout sinks, a row codec
+	// optionally followed by gzip, defaults to json.
+	Encode []CodecSpec `json:"encode"`
+
+	// Dialect is psql, mysql or sqlite, Driver is the database/sql driver
+	// name which defaults to postgres, mysql or sqlite3.
+	Dialect string `json:"dialect"`
+	Driver  string `json:"driver"`
+	DSN     string `json:"dsn"`
+	Schema  string `json:"schema"`
+	Table   string `json:"table"`
+	// BatchSize is the number of rows per insert, defaults to 1000.
+	BatchSize int `json:"batch_size"`
+	// DDL is none, create, add_columns or evolve.
+	DDL       string   `json:"ddl"`
+	Nullables []string `json:"nullables"`
+	// Upsert are the key columns to update existing rows instead of
+	// inserting duplicates.
+	Upsert []string `json:"upsert"`
+}
+
+// loadSpec reads a json or yaml spec from file, '-' reads from stdin.
+func loadSpec(file string) (*Spec, error) {
+	var data []byte
+	var err error
+	if file == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(file)
+	}
+	if err != nil {
+		return nil, err
+	}
+	spec, err := parseSpec(data, filepath.Ext(file) == ".json")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return spec, nil
+}
+
+// parseSpec parses data as json or yaml, yaml is converted to json so both
+// are validated the same way.
+func parseSpec(data []byte, isJSON bool) (*Spec, error) {
+	if !isJSON && !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		var v any
+		if err := yaml.Unmarshal(data, &v); err != nil {
+			return nil, err
+		}
+		var err error
+		if data, err = json.Marshal(v); err != nil {
+			return nil, fmt.Errorf("yaml: %w", err)
+		}
+	}
+	spec := &Spec{}
+	if err := strictUnmarshal(data, spec); err != nil {
+		return nil, err
+	}
+	if err := spec.validate(); err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+func strictUnmarshal(data []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+func (s *Spec) validate() error {
+	var errs []error
+	add := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+	switch s.Source.Type {
+	case "file":
+		if s.Source.Path == "" {
+			add("source: file requires path")
+		}
+	case "http", "blob":
+		if s.Source.URL == "" {
+			add("source: %s requires url", s.Source.Type)
+		}
+	default:
+		add("source: unknown type %q", s.Source.Type)
+	}
+
+	if err := validateCodecs(s.Decode, true); err != nil {
+		add("decode: %w", err)
+	}
+
+	for i, t := range s.Transforms {
+		n := 0
+		for _, set := range []bool{t.Select != nil, t.Rename != nil, t.Filter != nil, t.Compute != nil} {
+			if set {
+				n++
+			}
+		}
+		if n != 1 {
+			add("transforms[%d]: expected one of select, rename, filter or compute", i)
+			continue
+		}
+		switch {
+		case t.Filter != nil && t.Filter.Expr != "":
+			if t.Filter.Field != "" || t.Filter.Op != "" || t.Filter.Value != nil {
+				add("transforms[%d]: filter expr can't be used with field, op and value", i)
+			}
+			if _, err := expr.CompileFilter(t.Filter.Expr); err != nil {
+				add("transforms[%d]: filter: %w", i, err)
+			}
+		case t.Filter != nil:
+			if t.Filter.Field == "" {
+				add("transforms[%d]: filter requires field", i)
+			}
+			if _, ok := filterOps[t.Filter.Op]; !ok {
+				add("transforms[%d]: unknown filter op %q", i, t.Filter.Op)
+			}
+		case t.Compute != nil:
+			for _, src := range t.Compute {
+				e, err := expr.Compile(src)
+				if err == nil && e.Name() == "" {
+					err = fmt.Errorf("%q is not an assignment", src)
+				}
+				if err != nil {
+					add("transforms[%d]: compute: %w", i, err)
+				}
+			}
+		}
+	}
+
+	switch s.Sink.Type {
+	case "sql":
+		if _, ok := dialects[s.Sink.Dialect]; !ok {
+			add("sink: unknown dialect %q", s.Sink.Dialect)
+		}
+		if s.Sink.DSN == "" || s.Sink.Table == "" {
+			add("sink: sql requires dsn and table")
+		}
+		if _, ok := ddlSyncs[s.Sink.DDL]; !ok {
+			add("sink: unknown ddl %q", s.Sink.DDL)
+		}
+	case "file", "stdout":
+		if s.Sink.Type == "file" && s.Sink.Path == "" {
+			add("sink: file requires path")
+		}
+		if err := validateCodecs(s.Sink.Encode, false); err != nil {
+			add("sink: encode: %w", err)
+		}
+	default:
+		add("sink: unknown type %q", s.Sink.Type)
+	}
+	return errors.Join(errs...)
+}
+
+// validateCodecs checks the order of the codecs, bytes codecs are applied
+// before the row codec when decoding and after it when encoding.
+func validateCodecs(cs []CodecSpec, decode bool) error {
+	if len(cs) == 0 {
+		if decode {
+			return errors.New("requires a csv, json or parquet codec")
+		}
+		return nil
+	}
+	names := make([]string, len(cs))
+	for i, c := range cs {
+		names[i] = c.Type
+	}
+	rowCodecs := 0
+	for i, c := range cs {
+		switch c.Type {
+		case "gzip":
+		case "csv", "json", "parquet":
+			rowCodecs++
+			if decode && i != len(cs)-1 {
+				return fmt.Errorf("%s must be the last codec in [%s]", c.Type, strings.Join(names, ", "))
+			}
+			if !decode && i != 0 {
+				return fmt.Errorf("%s must be the first codec in [%s]", c.Type, strings.Join(names, ", "))
+			}
+		default:
+			return fmt.Errorf("unknown codec %q", c.Type)
+		}
+		if c.Type != "csv" && (c.Comma != "" || c.Header != nil) {
+			return fmt.Errorf("%s: comma and header are csv options", c.Type)
+		}
+		if utf8.RuneCountInString(c.Comma) > 1 {
+			return fmt.Errorf("%s: comma must be a single character", c.Type)
+		}
+		if !decode && c.Type == "csv" && (c.Comma != "" || c.Header != nil) {
+			return errors.New("csv: comma and header are decode options")
+		}
+	}
+	if rowCodecs != 1 {
+		return errors.New("requires a single csv, json or parquet codec")
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSpec(t *testing.T) {
+	type test struct {
+		data    string
+		isJSON  bool
+		want    *Spec
+		wantErr bool
+	}
+	run := func(name string, tt test) {
+		t.Helper()
+		t.Run(name, func(t *testing.T) {
+			got, err := parseSpec([]byte(tt.data), tt.isJSON)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("wrong error\nwant: %v\n got: %v", tt.wantErr, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("wrong result\nwant: %#v\n got: %#v", tt.want, got)
+			}
+		})
+	}
+
+	run("yaml", test{
+		data: `
+source: {type: file, path: users.csv}
+decode: [csv]
+transforms:
+  - filter: {field: age, op: ">=", value: 18}
+  - filter: |
+      country in ("PT", "ES")
+        && name is not null
+  - select: &cols [id, name]
+  - select: *cols
+sink:
+  type: stdout
+`,
+		want: &Spec{
+			Source: SourceSpec{Type: "file", Path: "users.csv"},
+			Decode: []CodecSpec{{Type: "csv"}},
+			Transforms: []TransformSpec{
+				{Filter: &FilterSpec{Field: "age", Op: ">=", Value: float64(18)}},
+				{Filter: &FilterSpec{Expr: "country in (\"PT\", \"ES\")\n  && name is not null\n"}},
+				{Select: []string{"id", "name"}},
+				{Select: []string{"id", "name"}},
+			},
+			Sink: SinkSpec{Type: "stdout"},
+		},
+	})
+	run("json", test{
+		data:   `{"source": {"type": "file", "path": "a.json"}, "decode": ["json"], "sink": {"type": "stdout"}}`,
+		isJSON: true,
+		want: &Spec{
+			Source: SourceSpec{Type: "file", Path: "a.json"},
+			Decode: []CodecSpec{{Type: "json"}},
+			Sink:   SinkSpec{Type: "stdout"},
+		},
+	})
+	run("duplicated key", test{
+		data:    "source: {type: file, path: a}\nsource: {type: file, path: b}\n",
+		wantErr: true,
+	})
+	run("unknown field", test{
+		data:    "source: {type: file, path: a, nope: 1}\ndecode: [csv]\nsink: {type: stdout}\n",
+		wantErr: true,
+	})
+	run("filter assignment", test{
+		data:    "source: {type: file, path: a}\ndecode: [csv]\ntransforms: [filter: 'country = \"PT\"']\nsink: {type: stdout}\n",
+		wantErr: true,
+	})
+}
@@ -0,0 +1,158 @@
+package expr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/stdiopt/danda/drow"
+)
+
+// Node is a node of the expression syntax tree.
+type Node interface {
+	String() string
+	node()
+}
+
+type (
+	// Literal is a constant value, one of int64, float64, string, bool or
+	// nil.
+	Literal struct {
+		Value any
+	}
+
+	// Field is a field path, each element is a field name or an int index
+	// of a nested row or slice.
+	Field struct {
+		Path []drow.IntOrString
+	}
+
+	// Unary is Op X where Op is '-', '!' or 'not'.
+	Unary struct {
+		Op string
+		X  Node
+	}
+
+	// Binary is X Op Y where Op is one of || && == != < <= > >= + - * / %,
+	// 'and' and 'or' are parsed as && and ||.
+	Binary struct {
+		Op   string
+		X, Y Node
+	}
+
+	// In is X in (List...) or X not in (List...).
+	In struct {
+		X    Node
+		List []Node
+		Not  bool
+	}
+
+	// IsNull is X is null or X is not null.
+	IsNull struct {
+		X   Node
+		Not bool
+	}
+
+	// Call is a function call, Name is lower case.
+	Call struct {
+		Name string
+		Args []Node
+	}
+
+	// Assign is Name = X, it is only valid at the root of an expression.
+	Assign struct {
+		Name string
+		X    Node
+	}
+)
+
+func (Literal) node() {}
+func (Field) node()   {}
+func (Unary) node()   {}
+func (Binary) node()  {}
+func (In) node()      {}
+func (IsNull) node()  {}
+func (Call) node()    {}
+func (Assign) node()  {}
+
+func (n Literal) String() string {
+	switch v := n.Value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return strconv.Quote(v)
+	case float64:
+		s := strconv.FormatFloat(v, 'g', -1, 64)
+		if !strings.ContainsAny(s, ".eE") {
+			s += ".0"
+		}
+		return s
+	}
+	return fmt.Sprint(n.Value)
+}
+
+func (n Field) String() string {
+	sb := &strings.Builder{}
+	for i, p := range n.Path {
+		switch p := p.(type) {
+		case int:
+			fmt.Fprintf(sb, "[%d]", p)
+		default:
+			if i > 0 {
+				sb.WriteByte('.')
+			}
+			sb.WriteString(quoteName(fmt.Sprint(p)))
+		}
+	}
+	return sb.String()
+}
+
+func (n Unary) String() string {
+	if n.Op == "not" {
+		return "not " + n.X.String()
+	}
+	return n.Op + n.X.String()
+}
+
+func (n Binary) String() string {
+	return "(" + n.X.String() + " " + n.Op + " " + n.Y.String() + ")"
+}
+
+func (n In) String() string {
+	op := " in ("
+	if n.Not {
+		op = " not in ("
+	}
+	return n.X.String() + op + joinNodes(n.List) + ")"
+}
+
+func (n IsNull) String() string {
+	if n.Not {
+		return n.X.String() + " is not null"
+	}
+	return n.X.String() + " is null"
+}
+
+func (n Call) String() string {
+	return n.Name + "(" + joinNodes(n.Args) + ")"
+}
+
+func (n Assign) String() string {
+	return quoteName(n.Name) + " = " + n.X.String()
+}
+
+func joinNodes(ns []Node) string {
+	s := make([]string, len(ns))
+	for i, n := range ns {
+		s[i] = n.String()
+	}
+	return strings.Join(s, ", ")
+}
+
+// quoteName quotes names that aren't valid identifiers with backticks.
+func quoteName(s string) string {
+	if isIdent(s) && !isKeyword(s) {
+		return s
+	}
+	return "`" + s + "`"
+}
@@ -0,0 +1,449 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/apd"
+	"github.com/stdiopt/danda/drow"
+	"github.com/stdiopt/danda/util/conv"
+)
+
+type evalFn func(r drow.Row) (any, error)
+
+func compile(n Node) (evalFn, error) {
+	switch n := n.(type) {
+	case Literal:
+		v := n.Value
+		return func(drow.Row) (any, error) { return v, nil }, nil
+	case Field:
+		return compileField(n), nil
+	case Unary:
+		return compileUnary(n)
+	case Binary:
+		return compileBinary(n)
+	case In:
+		return compileIn(n)
+	case IsNull:
+		x, err := compile(n.X)
+		if err != nil {
+			return nil, err
+		}
+		return func(r drow.Row) (any, error) {
+			v, err := x(r)
+			if err != nil {
+				return nil, err
+			}
+			return (v == nil) != n.Not, nil
+		}, nil
+	case Call:
+		return compileCall(n)
+	case Assign:
+		return compile(n.X)
+	}
+	return nil, fmt.Errorf("expr: unknown node %T", n)
+}
+
+func compileField(n Field) evalFn {
+	path := n.Path
+	return func(r drow.Row) (any, error) {
+		var v any = r
+		for _, p := range path {
+			v = lookup(v, p)
+			if v == nil {
+				return nil, nil
+			}
+		}
+		return normalize(v), nil
+	}
+}
+
+// lookup returns the field or index p of v, nil if it doesn't exist.
+func lookup(v any, p drow.IntOrString) any {
+	switch v := v.(type) {
+	case drow.Row:
+		return v.Value(p)
+	case *drow.Row:
+		if v == nil {
+			return nil
+		}
+		return v.Value(p)
+	case map[string]any:
+		if k, ok := p.(string); ok {
+			return v[k]
+		}
+		return nil
+	}
+	i, ok := p.(int)
+	if !ok {
+		return nil
+	}
+	val := reflect.Indirect(reflect.ValueOf(v))
+	switch val.Kind() {
+	case reflect.Slice, reflect.Array:
+		if i < 0 || i >= val.Len() {
+			return nil
+		}
+		return val.Index(i).Interface()
+	}
+	return nil
+}
+
+func compileUnary(n Unary) (evalFn, error) {
+	x, err := compile(n.X)
+	if err != nil {
+		return nil, err
+	}
+	return func(r drow.Row) (any, error) {
+		v, err := x(r)
+		if err != nil || v == nil {
+			return nil, err
+		}
+		switch n.Op {
+		case "-":
+			switch v := toNumber(v).(type) {
+			case int64:
+				return -v, nil
+			case float64:
+				return -v, nil
+			}
+			return nil, fmt.Errorf("expr: cannot negate %T", v)
+		default: // ! and not
+			b, ok := v.(bool)
+			if !ok {
+				return nil, fmt.Errorf("expr: %s: expected bool, got %T", n.Op, v)
+			}
+			return !b, nil
+		}
+	}, nil
+}
+
+func compileBinary(n Binary) (evalFn, error) {
+	x, err := compile(n.X)
+	if err != nil {
+		return nil, err
+	}
+	y, err := compile(n.Y)
+	if err != nil {
+		return nil, err
+	}
+	switch n.Op {
+	case "&&", "||":
+		and := n.Op == "&&"
+		return func(r drow.Row) (any, error) {
+			a, err := evalBool(x, r, n.Op)
+			if err != nil {
+				return nil, err
+			}
+			// short circuit
+			if a == !and {
+				return a, nil
+			}
+			return evalBool(y, r, n.Op)
+		}, nil
+	case "==", "!=":
+		eq := n.Op == "=="
+		return func(r drow.Row) (any, error) {
+			a, b, err := eval2(x, y, r)
+			if err != nil {
+				return nil, err
+			}
+			return equal(a, b) == eq, nil
+		}, nil
+	case "<", "<=", ">", ">=":
+		return func(r drow.Row) (any, error) {
+			a, b, err := eval2(x, y, r)
+			if err != nil || a == nil || b == nil {
+				return nil, err
+			}
+			c, err := compare(a, b)
+			if err != nil {
+				return nil, err
+			}
+			switch n.Op {
+			case "<":
+				return c < 0, nil
+			case "<=":
+				return c <= 0, nil
+			case ">":
+				return c > 0, nil
+			}
+			return c >= 0, nil
+		}, nil
+	}
+	return func(r drow.Row) (any, error) {
+		a, b, err := eval2(x, y, r)
+		if err != nil || a == nil || b == nil {
+			return nil, err
+		}
+		return arith(n.Op, a, b)
+	}, nil
+}
+
+func compileIn(n In) (evalFn, error) {
+	x, err := compile(n.X)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]evalFn, len(n.List))
+	for i, ln := range n.List {
+		if list[i], err = compile(ln); err != nil {
+			return nil, err
+		}
+	}
+	return func(r drow.Row) (any, error) {
+		v, err := x(r)
+		if err != nil || v == nil {
+			return nil, err
+		}
+		for _, l := range list {
+			lv, err := l(r)
+			if err != nil {
+				return nil, err
+			}
+			if equal(v, lv) {
+				return !n.Not, nil
+			}
+		}
+		return n.Not, nil
+	}, nil
+}
+
+func eval2(x, y evalFn, r drow.Row) (any, any, error) {
+	a, err := x(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	b, err := y(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	return a, b, nil
+}
+
+// evalBool evaluates x as a bool, null is false.
+func evalBool(x evalFn, r drow.Row, op string) (bool, error) {
+	v, err := x(r)
+	if err != nil || v == nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("expr: %s: expected bool, got %T", op, v)
+	}
+	return b, nil
+}
+
+// normalize converts field values to the expression types, integers to
+// int64, floats and decimals to float64 and pointers to their values.
+func normalize(v any) any {
+	v = conv.Deref(v)
+	switch v := v.(type) {
+	case int:
+		return int64(v)
+	case int8:
+		return int64(v)
+	case int16:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case uint:
+		return normalizeUint(uint64(v))
+	case uint8:
+		return int64(v)
+	case uint16:
+		return int64(v)
+	case uint32:
+		return int64(v)
+	case uint64:
+		return normalizeUint(v)
+	case float32:
+		return float64(v)
+	case []byte:
+		return string(v)
+	case apd.Decimal:
+		f, err := v.Float64()
+		if err != nil {
+			return math.NaN()
+		}
+		return f
+	}
+	return v
+}
+
+func normalizeUint(v uint64) any {
+	if v > math.MaxInt64 {
+		return float64(v)
+	}
+	return int64(v)
+}
+
+// toNumber returns v as int64 or float64 if it is a number or a string that
+// holds a number, otherwise v.
+func toNumber(v any) any {
+	s, ok := v.(string)
+	if !ok {
+		return v
+	}
+	s = strings.TrimSpace(s)
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return n
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f
+	}
+	return v
+}
+
+func isNumber(v any) bool {
+	switch v.(type) {
+	case int64, float64:
+		return true
+	}
+	return false
+}
+
+// numbers converts a and b to numbers if both are numbers or one is a
+// number and the other a string that holds a number, two strings are kept
+// as strings so they compare and concatenate lexically.
+func numbers(a, b any) (any, any, bool) {
+	switch {
+	case isNumber(a) && !isNumber(b):
+		b = toNumber(b)
+	case isNumber(b) && !isNumber(a):
+		a = toNumber(a)
+	}
+	return a, b, isNumber(a) && isNumber(b)
+}
+
+func toFloat(v any) float64 {
+	switch v := v.(type) {
+	case int64:
+		return float64(v)
+	case float64:
+		return v
+	}
+	return math.NaN()
+}
+
+func equal(a, b any) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	c, err := compare(a, b)
+	return err == nil && c == 0
+}
+
+// compare returns -1, 0 or 1 comparing a to b.
+func compare(a, b any) (int, error) {
+	if a, b, ok := numbers(a, b); ok {
+		if a, ok := a.(int64); ok {
+			if b, ok := b.(int64); ok {
+				return cmp(a, b), nil
+			}
+		}
+		return cmp(toFloat(a), toFloat(b)), nil
+	}
+	switch a := a.(type) {
+	case string:
+		if b, ok := b.(string); ok {
+			return strings.Compare(a, b), nil
+		}
+	case bool:
+		if b, ok := b.(bool); ok {
+			switch {
+			case a == b:
+				return 0, nil
+			case b:
+				return -1, nil
+			}
+			return 1, nil
+		}
+	case time.Time:
+		switch b := b.(type) {
+		case time.Time:
+			return a.Compare(b), nil
+		case string:
+			t, err := parseTime(b)
+			if err != nil {
+				return 0, err
+			}
+			return a.Compare(t), nil
+		}
+	}
+	if t, ok := b.(time.Time); ok {
+		if _, ok := a.(string); ok {
+			c, err := compare(t, a)
+			return -c, err
+		}
+	}
+	return 0, fmt.Errorf("expr: cannot compare %T and %T", a, b)
+}
+
+func cmp[T int64 | float64](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func parseTime(s string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("expr: invalid time %q", s)
+}
+
+func arith(op string, a, b any) (any, error) {
+	na, nb, ok := numbers(a, b)
+	if !ok && op == "+" {
+		sa, aok := a.(string)
+		sb, bok := b.(string)
+		if aok && bok {
+			return sa + sb, nil
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("expr: invalid operation %T %s %T", a, op, b)
+	}
+	ia, aInt := na.(int64)
+	ib, bInt := nb.(int64)
+	if aInt && bInt && op != "/" {
+		switch op {
+		case "+":
+			return ia + ib, nil
+		case "-":
+			return ia - ib, nil
+		case "*":
+			return ia * ib, nil
+		case "%":
+			if ib == 0 {
+				return nil, fmt.Errorf("expr: integer modulo by zero")
+			}
+			return ia % ib, nil
+		}
+	}
+	fa, fb := toFloat(na), toFloat(nb)
+	switch op {
+	case "+":
+		return fa + fb, nil
+	case "-":
+		return fa - fb, nil
+	case "*":
+		return fa * fb, nil
+	case "/":
+		return fa / fb, nil
+	case "%":
+		return math.Mod(fa, fb), nil
+	}
+	return nil, fmt.Errorf("expr: unknown operator %q", op)
+}
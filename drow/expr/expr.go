@@ -0,0 +1,148 @@
+// Package expr implements a small expression language evaluated against a
+// drow.Row, so filters and computed fields can be expressed in config.
+//
+//	amount * 1.23 > 100 && country in ("PT", "ES")
+//	total = round(price * qty, 2)
+//
+// Operands are number, string ('single' or "double" quoted), true, false
+// and null literals, field names and function calls. Nested fields are
+// accessed with '.' and slices with '[index]', names that aren't
+// identifiers are quoted with backticks, as in `first name`.
+//
+// Operators by precedence, lowest first:
+//
+//	|| or
+//	&& and
+//	not
+//	== != < <= > >=, in (...), not in (...), is null, is not null
+//	+ -
+//	* / %
+//	- !  (unary)
+//
+// Integers are int64 and other numbers float64, '/' always returns a
+// float64. A string that holds a number is converted when the other operand
+// is a number, so csv fields can be compared and added with numeric
+// literals, two strings compare lexically and '+' concatenates them, as
+// zip codes like '0123' do.
+//
+// Null propagates through arithmetic, ordered comparisons and functions,
+// '&&', '||' and Match treat null as false, use 'is null' or coalesce to
+// handle it explicitly. A missing field is null.
+//
+// Functions: lower, upper, trim, len, substr(s, start[, n]), contains,
+// startswith, endswith, replace(s, old, new), concat, coalesce,
+// if(cond, a, b), abs, floor, ceil, round(x[, places]), min, max and the
+// casts int, float, string and bool.
+package expr
+
+import (
+	"fmt"
+
+	"github.com/stdiopt/danda/drow"
+)
+
+// Expr is a compiled expression.
+type Expr struct {
+	src  string
+	root Node
+	eval evalFn
+}
+
+// Compile parses and compiles the expression src.
+func Compile(src string) (*Expr, error) {
+	root, err := Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	eval, err := compile(root)
+	if err != nil {
+		return nil, err
+	}
+	return &Expr{src: src, root: root, eval: eval}, nil
+}
+
+// CompileFilter is like Compile for boolean expressions, assignments are
+// rejected as they are likely meant as comparisons.
+func CompileFilter(src string) (*Expr, error) {
+	e, err := Compile(src)
+	if err != nil {
+		return nil, err
+	}
+	if name := e.Name(); name != "" {
+		return nil, fmt.Errorf("expr: %q is an assignment to %q, use == to compare", src, name)
+	}
+	return e, nil
+}
+
+// CompileNode compiles a syntax tree built by Parse or by hand, as done by
+// parsers of other languages that embed expressions.
+func CompileNode(n Node) (*Expr, error) {
+	eval, err := compile(n)
+	if err != nil {
+		return nil, err
+	}
+	return &Expr{src: n.String(), root: n, eval: eval}, nil
+}
+
+// MustCompile is like Compile but panics on error.
+func MustCompile(src string) *Expr {
+	e, err := Compile(src)
+	if err != nil {
+		panic(err)
+	}
+	return e
+}
+
+// String returns the source of the expression.
+func (e *Expr) String() string { return e.src }
+
+// Node returns the root of the syntax tree.
+func (e *Expr) Node() Node { return e.root }
+
+// Name returns the field name of an assignment expression, or an empty
+// string.
+func (e *Expr) Name() string {
+	if a, ok := e.root.(Assign); ok {
+		return a.Name
+	}
+	return ""
+}
+
+// Eval evaluates the expression against r, for assignments it returns the
+// assigned value.
+func (e *Expr) Eval(r drow.Row) (any, error) {
+	return e.eval(r)
+}
+
+// Match evaluates a boolean expression, null is false.
+func (e *Expr) Match(r drow.Row) (bool, error) {
+	v, err := e.eval(r)
+	if err != nil || v == nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("expr: %q is not boolean: %T", e.src, v)
+	}
+	return b, nil
+}
+
+// Compare returns -1, 0 or 1 comparing the values a and b with the rules of
+// the ordered comparison operators.
+func Compare(a, b any) (int, error) {
+	return compare(normalize(a), normalize(b))
+}
+
+// Assign evaluates an assignment expression and returns a copy of r with
+// the field set to the value.
+func (e *Expr) Assign(r drow.Row) (drow.Row, error) {
+	name := e.Name()
+	if name == "" {
+		return nil, fmt.Errorf("expr: %q is not an assignment", e.src)
+	}
+	v, err := e.eval(r)
+	if err != nil {
+		return nil, err
+	}
+	return r.WithFields(drow.F(name, v)), nil
+}
@@ -0,0 +1,149 @@
+package expr_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stdiopt/danda/drow"
+	"github.com/stdiopt/danda/drow/expr"
+)
+
+func TestEval(t *testing.T) {
+	row := drow.Row{
+		drow.F("amount", 100),
+		drow.F("price", "12.5"),
+		drow.F("country", "PT"),
+		drow.F("name", " Ann "),
+		drow.F("missing", (*int)(nil)),
+		drow.F("user", drow.Row{
+			drow.F("address", drow.Row{drow.F("city", "Lisbon")}),
+			drow.F("tags", []string{"a", "b"}),
+		}),
+		drow.F("first name", "Ann"),
+		drow.F("a", "10"),
+		drow.F("b", "9"),
+		drow.F("zip", "123"),
+	}
+	type test struct {
+		src     string
+		want    any
+		wantErr bool
+	}
+	run := func(name string, tt test) {
+		t.Helper()
+		t.Run(name, func(t *testing.T) {
+			e, err := expr.Compile(tt.src)
+			if err != nil {
+				if !tt.wantErr {
+					t.Fatalf("unexpected compile error: %v", err)
+				}
+				return
+			}
+			got, err := e.Eval(row)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("wrong error\nwant: %v\n got: %v", tt.wantErr, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("wrong result\nwant: %#v\n got: %#v", tt.want, got)
+			}
+		})
+	}
+
+	run("arithmetic precedence", test{src: "1 + 2 * 3 - 4 % 3", want: int64(6)})
+	run("division is float", test{src: "7 / 2", want: 3.5})
+	run("negative", test{src: "-amount + 1", want: int64(-99)})
+	run("float field from string", test{src: "price * 2", want: 25.0})
+	run("request example", test{
+		src:  `amount * 1.23 > 100 && country in ("PT","ES")`,
+		want: true,
+	})
+	run("not in", test{src: "country not in ('ES')", want: true})
+	run("boolean keywords", test{src: "not (amount > 1 and false) or false", want: true})
+	run("string compare with number", test{src: "price >= 12", want: true})
+	run("string concat", test{src: "country + '-' + 'x'", want: "PT-x"})
+	run("numeric string add number", test{src: "a + 9", want: int64(19)})
+	run("number add numeric string", test{src: "9.5 + a", want: 19.5})
+	run("numeric string compare number", test{src: "b < 10", want: true})
+	run("numeric string equal number", test{src: "a == 10.0", want: true})
+	run("numeric string in numbers", test{src: "zip in (123, 5)", want: true})
+	run("numeric strings concat", test{src: "'01' + '9'", want: "019"})
+	run("numeric strings add", test{src: "a + b", want: "109"})
+	run("numeric strings compare", test{src: "a > b", want: false})
+	run("numeric strings equal", test{src: "zip == '0123'", want: false})
+	run("numeric strings in", test{src: "zip in ('0123')", want: false})
+	run("numeric strings subtract", test{src: "a - b", wantErr: true})
+	run("numeric and text concat", test{src: "a + country", want: "10PT"})
+	run("nested path", test{src: "user.address.city == 'Lisbon'", want: true})
+	run("index", test{src: "user.tags[1]", want: "b"})
+	run("quoted name", test{src: "`first name`", want: "Ann"})
+	run("null field", test{src: "missing", want: nil})
+	run("unknown field is null", test{src: "nope is null", want: true})
+	run("null arithmetic", test{src: "missing + 1", want: nil})
+	run("null comparison", test{src: "missing > 1", want: nil})
+	run("null equality", test{src: "missing == null", want: true})
+	run("is not null", test{src: "amount is not null", want: true})
+	run("coalesce", test{src: "coalesce(missing, nope, 3)", want: int64(3)})
+	run("if lazy", test{src: "if(amount > 0, 1, 1 % 0)", want: int64(1)})
+	run("string funcs", test{src: "upper(trim(name))", want: "ANN"})
+	run("substr", test{src: "substr('hello', 1, 3)", want: "ell"})
+	run("contains", test{src: "contains(user.address.city, 'sb')", want: true})
+	run("len", test{src: "len(user.tags)", want: int64(2)})
+	run("round", test{src: "round(2.345, 2)", want: 2.35})
+	run("cast int", test{src: "int(price)", want: int64(12)})
+	run("cast bool", test{src: "bool('true')", want: true})
+	run("cast error", test{src: "int('abc')", wantErr: true})
+	run("max", test{src: "max(1, 5.5, 3)", want: 5.5})
+	run("concat nulls", test{src: "concat('a', missing, 1)", want: "a1"})
+	run("function on null", test{src: "lower(missing)", want: nil})
+	run("assign", test{src: "total = amount * 2", want: int64(200)})
+	run("and non bool", test{src: "1 && true", wantErr: true})
+	run("compare mismatch", test{src: "country > 1", wantErr: true})
+	run("modulo by zero", test{src: "1 % 0", wantErr: true})
+	run("unknown function", test{src: "nope(1)", wantErr: true})
+	run("single equal", test{src: "a = 1 = 2", wantErr: true})
+	run("syntax error", test{src: "1 +", wantErr: true})
+	run("unterminated string", test{src: "'abc", wantErr: true})
+}
+
+func TestExpr(t *testing.T) {
+	row := drow.Row{drow.F("a", 2), drow.F[any]("b", nil)}
+
+	e := expr.MustCompile("a > 1")
+	if ok, err := e.Match(row); !ok || err != nil {
+		t.Errorf("Match: want true, got %v, %v", ok, err)
+	}
+	if ok, err := expr.MustCompile("b > 1").Match(row); ok || err != nil {
+		t.Errorf("Match null: want false, got %v, %v", ok, err)
+	}
+	if _, err := expr.MustCompile("a + 1").Match(row); err == nil {
+		t.Errorf("Match non boolean: want error")
+	}
+
+	a := expr.MustCompile("c = a * 10")
+	if a.Name() != "c" {
+		t.Errorf("Name: want c, got %q", a.Name())
+	}
+	got, err := a.Assign(row)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := drow.Row{drow.F("a", 2), drow.F[any]("b", nil), drow.F("c", int64(20))}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Assign: want %v, got %v", want, got)
+	}
+	if _, err := e.Assign(row); err == nil {
+		t.Errorf("Assign non assignment: want error")
+	}
+	if _, err := expr.CompileFilter(`a = "PT"`); err == nil {
+		t.Errorf("CompileFilter assignment: want error")
+	}
+
+	n, err := expr.Parse(`a.b[0] * -2 > 1 && c not in ("x") || d is not null`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantStr := `((((a.b[0] * -2) > 1) && c not in ("x")) || d is not null)`
+	if n.String() != wantStr {
+		t.Errorf("String:\nwant: %s\n got: %s", wantStr, n.String())
+	}
+}
@@ -0,0 +1,288 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/stdiopt/danda/drow"
+	"github.com/stdiopt/danda/util/conv"
+)
+
+type function struct {
+	min, max int // number of args, max -1 for variadic
+	// nulls tells the function handles nil args, otherwise any nil arg
+	// returns nil.
+	nulls bool
+	fn    func(args []any) (any, error)
+}
+
+// functions available in expressions, if and coalesce are handled in
+// compileCall since their args are evaluated lazily.
+var functions = map[string]function{
+	"lower":      {1, 1, false, strFn(strings.ToLower)},
+	"upper":      {1, 1, false, strFn(strings.ToUpper)},
+	"trim":       {1, 1, false, strFn(strings.TrimSpace)},
+	"len":        {1, 1, false, lenFn},
+	"substr":     {2, 3, false, substrFn},
+	"contains":   {2, 2, false, str2Fn(strings.Contains)},
+	"startswith": {2, 2, false, str2Fn(strings.HasPrefix)},
+	"endswith":   {2, 2, false, str2Fn(strings.HasSuffix)},
+	"replace": {3, 3, false, func(args []any) (any, error) {
+		return strings.ReplaceAll(str(args[0]), str(args[1]), str(args[2])), nil
+	}},
+	"concat": {1, -1, true, func(args []any) (any, error) {
+		sb := &strings.Builder{}
+		for _, a := range args {
+			sb.WriteString(str(a))
+		}
+		return sb.String(), nil
+	}},
+	"abs":   {1, 1, false, mathFn(math.Abs)},
+	"floor": {1, 1, false, mathFn(math.Floor)},
+	"ceil":  {1, 1, false, mathFn(math.Ceil)},
+	"round": {1, 2, false, roundFn},
+	"min":   {1, -1, true, extremeFn(-1)},
+	"max":   {1, -1, true, extremeFn(1)},
+
+	// casts
+	"int":    {1, 1, false, intFn},
+	"float":  {1, 1, false, floatFn},
+	"string": {1, 1, false, func(args []any) (any, error) { return str(args[0]), nil }},
+	"bool":   {1, 1, false, boolFn},
+}
+
+func compileCall(n Call) (evalFn, error) {
+	args := make([]evalFn, len(n.Args))
+	for i, a := range n.Args {
+		var err error
+		if args[i], err = compile(a); err != nil {
+			return nil, err
+		}
+	}
+	switch n.Name {
+	case "if":
+		if len(args) != 3 {
+			return nil, fmt.Errorf("expr: if: expected 3 arguments, got %d", len(args))
+		}
+		return func(r drow.Row) (any, error) {
+			c, err := evalBool(args[0], r, "if")
+			if err != nil {
+				return nil, err
+			}
+			if c {
+				return args[1](r)
+			}
+			return args[2](r)
+		}, nil
+	case "coalesce":
+		if len(args) == 0 {
+			return nil, fmt.Errorf("expr: coalesce: expected arguments")
+		}
+		return func(r drow.Row) (any, error) {
+			for _, a := range args {
+				v, err := a(r)
+				if err != nil || v != nil {
+					return v, err
+				}
+			}
+			return nil, nil
+		}, nil
+	}
+
+	f, ok := functions[n.Name]
+	if !ok {
+		return nil, fmt.Errorf("expr: unknown function %q", n.Name)
+	}
+	if len(args) < f.min || f.max >= 0 && len(args) > f.max {
+		return nil, fmt.Errorf("expr: %s: wrong number of arguments %d", n.Name, len(args))
+	}
+	return func(r drow.Row) (any, error) {
+		vs := make([]any, len(args))
+		for i, a := range args {
+			v, err := a(r)
+			if err != nil {
+				return nil, err
+			}
+			if v == nil && !f.nulls {
+				return nil, nil
+			}
+			vs[i] = v
+		}
+		v, err := f.fn(vs)
+		if err != nil {
+			return nil, fmt.Errorf("expr: %s: %w", n.Name, err)
+		}
+		return v, nil
+	}, nil
+}
+
+func str(v any) string {
+	if f, ok := v.(float64); ok {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return conv.ToString(v)
+}
+
+func strFn(fn func(string) string) func([]any) (any, error) {
+	return func(args []any) (any, error) {
+		return fn(str(args[0])), nil
+	}
+}
+
+func str2Fn(fn func(string, string) bool) func([]any) (any, error) {
+	return func(args []any) (any, error) {
+		return fn(str(args[0]), str(args[1])), nil
+	}
+}
+
+func number(v any) (float64, error) {
+	n := toNumber(v)
+	if !isNumber(n) {
+		return 0, fmt.Errorf("expected number, got %T", v)
+	}
+	return toFloat(n), nil
+}
+
+func mathFn(fn func(float64) float64) func([]any) (any, error) {
+	return func(args []any) (any, error) {
+		if n, ok := toNumber(args[0]).(int64); ok {
+			return int64(fn(float64(n))), nil
+		}
+		f, err := number(args[0])
+		if err != nil {
+			return nil, err
+		}
+		return fn(f), nil
+	}
+}
+
+func roundFn(args []any) (any, error) {
+	f, err := number(args[0])
+	if err != nil {
+		return nil, err
+	}
+	places := int64(0)
+	if len(args) > 1 {
+		p, ok := toNumber(args[1]).(int64)
+		if !ok {
+			return nil, fmt.Errorf("expected int places, got %T", args[1])
+		}
+		places = p
+	}
+	m := math.Pow(10, float64(places))
+	return math.Round(f*m) / m, nil
+}
+
+func extremeFn(sign int) func([]any) (any, error) {
+	return func(args []any) (any, error) {
+		var res any
+		for _, a := range args {
+			if a == nil {
+				continue
+			}
+			if res == nil {
+				res = a
+				continue
+			}
+			c, err := compare(a, res)
+			if err != nil {
+				return nil, err
+			}
+			if c*sign > 0 {
+				res = a
+			}
+		}
+		return res, nil
+	}
+}
+
+func lenFn(args []any) (any, error) {
+	switch v := args[0].(type) {
+	case string:
+		return int64(utf8.RuneCountInString(v)), nil
+	case drow.Row:
+		return int64(len(v)), nil
+	}
+	val := reflect.ValueOf(args[0])
+	switch val.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return int64(val.Len()), nil
+	}
+	return nil, fmt.Errorf("invalid type %T", args[0])
+}
+
+// substrFn returns n runes from the 0 based start.
+func substrFn(args []any) (any, error) {
+	s := []rune(str(args[0]))
+	start, ok := toNumber(args[1]).(int64)
+	if !ok {
+		return nil, fmt.Errorf("expected int start, got %T", args[1])
+	}
+	start = clamp(start, 0, int64(len(s)))
+	end := int64(len(s))
+	if len(args) > 2 {
+		n, ok := toNumber(args[2]).(int64)
+		if !ok {
+			return nil, fmt.Errorf("expected int length, got %T", args[2])
+		}
+		end = clamp(start+n, start, end)
+	}
+	return string(s[start:end]), nil
+}
+
+func clamp(v, lo, hi int64) int64 {
+	switch {
+	case v < lo:
+		return lo
+	case v > hi:
+		return hi
+	}
+	return v
+}
+
+func intFn(args []any) (any, error) {
+	switch v := toNumber(args[0]).(type) {
+	case int64:
+		return v, nil
+	case float64:
+		return int64(v), nil
+	case bool:
+		if v {
+			return int64(1), nil
+		}
+		return int64(0), nil
+	}
+	return nil, fmt.Errorf("cannot convert %q", str(args[0]))
+}
+
+func floatFn(args []any) (any, error) {
+	switch v := toNumber(args[0]).(type) {
+	case int64:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	}
+	return nil, fmt.Errorf("cannot convert %q", str(args[0]))
+}
+
+func boolFn(args []any) (any, error) {
+	switch v := toNumber(args[0]).(type) {
+	case bool:
+		return v, nil
+	case int64:
+		return v != 0, nil
+	case float64:
+		return v != 0, nil
+	case string:
+		b, err := strconv.ParseBool(strings.TrimSpace(v))
+		if err != nil {
+			return nil, fmt.Errorf("cannot convert %q", v)
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("cannot convert %T", args[0])
+}
@@ -0,0 +1,492 @@
+package expr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/stdiopt/danda/drow"
+)
+
+// SyntaxError is returned by Parse when src is not a valid expression.
+type SyntaxError struct {
+	Pos int // byte offset in the source
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("expr: %s at position %d", e.Msg, e.Pos)
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokString
+	tokIdent
+	tokQuotedIdent
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "end of expression"
+	}
+	return strconv.Quote(t.text)
+}
+
+var keywords = map[string]struct{}{
+	"and": {}, "or": {}, "not": {}, "in": {}, "is": {},
+	"null": {}, "true": {}, "false": {},
+}
+
+func isKeyword(s string) bool {
+	_, ok := keywords[strings.ToLower(s)]
+	return ok
+}
+
+func isIdent(s string) bool {
+	for i, r := range s {
+		if !isIdentRune(r, i == 0) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func isIdentRune(r rune, first bool) bool {
+	return r == '_' || unicode.IsLetter(r) || !first && unicode.IsDigit(r)
+}
+
+// operators sorted by length so the longest matches first.
+var operators = []string{
+	"==", "!=", "<=", ">=", "&&", "||",
+	"<", ">", "=", "!", "+", "-", "*", "/", "%", "(", ")", "[", "]", ",", ".",
+}
+
+func lex(src string) ([]token, error) {
+	var toks []token
+	for i := 0; i < len(src); {
+		r, size := utf8.DecodeRuneInString(src[i:])
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+		case r >= '0' && r <= '9':
+			start := i
+			for i < len(src) && (isDigit(src[i]) || src[i] == '.' || src[i] == '_') {
+				i++
+			}
+			if i < len(src) && (src[i] == 'e' || src[i] == 'E') {
+				i++
+				if i < len(src) && (src[i] == '+' || src[i] == '-') {
+					i++
+				}
+				for i < len(src) && isDigit(src[i]) {
+					i++
+				}
+			}
+			toks = append(toks, token{tokNumber, src[start:i], start})
+		case r == '"' || r == '\'':
+			s, n, err := lexString(src[i:])
+			if err != nil {
+				return nil, &SyntaxError{Pos: i, Msg: err.Error()}
+			}
+			toks = append(toks, token{tokString, s, i})
+			i += n
+		case r == '`':
+			end := strings.IndexByte(src[i+1:], '`')
+			if end < 0 {
+				return nil, &SyntaxError{Pos: i, Msg: "unterminated quoted name"}
+			}
+			toks = append(toks, token{tokQuotedIdent, src[i+1 : i+1+end], i})
+			i += end + 2
+		case isIdentRune(r, true):
+			start := i
+			for i < len(src) {
+				r, size := utf8.DecodeRuneInString(src[i:])
+				if !isIdentRune(r, false) {
+					break
+				}
+				i += size
+			}
+			toks = append(toks, token{tokIdent, src[start:i], start})
+		default:
+			op := ""
+			for _, o := range operators {
+				if strings.HasPrefix(src[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, &SyntaxError{Pos: i, Msg: fmt.Sprintf("unexpected character %q", r)}
+			}
+			toks = append(toks, token{tokOp, op, i})
+			i += len(op)
+		}
+	}
+	return append(toks, token{tokEOF, "", len(src)}), nil
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+// lexString reads a quoted string with go escapes, single quoted strings
+// can contain double quotes and vice versa.
+func lexString(s string) (string, int, error) {
+	q := s[0]
+	sb := &strings.Builder{}
+	for i := 1; i < len(s); {
+		if s[i] == q {
+			return sb.String(), i + 1, nil
+		}
+		if s[i] == '\n' {
+			break
+		}
+		r, _, tail, err := strconv.UnquoteChar(s[i:], q)
+		if err != nil {
+			return "", 0, fmt.Errorf("invalid escape in string")
+		}
+		sb.WriteRune(r)
+		i = len(s) - len(tail)
+	}
+	return "", 0, fmt.Errorf("unterminated string")
+}
+
+// Parse parses src into a syntax tree, the root can be an Assign in the
+// form of 'name = expression'.
+func Parse(src string) (Node, error) {
+	toks, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	var n Node
+	if len(toks) > 2 && (toks[0].kind == tokIdent || toks[0].kind == tokQuotedIdent) &&
+		toks[1].kind == tokOp && toks[1].text == "=" {
+		if toks[0].kind == tokIdent && isKeyword(toks[0].text) {
+			return nil, p.errorf(toks[0], "unexpected keyword %s", toks[0])
+		}
+		p.i = 2
+		x, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		n = Assign{Name: toks[0].text, X: x}
+	} else {
+		if n, err = p.expr(); err != nil {
+			return nil, err
+		}
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, p.errorf(t, "unexpected %s", t)
+	}
+	return n, nil
+}
+
+type parser struct {
+	toks []token
+	i    int
+}
+
+func (p *parser) peek() token { return p.toks[p.i] }
+
+func (p *parser) next() token {
+	t := p.toks[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+// is reports if the current token is the op or keyword s.
+func (p *parser) is(s ...string) bool {
+	t := p.peek()
+	for _, s := range s {
+		switch t.kind {
+		case tokOp:
+			if t.text == s {
+				return true
+			}
+		case tokIdent:
+			if strings.EqualFold(t.text, s) && isKeyword(s) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (p *parser) expect(s string) error {
+	if !p.is(s) {
+		t := p.peek()
+		return p.errorf(t, "expected %q, found %s", s, t)
+	}
+	p.next()
+	return nil
+}
+
+func (p *parser) errorf(t token, format string, args ...any) error {
+	return &SyntaxError{Pos: t.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) expr() (Node, error) {
+	return p.or()
+}
+
+func (p *parser) or() (Node, error) {
+	x, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.is("||", "or") {
+		p.next()
+		y, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		x = Binary{Op: "||", X: x, Y: y}
+	}
+	return x, nil
+}
+
+func (p *parser) and() (Node, error) {
+	x, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	for p.is("&&", "and") {
+		p.next()
+		y, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		x = Binary{Op: "&&", X: x, Y: y}
+	}
+	return x, nil
+}
+
+func (p *parser) not() (Node, error) {
+	if p.is("not") {
+		p.next()
+		x, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return Unary{Op: "not", X: x}, nil
+	}
+	return p.comparison()
+}
+
+func (p *parser) comparison() (Node, error) {
+	x, err := p.additive()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case p.is("==", "!=", "<", "<=", ">", ">="):
+		op := p.next().text
+		y, err := p.additive()
+		if err != nil {
+			return nil, err
+		}
+		return Binary{Op: op, X: x, Y: y}, nil
+	case p.is("in", "not"):
+		not := p.is("not")
+		if not {
+			p.next()
+			if !p.is("in") {
+				t := p.peek()
+				return nil, p.errorf(t, "expected \"in\", found %s", t)
+			}
+		}
+		p.next()
+		list, err := p.list()
+		if err != nil {
+			return nil, err
+		}
+		return In{X: x, List: list, Not: not}, nil
+	case p.is("is"):
+		p.next()
+		not := p.is("not")
+		if not {
+			p.next()
+		}
+		if err := p.expect("null"); err != nil {
+			return nil, err
+		}
+		return IsNull{X: x, Not: not}, nil
+	case p.is("="):
+		t := p.peek()
+		return nil, p.errorf(t, "unexpected \"=\", use \"==\" to compare")
+	}
+	return x, nil
+}
+
+// list parses a parenthesized comma separated list of expressions.
+func (p *parser) list() ([]Node, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	list := []Node{}
+	if p.is(")") {
+		p.next()
+		return list, nil
+	}
+	for {
+		n, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, n)
+		if p.is(")") {
+			p.next()
+			return list, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *parser) additive() (Node, error) {
+	x, err := p.multiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for p.is("+", "-") {
+		op := p.next().text
+		y, err := p.multiplicative()
+		if err != nil {
+			return nil, err
+		}
+		x = Binary{Op: op, X: x, Y: y}
+	}
+	return x, nil
+}
+
+func (p *parser) multiplicative() (Node, error) {
+	x, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.is("*", "/", "%") {
+		op := p.next().text
+		y, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		x = Binary{Op: op, X: x, Y: y}
+	}
+	return x, nil
+}
+
+func (p *parser) unary() (Node, error) {
+	if p.is("-", "!") {
+		op := p.next().text
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		// fold negative number literals
+		if lit, ok := x.(Literal); ok && op == "-" {
+			switch v := lit.Value.(type) {
+			case int64:
+				return Literal{-v}, nil
+			case float64:
+				return Literal{-v}, nil
+			}
+		}
+		return Unary{Op: op, X: x}, nil
+	}
+	return p.primary()
+}
+
+func (p *parser) primary() (Node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		s := strings.ReplaceAll(t.text, "_", "")
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return Literal{n}, nil
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, p.errorf(t, "invalid number %s", t)
+		}
+		return Literal{f}, nil
+	case tokString:
+		return Literal{t.text}, nil
+	case tokQuotedIdent:
+		return p.path(t.text)
+	case tokIdent:
+		switch strings.ToLower(t.text) {
+		case "null":
+			return Literal{nil}, nil
+		case "true":
+			return Literal{true}, nil
+		case "false":
+			return Literal{false}, nil
+		}
+		if isKeyword(t.text) {
+			return nil, p.errorf(t, "unexpected keyword %s", t)
+		}
+		if p.is("(") {
+			args, err := p.list()
+			if err != nil {
+				return nil, err
+			}
+			return Call{Name: strings.ToLower(t.text), Args: args}, nil
+		}
+		return p.path(t.text)
+	case tokOp:
+		if t.text == "(" {
+			x, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return x, nil
+		}
+	}
+	return nil, p.errorf(t, "unexpected %s", t)
+}
+
+// path parses the '.name' and '[index]' after a field name.
+func (p *parser) path(name string) (Node, error) {
+	path := []drow.IntOrString{name}
+	for {
+		switch {
+		case p.is("."):
+			p.next()
+			t := p.next()
+			if t.kind != tokIdent && t.kind != tokQuotedIdent {
+				return nil, p.errorf(t, "expected field name, found %s", t)
+			}
+			path = append(path, t.text)
+		case p.is("["):
+			p.next()
+			t := p.next()
+			n, err := strconv.Atoi(t.text)
+			if t.kind != tokNumber || err != nil {
+				return nil, p.errorf(t, "expected index, found %s", t)
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			path = append(path, n)
+		default:
+			return Field{Path: path}, nil
+		}
+	}
+}
@@ -0,0 +1,399 @@
+package drow
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/cockroachdb/apd"
+	"github.com/stdiopt/danda/util/conv"
+)
+
+// Type is the type of a schema field.
+type Type int
+
+const (
+	TypeAny    Type = iota // values are kept as is
+	TypeString             // string
+	TypeInt                // int64
+	TypeFloat              // float64
+	TypeBool               // bool
+	TypeTime               // time.Time
+)
+
+func (t Type) String() string {
+	switch t {
+	case TypeAny:
+		return "any"
+	case TypeString:
+		return "string"
+	case TypeInt:
+		return "int"
+	case TypeFloat:
+		return "float"
+	case TypeBool:
+		return "bool"
+	case TypeTime:
+		return "time"
+	}
+	return "unknown"
+}
+
+// FieldSchema describes a field of a Schema, the constraints are checked
+// on non null values after they are converted to Type.
+type FieldSchema struct {
+	Name     string
+	Type     Type
+	Nullable bool
+	// Default is used when the value is null or missing.
+	Default any
+	// Layout is the time.Parse layout of TypeTime strings, by default
+	// RFC3339, "2006-01-02 15:04:05" and "2006-01-02" are tried.
+	Layout string
+	// Length is the maximum length of strings in runes, 0 for no limit.
+	Length int
+	// Pattern must match string values.
+	Pattern *regexp.Regexp
+	// Min and Max are the inclusive range of the value, nil for no limit.
+	Min, Max any
+	// Enum are the allowed values.
+	Enum []any
+}
+
+// Schema describes the fields of a row.
+type Schema struct {
+	Fields []FieldSchema
+	// Strict reports fields that aren't in the schema as violations,
+	// otherwise they are dropped.
+	Strict bool
+}
+
+// NewSchema returns a schema with the fields.
+func NewSchema(fields ...FieldSchema) Schema {
+	return Schema{Fields: append([]FieldSchema{}, fields...)}
+}
+
+// Field returns the field schema with name.
+func (s Schema) Field(name string) (FieldSchema, bool) {
+	for _, f := range s.Fields {
+		if strings.EqualFold(f.Name, name) {
+			return f, true
+		}
+	}
+	return FieldSchema{}, false
+}
+
+// Violation is a field value that doesn't conform to the schema.
+type Violation struct {
+	Field string
+	Value any
+	Msg   string
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("%s: %s", v.Field, v.Msg)
+}
+
+// ValidationError is returned by Coerce with the violations of a row.
+type ValidationError struct {
+	Row        Row
+	Violations []Violation
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		msgs[i] = v.String()
+	}
+	return "drow: invalid row: " + strings.Join(msgs, "; ")
+}
+
+// Coerce returns a row with the fields of r converted to the schema types
+// in schema order, field names are matched case insensitively. Nulls are
+// nil, typed nil pointers and for types other than string empty strings.
+// If any field doesn't conform a *ValidationError with all the violations
+// is returned.
+func (s Schema) Coerce(r Row) (Row, error) {
+	var violations []Violation
+	res := make(Row, len(s.Fields))
+	for i, fs := range s.Fields {
+		var v any
+		if f := r.At(equalFold(fs.Name)); f.Name != "" {
+			v = f.Value
+		}
+		cv, msg := fs.coerce(v)
+		if msg != "" {
+			violations = append(violations, Violation{Field: fs.Name, Value: v, Msg: msg})
+		}
+		res[i] = Field{Name: fs.Name, Value: cv}
+	}
+	if s.Strict {
+		for _, f := range r {
+			if _, ok := s.Field(f.Name); !ok {
+				violations = append(violations, Violation{Field: f.Name, Value: f.Value, Msg: "not in schema"})
+			}
+		}
+	}
+	if len(violations) > 0 {
+		return nil, &ValidationError{Row: r, Violations: violations}
+	}
+	return res, nil
+}
+
+// Validate returns a *ValidationError if r doesn't conform to the schema.
+func (s Schema) Validate(r Row) error {
+	_, err := s.Coerce(r)
+	return err
+}
+
+// coerce converts v to the field type and checks the constraints, it
+// returns the violation message if any.
+func (fs FieldSchema) coerce(v any) (any, string) {
+	if isNull(v, fs.Type) {
+		if fs.Default == nil {
+			if !fs.Nullable {
+				return nil, "is required"
+			}
+			return nil, ""
+		}
+		v = fs.Default
+	}
+	cv, err := fs.convert(v)
+	if err != nil {
+		return nil, err.Error()
+	}
+	return cv, fs.check(cv)
+}
+
+func (fs FieldSchema) check(v any) string {
+	if fs.Length > 0 {
+		if s, ok := v.(string); ok && utf8.RuneCountInString(s) > fs.Length {
+			return fmt.Sprintf("is longer than %d", fs.Length)
+		}
+	}
+	if fs.Pattern != nil && !fs.Pattern.MatchString(conv.ToString(v)) {
+		return fmt.Sprintf("must match %q", fs.Pattern)
+	}
+	if fs.Min != nil {
+		if c, err := fs.compareTo(v, fs.Min); err != nil || c < 0 {
+			return fmt.Sprintf("must be >= %v", fs.Min)
+		}
+	}
+	if fs.Max != nil {
+		if c, err := fs.compareTo(v, fs.Max); err != nil || c > 0 {
+			return fmt.Sprintf("must be <= %v", fs.Max)
+		}
+	}
+	if len(fs.Enum) > 0 {
+		for _, e := range fs.Enum {
+			if c, err := fs.compareTo(v, e); err == nil && c == 0 {
+				return ""
+			}
+		}
+		return fmt.Sprintf("must be one of %v", fs.Enum)
+	}
+	return ""
+}
+
+// compareTo compares the converted value v with the constraint value b.
+func (fs FieldSchema) compareTo(v, b any) (int, error) {
+	b, err := fs.convert(b)
+	if err != nil {
+		return 0, err
+	}
+	switch v := v.(type) {
+	case string:
+		b, ok := b.(string)
+		if !ok {
+			break
+		}
+		return strings.Compare(v, b), nil
+	case int64:
+		b, ok := b.(int64)
+		if !ok {
+			break
+		}
+		return compare(v, b), nil
+	case float64:
+		b, ok := b.(float64)
+		if !ok {
+			break
+		}
+		return compare(v, b), nil
+	case time.Time:
+		b, ok := b.(time.Time)
+		if !ok {
+			break
+		}
+		return v.Compare(b), nil
+	case bool:
+		b, ok := b.(bool)
+		if !ok {
+			break
+		}
+		if v == b {
+			return 0, nil
+		}
+		return 1, nil
+	}
+	if reflect.DeepEqual(v, b) {
+		return 0, nil
+	}
+	return 0, fmt.Errorf("cannot compare %T with %T", v, b)
+}
+
+func compare[T int64 | float64](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func isNull(v any, typ Type) bool {
+	v = conv.Deref(v)
+	if v == nil {
+		return true
+	}
+	if s, ok := v.(string); ok && typ != TypeString && typ != TypeAny {
+		return strings.TrimSpace(s) == ""
+	}
+	return false
+}
+
+// convert converts a non null value to the field type.
+func (fs FieldSchema) convert(v any) (any, error) {
+	v = conv.Deref(v)
+	if b, ok := v.([]byte); ok {
+		v = string(b)
+	}
+	switch fs.Type {
+	case TypeAny:
+		return v, nil
+	case TypeString:
+		if t, ok := v.(time.Time); ok {
+			return t.Format(time.RFC3339Nano), nil
+		}
+		return conv.ToString(v), nil
+	case TypeInt:
+		return toInt(v)
+	case TypeFloat:
+		return toFloat(v)
+	case TypeBool:
+		return toBool(v)
+	case TypeTime:
+		return fs.toTime(v)
+	}
+	return nil, fmt.Errorf("unknown type %v", fs.Type)
+}
+
+func toInt(v any) (any, error) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if rv.Uint() > math.MaxInt64 {
+			return nil, fmt.Errorf("int out of range: %v", v)
+		}
+		return int64(rv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		// float64(math.MaxInt64) rounds up to 1<<63 which overflows
+		if f != math.Trunc(f) || f >= 1<<63 || f < math.MinInt64 {
+			return nil, fmt.Errorf("invalid int: %v", v)
+		}
+		return int64(f), nil
+	case reflect.String:
+		s := strings.TrimSpace(rv.String())
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid int: %q", s)
+		}
+		return n, nil
+	}
+	return nil, fmt.Errorf("invalid int: %T", v)
+}
+
+func toFloat(v any) (any, error) {
+	if d, ok := v.(apd.Decimal); ok {
+		return d.Float64()
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), nil
+	case reflect.String:
+		s := strings.TrimSpace(rv.String())
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid float: %q", s)
+		}
+		return f, nil
+	}
+	return nil, fmt.Errorf("invalid float: %T", v)
+}
+
+func toBool(v any) (any, error) {
+	switch v := v.(type) {
+	case bool:
+		return v, nil
+	case string:
+		b, err := strconv.ParseBool(strings.TrimSpace(v))
+		if err != nil {
+			return nil, fmt.Errorf("invalid bool: %q", v)
+		}
+		return b, nil
+	}
+	n, err := toInt(v)
+	if err != nil || n.(int64) != 0 && n.(int64) != 1 {
+		return nil, fmt.Errorf("invalid bool: %v", v)
+	}
+	return n.(int64) == 1, nil
+}
+
+var timeLayouts = []string{time.RFC3339Nano, "2006-01-02 15:04:05", "2006-01-02"}
+
+func (fs FieldSchema) toTime(v any) (any, error) {
+	switch v := v.(type) {
+	case time.Time:
+		return v, nil
+	case string:
+		s := strings.TrimSpace(v)
+		layouts := timeLayouts
+		if fs.Layout != "" {
+			layouts = []string{fs.Layout}
+		}
+		for _, l := range layouts {
+			if t, err := time.Parse(l, s); err == nil {
+				return t, nil
+			}
+		}
+		return nil, fmt.Errorf("invalid time: %q", s)
+	}
+	return nil, fmt.Errorf("invalid time: %T", v)
+}
+
+// equalFold returns a func used in Row.At to fetch a field by name case
+// insensitively.
+func equalFold(s string) func(Row) *Field {
+	return func(r Row) *Field {
+		for i := range r {
+			if strings.EqualFold(r[i].Name, s) {
+				return &r[i]
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,146 @@
+package drow_test
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stdiopt/danda/drow"
+)
+
+func TestSchemaCoerce(t *testing.T) {
+	schema := drow.NewSchema(
+		drow.FieldSchema{Name: "id", Type: drow.TypeInt},
+		drow.FieldSchema{Name: "name", Type: drow.TypeString, Length: 5, Pattern: regexp.MustCompile(`^[a-z]+$`)},
+		drow.FieldSchema{Name: "score", Type: drow.TypeFloat, Nullable: true, Min: 0, Max: 10},
+		drow.FieldSchema{Name: "active", Type: drow.TypeBool, Default: false},
+		drow.FieldSchema{Name: "status", Type: drow.TypeString, Enum: []any{"open", "closed"}, Default: "open"},
+		drow.FieldSchema{Name: "at", Type: drow.TypeTime, Nullable: true},
+	)
+	type test struct {
+		strict         bool
+		row            drow.Row
+		want           drow.Row
+		wantViolations []string
+	}
+	run := func(name string, tt test) {
+		t.Helper()
+		t.Run(name, func(t *testing.T) {
+			s := schema
+			s.Strict = tt.strict
+			got, err := s.Coerce(tt.row)
+			var verr *drow.ValidationError
+			if err != nil && !errors.As(err, &verr) {
+				t.Fatalf("wrong error type: %T", err)
+			}
+			var violations []string
+			if verr != nil {
+				for _, v := range verr.Violations {
+					violations = append(violations, v.Field)
+				}
+			}
+			if !reflect.DeepEqual(violations, tt.wantViolations) {
+				t.Fatalf("wrong violations\nwant: %v\n got: %v (%v)", tt.wantViolations, violations, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("wrong result\nwant: %v\n got: %v", tt.want, got)
+			}
+		})
+	}
+
+	run("csv strings", test{
+		row: drow.Row{
+			drow.F("ID", " 1"),
+			drow.F("name", "abc"),
+			drow.F("score", "7.5"),
+			drow.F("active", "true"),
+			drow.F("status", "closed"),
+			drow.F("at", "2022-01-02"),
+		},
+		want: drow.Row{
+			drow.F[any]("id", int64(1)),
+			drow.F[any]("name", "abc"),
+			drow.F[any]("score", 7.5),
+			drow.F[any]("active", true),
+			drow.F[any]("status", "closed"),
+			drow.F[any]("at", time.Date(2022, 1, 2, 0, 0, 0, 0, time.UTC)),
+		},
+	})
+	run("defaults and nulls", test{
+		row: drow.Row{drow.F("id", 2), drow.F("name", "x"), drow.F("score", ""), drow.F("extra", 1)},
+		want: drow.Row{
+			drow.F[any]("id", int64(2)),
+			drow.F[any]("name", "x"),
+			drow.F[any]("score", nil),
+			drow.F[any]("active", false),
+			drow.F[any]("status", "open"),
+			drow.F[any]("at", nil),
+		},
+	})
+	run("violations", test{
+		row: drow.Row{
+			drow.F("id", ""),
+			drow.F("name", "abcdef"),
+			drow.F("score", 11),
+			drow.F("active", "maybe"),
+			drow.F("status", "new"),
+			drow.F("at", "yesterday"),
+		},
+		wantViolations: []string{"id", "name", "score", "active", "status", "at"},
+	})
+	run("float int out of range", test{
+		row:            drow.Row{drow.F("id", float64(1<<63)), drow.F("name", "a")},
+		wantViolations: []string{"id"},
+	})
+	run("float int min", test{
+		row: drow.Row{drow.F("id", float64(math.MinInt64)), drow.F("name", "a")},
+		want: drow.Row{
+			drow.F[any]("id", int64(math.MinInt64)),
+			drow.F[any]("name", "a"),
+			drow.F[any]("score", nil),
+			drow.F[any]("active", false),
+			drow.F[any]("status", "open"),
+			drow.F[any]("at", nil),
+		},
+	})
+	run("pattern", test{
+		row:            drow.Row{drow.F("id", 1), drow.F("name", "ABC")},
+		wantViolations: []string{"name"},
+	})
+	run("strict", test{
+		strict:         true,
+		row:            drow.Row{drow.F("id", 1), drow.F("name", "a"), drow.F("extra", 1)},
+		wantViolations: []string{"extra"},
+	})
+}
+
+func TestSchemaMixedConstraints(t *testing.T) {
+	schema := drow.NewSchema(
+		drow.FieldSchema{Name: "x", Enum: []any{"a", 1}},
+		drow.FieldSchema{Name: "y", Nullable: true, Min: 1},
+	)
+	got, err := schema.Coerce(drow.Row{drow.F("x", 1)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := drow.Row{drow.F[any]("x", 1), drow.F[any]("y", nil)}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong result\nwant: %v\n got: %v", want, got)
+	}
+
+	_, err = schema.Coerce(drow.Row{drow.F("x", "b"), drow.F("y", "b")})
+	var verr *drow.ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("wrong error: %v", err)
+	}
+	var violations []string
+	for _, v := range verr.Violations {
+		violations = append(violations, v.Field)
+	}
+	if want := []string{"x", "y"}; !reflect.DeepEqual(violations, want) {
+		t.Errorf("wrong violations\nwant: %v\n got: %v", want, violations)
+	}
+}
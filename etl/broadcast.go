@@ -0,0 +1,202 @@
+package etl
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+type broadcastOptions struct {
+	buffer int
+}
+
+type BroadcastOptFunc func(*broadcastOptions)
+
+// WithBroadcastBuffer sets the number of values that can be buffered per
+// branch before the slowest branch blocks the others.
+func WithBroadcastBuffer(n int) BroadcastOptFunc {
+	return func(o *broadcastOptions) {
+		o.buffer = n
+	}
+}
+
+func makeBroadcastOptions(opts ...BroadcastOptFunc) broadcastOptions {
+	o := broadcastOptions{}
+	for _, fn := range opts {
+		fn(&o)
+	}
+	return o
+}
+
+// Broadcast returns n iterators that yield every value of it.
+//
+// The source is consumed once, the first Next on any branch starts it and
+// each value is delivered to every open branch, so a branch that isn't
+// consumed will block the others once its buffer is full.
+// Errors from the source are delivered to all branches, cancelling the
+// context on a branch Next cancels all branches and a branch closed with
+// CloseWithError cancels the others with that error.
+// Closing a branch detaches it from the stream so the others keep going and
+// blocks until every branch is closed, the source is closed once the last
+// branch is closed and every Close returns the source Close error joined
+// with the errors the branches were closed with. Since Close blocks, each
+// branch must be closed and branches consumed by the same goroutine must
+// not be closed one at a time while the others are still being consumed.
+func Broadcast(it Iter, n int, opts ...BroadcastOptFunc) []Iter {
+	o := makeBroadcastOptions(opts...)
+	ctx, cancel := context.WithCancelCause(context.Background())
+	b := &broadcast{
+		src:    it,
+		ctx:    ctx,
+		cancel: cancel,
+		open:   n,
+		done:   make(chan struct{}),
+		closed: make(chan struct{}),
+	}
+	its := make([]Iter, n)
+	for i := range its {
+		br := &branch{
+			b:        b,
+			out:      make(chan msg[any], o.buffer),
+			detached: make(chan struct{}),
+		}
+		b.branches = append(b.branches, br)
+		its[i] = br
+	}
+	return its
+}
+
+type broadcast struct {
+	src      Iter
+	branches []*branch
+	ctx      context.Context
+	cancel   context.CancelCauseFunc
+
+	startOnce sync.Once
+	mu        sync.Mutex
+	started   bool
+	open      int
+	done      chan struct{}
+	errs      []error
+	closed    chan struct{}
+	closeErr  error
+}
+
+func (b *broadcast) start() {
+	b.startOnce.Do(func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		// all branches were closed before any Next
+		if b.open == 0 {
+			return
+		}
+		b.started = true
+		go b.run()
+	})
+}
+
+func (b *broadcast) run() {
+	defer close(b.done)
+	defer func() {
+		for _, br := range b.branches {
+			close(br.out)
+		}
+	}()
+	for {
+		v, err := b.src.Next(b.ctx)
+		m := msg[any]{value: v, err: err}
+		for _, br := range b.branches {
+			select {
+			case br.out <- m:
+			case <-br.detached:
+			case <-b.ctx.Done():
+				return
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// closeBranch is called when a branch is closed with err, the last one
+// stops the stream and closes the source while the others wait for it.
+func (b *broadcast) closeBranch(err error) error {
+	b.mu.Lock()
+	b.open--
+	if err != nil {
+		b.errs = append(b.errs, err)
+	}
+	last := b.open == 0
+	started := b.started
+	b.mu.Unlock()
+	if !last {
+		<-b.closed
+		return b.closeErr
+	}
+	b.cancel(ErrCancelled)
+	if started {
+		<-b.done
+	}
+	b.closeErr = errors.Join(append([]error{b.src.Close()}, b.errs...)...)
+	close(b.closed)
+	return b.closeErr
+}
+
+type branch struct {
+	b         *broadcast
+	out       chan msg[any]
+	detached  chan struct{}
+	closeOnce sync.Once
+	closeErr  error
+}
+
+func (br *branch) Next(ctx context.Context) (any, error) {
+	br.b.start()
+	if err := ctx.Err(); err != nil {
+		br.b.cancel(err)
+		return nil, err
+	}
+	select {
+	case <-ctx.Done():
+		br.b.cancel(ctx.Err())
+		return nil, ctx.Err()
+	case m, ok := <-br.out:
+		if !ok {
+			if err := context.Cause(br.b.ctx); err != nil {
+				return nil, err
+			}
+			return nil, EOI
+		}
+		return m.value, m.err
+	case <-br.b.ctx.Done():
+		return nil, context.Cause(br.b.ctx)
+	}
+}
+
+// CloseWithError closes the branch and cancels the other branches, their
+// Next returns err.
+func (br *branch) CloseWithError(err error) error {
+	br.closeOnce.Do(func() {
+		if err != nil {
+			br.b.cancel(err)
+		}
+		close(br.detached)
+		br.closeErr = br.b.closeBranch(err)
+	})
+	return br.closeErr
+}
+
+func (br *branch) Close() error {
+	return br.CloseWithError(nil)
+}
+
+// CloseWithError closes it and reports err to the iterators sharing its
+// source when it supports it, as Broadcast branches do, otherwise it only
+// closes it.
+func CloseWithError(it Iter, err error) error {
+	if c, ok := it.(interface{ CloseWithError(error) error }); ok {
+		return c.CloseWithError(err)
+	}
+	return it.Close()
+}
@@ -0,0 +1,80 @@
+package etl
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBroadcastBranchError(t *testing.T) {
+	errBranch := errors.New("branch error")
+	its := Broadcast(Seq(0, 1000, 1), 2)
+
+	ctx := context.Background()
+	if _, err := its[0].Next(ctx); err != nil {
+		t.Fatal(err)
+	}
+	closed := make(chan error, 1)
+	go func() { closed <- CloseWithError(its[0], errBranch) }()
+
+	var err error
+	for err == nil {
+		_, err = its[1].Next(ctx)
+	}
+	if !errors.Is(err, errBranch) {
+		t.Errorf("sibling Next() error = %v, want %v", err, errBranch)
+	}
+	if err := its[1].Close(); !errors.Is(err, errBranch) {
+		t.Errorf("Close() error = %v, want %v", err, errBranch)
+	}
+	if err := <-closed; !errors.Is(err, errBranch) {
+		t.Errorf("CloseWithError() error = %v, want %v", err, errBranch)
+	}
+}
+
+func TestBroadcastCloseWaits(t *testing.T) {
+	errSrc := errors.New("source close error")
+	src := Seq(0, 100, 1)
+	its := Broadcast(MakeIter(Custom[any]{
+		Next: src.Next,
+		Close: func() error {
+			src.Close() // nolint: errcheck
+			return errSrc
+		},
+	}), 2)
+
+	// the side branch is still reading when the main branch closes.
+	var sideRead int32
+	sideErr := make(chan error, 1)
+	go func() {
+		err := Consume(its[1], func(int) error {
+			time.Sleep(time.Millisecond)
+			atomic.AddInt32(&sideRead, 1)
+			return nil
+		})
+		sideErr <- errors.Join(err, its[1].Close())
+	}()
+
+	n := 0
+	if err := Consume(its[0], func(int) error {
+		n++
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	err := its[0].Close()
+	if got := atomic.LoadInt32(&sideRead); got != 100 {
+		t.Errorf("main Close() returned with %d values read by the side branch, want 100", got)
+	}
+	if n != 100 {
+		t.Errorf("main branch read %d values, want 100", n)
+	}
+	if !errors.Is(err, errSrc) {
+		t.Errorf("main Close() error = %v, want %v", err, errSrc)
+	}
+	if err := <-sideErr; !errors.Is(err, errSrc) {
+		t.Errorf("side Close() error = %v, want %v", err, errSrc)
+	}
+}
@@ -0,0 +1,181 @@
+package etl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Positioner is implemented by iterators that can report a resumable
+// position, the position is the one after the last value returned by Next
+// and an empty string means the start.
+//
+// The position can be committed by a sink together with the values it
+// consumed so a restarted pipeline passes it back to the source and resumes
+// where it left off, sources document the option used to resume.
+// Positions are only accurate when the sink pulls values synchronously from
+// the source, buffering or concurrent stages in between read ahead.
+type Positioner interface {
+	Position() string
+}
+
+type positionIter struct {
+	Iter
+	pos func() string
+}
+
+func (it *positionIter) Position() string { return it.pos() }
+
+// WithPosition returns an iterator that implements Positioner with the
+// position reported by fn.
+func WithPosition(it Iter, fn func() string) Iter {
+	return &positionIter{Iter: it, pos: fn}
+}
+
+// PositionBy returns an iterator that implements Positioner with the
+// position of the last value returned by it, as reported by fn, start is
+// returned as the position before the first value.
+func PositionBy[T any](it Iter, start string, fn func(T) string) Iter {
+	pos := start
+	return &positionIter{
+		Iter: MakeIter(Custom[any]{
+			Next: func(ctx context.Context) (any, error) {
+				v, err := it.Next(ctx)
+				if err != nil {
+					return nil, err
+				}
+				t, ok := v.(T)
+				if !ok {
+					return nil, fmt.Errorf("iter.PositionBy: type mismatch: %T", v)
+				}
+				pos = fn(t)
+				return v, nil
+			},
+			Close: it.Close,
+		}),
+		pos: func() string { return pos },
+	}
+}
+
+// PositionOf returns the position of it if it implements Positioner.
+func PositionOf(it Iter) (string, bool) {
+	p, ok := it.(Positioner)
+	if !ok {
+		return "", false
+	}
+	return p.Position(), true
+}
+
+// CheckpointStore loads and saves named positions, Load returns an empty
+// string if there is no position saved for name.
+type CheckpointStore interface {
+	Load(ctx context.Context, name string) (string, error)
+	Save(ctx context.Context, name, pos string) error
+}
+
+type fileCheckpoint struct {
+	dir string
+}
+
+// FileCheckpoint returns a CheckpointStore that keeps a file per name in
+// dir, files are replaced atomically on Save.
+func FileCheckpoint(dir string) CheckpointStore {
+	return fileCheckpoint{dir: dir}
+}
+
+func (c fileCheckpoint) Load(_ context.Context, name string) (string, error) {
+	p, err := c.path(name)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func (c fileCheckpoint) Save(_ context.Context, name, pos string) error {
+	p, err := c.path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(c.dir, ".checkpoint-*")
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(pos); err != nil {
+		f.Close()           // nolint: errcheck
+		os.Remove(f.Name()) // nolint: errcheck
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()           // nolint: errcheck
+		os.Remove(f.Name()) // nolint: errcheck
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name()) // nolint: errcheck
+		return err
+	}
+	return os.Rename(f.Name(), p)
+}
+
+func (c fileCheckpoint) path(name string) (string, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return "", fmt.Errorf("etl.FileCheckpoint: invalid name %q", name)
+	}
+	return filepath.Join(c.dir, name), nil
+}
+
+// Checkpoint returns an iterator that saves the position of src into store
+// after every n values are consumed from it and when it reaches the end,
+// it is meant for sinks that have no transaction of their own.
+//
+// The position is saved before the next value is read, so a value might be
+// processed again after a crash if the sink didn't finish it, sinks that
+// commit data should save the position in the same transaction instead.
+func Checkpoint(it Iter, src Positioner, store CheckpointStore, name string, n int) Iter {
+	if n < 1 {
+		n = 1
+	}
+	count := 0
+	save := func(ctx context.Context) error {
+		if err := store.Save(ctx, name, src.Position()); err != nil {
+			return fmt.Errorf("iter.Checkpoint: saving %q: %w", name, err)
+		}
+		return nil
+	}
+	return MakeIter(Custom[any]{
+		Next: func(ctx context.Context) (any, error) {
+			if count > 0 && count%n == 0 {
+				if err := save(ctx); err != nil {
+					return nil, err
+				}
+			}
+			v, err := it.Next(ctx)
+			if err == EOI && count%n != 0 {
+				if err := save(ctx); err != nil {
+					return nil, err
+				}
+				count = 0
+			}
+			if err != nil {
+				return nil, err
+			}
+			count++
+			return v, nil
+		},
+		Close: it.Close,
+	})
+}
@@ -0,0 +1,58 @@
+package etl
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"io"
+)
+
+// Codec encodes and decodes a stream of values to an io.Writer/io.Reader,
+// it is used by stages that need to spill values to disk.
+type Codec[T any] struct {
+	// NewEncoder returns a func that writes a value to w.
+	NewEncoder func(w io.Writer) func(T) error
+	// NewDecoder returns a func that reads the next value from r, it returns
+	// io.EOF when there are no more values.
+	NewDecoder func(r io.Reader) func() (T, error)
+}
+
+// GobCodec returns a Codec that uses encoding/gob, values stored in
+// interfaces must be registered with gob.Register.
+func GobCodec[T any]() Codec[T] {
+	return Codec[T]{
+		NewEncoder: func(w io.Writer) func(T) error {
+			enc := gob.NewEncoder(w)
+			return func(v T) error {
+				return enc.Encode(&v)
+			}
+		},
+		NewDecoder: func(r io.Reader) func() (T, error) {
+			dec := gob.NewDecoder(r)
+			return func() (T, error) {
+				var v T
+				err := dec.Decode(&v)
+				return v, err
+			}
+		},
+	}
+}
+
+// JSONCodec returns a Codec that uses encoding/json.
+func JSONCodec[T any]() Codec[T] {
+	return Codec[T]{
+		NewEncoder: func(w io.Writer) func(T) error {
+			enc := json.NewEncoder(w)
+			return func(v T) error {
+				return enc.Encode(v)
+			}
+		},
+		NewDecoder: func(r io.Reader) func() (T, error) {
+			dec := json.NewDecoder(r)
+			return func() (T, error) {
+				var v T
+				err := dec.Decode(&v)
+				return v, err
+			}
+		},
+	}
+}
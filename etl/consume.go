@@ -20,6 +20,7 @@ func Collect[T any](it Iter) ([]T, error) {
 	return CollectContext[T](context.Background(), it)
 }
 
+// ConsumeContext iterates over the given iterator and calls fn for each value.
 func ConsumeContext[T any](ctx context.Context, it Iter, fn func(T) error) error {
 	for {
 		vv, err := it.Next(ctx)
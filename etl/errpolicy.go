@@ -0,0 +1,199 @@
+package etl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrSkip can be returned by stage funcs (MapE, Workers*) to drop the
+// current value and continue with the next one, Consume funcs can be
+// wrapped with GuardConsume.
+var ErrSkip = errors.New("skip value")
+
+// maxSummaryErrors is the number of errors kept in ErrSummary.
+const maxSummaryErrors = 10
+
+// ErrMode is the action taken by an ErrPolicy when processing a value fails.
+type ErrMode int
+
+const (
+	// ErrModeAbort returns the error and stops the pipeline.
+	ErrModeAbort ErrMode = iota
+	// ErrModeSkip drops the value and counts it.
+	ErrModeSkip
+	// ErrModeDeadLetter drops the value and sends it to a dead letter func.
+	ErrModeDeadLetter
+)
+
+func (m ErrMode) String() string {
+	switch m {
+	case ErrModeAbort:
+		return "abort"
+	case ErrModeSkip:
+		return "skip"
+	case ErrModeDeadLetter:
+		return "dead-letter"
+	}
+	return "unknown"
+}
+
+// DeadLetter is a value that failed to be processed and the respective error.
+type DeadLetter struct {
+	Value any
+	Err   error
+}
+
+func (d DeadLetter) String() string {
+	return fmt.Sprintf("%v: %v", d.Err, d.Value)
+}
+
+// ErrSummary contains the number of failed values handled by an ErrPolicy.
+type ErrSummary struct {
+	Skipped      int
+	DeadLettered int
+	// Errors contains the first errors handled by the policy.
+	Errors []error
+}
+
+// Total returns the number of values that were dropped.
+func (s ErrSummary) Total() int {
+	return s.Skipped + s.DeadLettered
+}
+
+func (s ErrSummary) String() string {
+	return fmt.Sprintf("skipped: %d, dead lettered: %d", s.Skipped, s.DeadLettered)
+}
+
+// ErrPolicy decides what happens to values that fail in a stage, the same
+// policy can be shared by several stages of a pipeline and it is safe for
+// concurrent use.
+//
+//	p := etl.SkipOnError()
+//	it = etlcsv.Decode(it, etlcsv.WithDecodeErrPolicy(p))
+//	it = etl.MapE(it, etl.Guard(p, parseRow))
+//	...
+//	log.Println(p.Summary())
+type ErrPolicy struct {
+	mode       ErrMode
+	deadLetter func(DeadLetter) error
+
+	mu      sync.Mutex
+	summary ErrSummary
+}
+
+// AbortOnError returns a policy that returns the error, this is the default
+// behaviour of the stages.
+func AbortOnError() *ErrPolicy {
+	return &ErrPolicy{mode: ErrModeAbort}
+}
+
+// SkipOnError returns a policy that drops failed values.
+func SkipOnError() *ErrPolicy {
+	return &ErrPolicy{mode: ErrModeSkip}
+}
+
+// DeadLetterOnError returns a policy that drops failed values and calls fn
+// with the value and the error, if fn returns an error the pipeline is
+// aborted.
+func DeadLetterOnError(fn func(DeadLetter) error) *ErrPolicy {
+	return &ErrPolicy{mode: ErrModeDeadLetter, deadLetter: fn}
+}
+
+// Mode returns the policy mode.
+func (p *ErrPolicy) Mode() ErrMode {
+	if p == nil {
+		return ErrModeAbort
+	}
+	return p.mode
+}
+
+// Handle applies the policy to a failed value, it returns ErrSkip if the
+// value should be dropped or the error that should stop the pipeline.
+// A nil policy behaves as AbortOnError.
+func (p *ErrPolicy) Handle(v any, err error) error {
+	if p == nil || err == nil || err == EOI || errors.Is(err, ErrSkip) {
+		return err
+	}
+	switch p.mode {
+	case ErrModeSkip:
+		p.mu.Lock()
+		p.summary.Skipped++
+		p.addErr(err)
+		p.mu.Unlock()
+		return ErrSkip
+	case ErrModeDeadLetter:
+		p.mu.Lock()
+		p.summary.DeadLettered++
+		p.addErr(err)
+		p.mu.Unlock()
+		// called without the lock so a slow dead letter doesn't serialize
+		// the workers sharing the policy.
+		if p.deadLetter != nil {
+			if derr := p.deadLetter(DeadLetter{Value: v, Err: err}); derr != nil {
+				return fmt.Errorf("dead letter: %w", derr)
+			}
+		}
+		return ErrSkip
+	default:
+		return err
+	}
+}
+
+// Summary returns the summary of the handled values.
+func (p *ErrPolicy) Summary() ErrSummary {
+	if p == nil {
+		return ErrSummary{}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s := p.summary
+	s.Errors = append([]error{}, p.summary.Errors...)
+	return s
+}
+
+func (p *ErrPolicy) addErr(err error) {
+	if len(p.summary.Errors) < maxSummaryErrors {
+		p.summary.Errors = append(p.summary.Errors, err)
+	}
+}
+
+// Guard wraps fn so errors are handled by the policy p, it can be used in
+// MapE.
+func Guard[Ti, To any](p *ErrPolicy, fn func(Ti) (To, error)) func(Ti) (To, error) {
+	return func(v Ti) (To, error) {
+		r, err := fn(v)
+		if err != nil {
+			return r, p.Handle(v, err)
+		}
+		return r, nil
+	}
+}
+
+// GuardConsume wraps fn so errors are handled by the policy p, dropped
+// values are ignored so it can be used in Consume.
+func GuardConsume[T any](p *ErrPolicy, fn func(T) error) func(T) error {
+	return func(v T) error {
+		err := fn(v)
+		if err == nil {
+			return nil
+		}
+		if err := p.Handle(v, err); !errors.Is(err, ErrSkip) {
+			return err
+		}
+		return nil
+	}
+}
+
+// GuardContext wraps fn so errors are handled by the policy p, it can be used
+// in WorkersMap.
+func GuardContext[Ti, To any](p *ErrPolicy, fn func(context.Context, Ti) (To, error)) func(context.Context, Ti) (To, error) {
+	return func(ctx context.Context, v Ti) (To, error) {
+		r, err := fn(ctx, v)
+		if err != nil && ctx.Err() == nil {
+			return r, p.Handle(v, err)
+		}
+		return r, err
+	}
+}
@@ -4,7 +4,9 @@ package etlcsv
 import (
 	"context"
 	"encoding/csv"
+	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 
 	"github.com/stdiopt/danda/drow"
@@ -23,8 +25,10 @@ type (
 
 type decodeOptions struct {
 	// Comma is the field delimiter.
-	Comma  rune
-	Header bool
+	Comma     rune
+	Header    bool
+	ErrPolicy *etl.ErrPolicy
+	Resume    int
 }
 
 type DecodeOptFunc func(*decodeOptions)
@@ -41,6 +45,30 @@ func WithDecodeHeader(v bool) DecodeOptFunc {
 	}
 }
 
+// WithDecodeErrPolicy sets the policy used for malformed lines, the failed
+// record (if any) is passed as the value to the policy.
+func WithDecodeErrPolicy(p *etl.ErrPolicy) DecodeOptFunc {
+	return func(o *decodeOptions) {
+		o.ErrPolicy = p
+	}
+}
+
+// WithDecodeResume skips the records up to the position previously reported
+// by the Decode iterator, see etl.Positioner.
+func WithDecodeResume(pos string) DecodeOptFunc {
+	return func(o *decodeOptions) {
+		if pos == "" {
+			return
+		}
+		n, err := strconv.Atoi(pos)
+		if err != nil || n < 0 {
+			// invalid positions are reported by Decode
+			n = -1
+		}
+		o.Resume = n
+	}
+}
+
 func makeDecodeOptions(opts ...DecodeOptFunc) decodeOptions {
 	o := decodeOptions{
 		Comma:  ',',
@@ -54,13 +82,22 @@ func makeDecodeOptions(opts ...DecodeOptFunc) decodeOptions {
 
 // Decode returns an iterator that reads danda.Iter based on []byte and produces danda.Row
 // Close will close the underlying iterator.
+//
+// The returned iterator implements etl.Positioner with the number of
+// records read, which can be passed to WithDecodeResume.
 func Decode(it Iter, opts ...DecodeOptFunc) Iter {
 	o := makeDecodeOptions(opts...)
+	if o.Resume < 0 {
+		it.Close() // nolint: errcheck
+		return etl.ErrIter(errors.New("etlcsv.Decode: invalid resume position"))
+	}
 
 	pr := etlio.AsReader(it)
 	var cr *csv.Reader
 	var cols []string
-	return etl.MakeIter(etl.Custom[Row]{
+	// records is the number of records read, excluding the header.
+	records := 0
+	dec := etl.MakeIter(etl.Custom[Row]{
 		Next: func(context.Context) (Row, error) {
 			if cr == nil {
 				cr = csv.NewReader(pr)
@@ -77,16 +114,31 @@ func Decode(it Iter, opts ...DecodeOptFunc) Iter {
 						cols[i] = fmt.Sprintf("col%d", i+1)
 						row[i] = Field{Name: cols[i], Value: strings.TrimSpace(r)}
 					}
-					return row, nil
+					records++
+					if records > o.Resume {
+						return row, nil
+					}
+				} else {
+					cols = c
 				}
-				cols = c
 			}
 
 			for {
 				dataRow, err := cr.Read()
-				if err != nil {
+				var perr *csv.ParseError
+				if err != nil && !errors.As(err, &perr) {
 					return nil, err
 				}
+				records++
+				if records <= o.Resume {
+					continue
+				}
+				if err != nil {
+					if err := o.ErrPolicy.Handle(dataRow, err); err != etl.ErrSkip {
+						return nil, err
+					}
+					continue
+				}
 				if len(dataRow) == 0 {
 					continue
 				}
@@ -99,4 +151,7 @@ func Decode(it Iter, opts ...DecodeOptFunc) Iter {
 		},
 		Close: it.Close,
 	})
+	return etl.WithPosition(dec, func() string {
+		return strconv.Itoa(records)
+	})
 }
@@ -0,0 +1,129 @@
+package etldrow
+
+import (
+	"encoding/gob"
+	"io"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/apd"
+
+	"github.com/stdiopt/danda/drow"
+	"github.com/stdiopt/danda/etl"
+)
+
+var registerOnce sync.Once
+
+// wireField is the gob representation of a field, gob can't encode nil
+// pointers inside interfaces so pointers are flagged and dereferenced.
+type wireField struct {
+	Name  string
+	Ptr   bool
+	Null  bool
+	Value any
+}
+
+type wireRow []wireField
+
+type wireDecimal string
+
+// RowCodec returns an etl.Codec that encodes rows with encoding/gob, it
+// supports the value types produced by the danda decoders, other types
+// stored in fields must be registered with gob.Register.
+func RowCodec() etl.Codec[Row] {
+	registerOnce.Do(func() {
+		gob.Register(wireRow{})
+		gob.Register(time.Time{})
+		gob.Register(wireDecimal(""))
+		gob.Register([]any{})
+		gob.Register(map[string]any{})
+	})
+	return etl.Codec[Row]{
+		NewEncoder: func(w io.Writer) func(Row) error {
+			enc := gob.NewEncoder(w)
+			return func(row Row) error {
+				return enc.Encode(toWire(row))
+			}
+		},
+		NewDecoder: func(r io.Reader) func() (Row, error) {
+			dec := gob.NewDecoder(r)
+			return func() (Row, error) {
+				var wr wireRow
+				if err := dec.Decode(&wr); err != nil {
+					return nil, err
+				}
+				return fromWire(wr), nil
+			}
+		},
+	}
+}
+
+// Sort returns an iterator that yields the rows of it sorted by less,
+// spilling to disk with RowCodec when the budget is exceeded.
+func Sort(it Iter, less func(a, b Row) bool, opts ...etl.SortOptFunc) Iter {
+	opts = append([]etl.SortOptFunc{etl.WithSortCodec(RowCodec())}, opts...)
+	return etl.Sort(it, less, opts...)
+}
+
+func toWire(row Row) wireRow {
+	wr := make(wireRow, len(row))
+	for i, f := range row {
+		wf := wireField{Name: f.Name}
+		if rv := reflect.ValueOf(f.Value); rv.Kind() == reflect.Pointer {
+			wf.Ptr = true
+			if rv.IsNil() {
+				wf.Null = true
+				rv = reflect.Zero(rv.Type().Elem())
+			} else {
+				rv = rv.Elem()
+			}
+			wf.Value = toWireValue(rv.Interface())
+		} else {
+			wf.Value = toWireValue(f.Value)
+		}
+		wr[i] = wf
+	}
+	return wr
+}
+
+func toWireValue(v any) any {
+	switch v := v.(type) {
+	case Row:
+		return toWire(v)
+	case apd.Decimal:
+		// big.Int inside a decimal value is not addressable by gob
+		return wireDecimal(v.String())
+	}
+	return v
+}
+
+func fromWire(wr wireRow) Row {
+	row := make(Row, len(wr))
+	for i, wf := range wr {
+		v := fromWireValue(wf.Value)
+		switch {
+		case wf.Ptr && wf.Null:
+			v = reflect.Zero(reflect.PointerTo(reflect.TypeOf(v))).Interface()
+		case wf.Ptr:
+			p := reflect.New(reflect.TypeOf(v))
+			p.Elem().Set(reflect.ValueOf(v))
+			v = p.Interface()
+		}
+		row[i] = drow.Field{Name: wf.Name, Value: v}
+	}
+	return row
+}
+
+func fromWireValue(v any) any {
+	switch v := v.(type) {
+	case wireRow:
+		return fromWire(v)
+	case wireDecimal:
+		d := apd.Decimal{}
+		// it was encoded from a valid decimal
+		d.SetString(string(v)) // nolint: errcheck
+		return d
+	}
+	return v
+}
@@ -0,0 +1,135 @@
+package etldrow
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/apd"
+
+	"github.com/stdiopt/danda/drow"
+	"github.com/stdiopt/danda/etl"
+)
+
+func TestRowCodec(t *testing.T) {
+	dec := func(s string) apd.Decimal {
+		d, _, err := apd.NewFromString(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return *d
+	}
+	at := time.Date(2022, 1, 2, 3, 4, 5, 6, time.UTC)
+	n, d := 7, dec("-12345678901234567890.50")
+
+	type test struct {
+		row Row
+	}
+	run := func(name string, tt test) {
+		t.Helper()
+		t.Run(name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			c := RowCodec()
+			enc := c.NewEncoder(buf)
+			// twice to check the stream keeps the values apart
+			for i := 0; i < 2; i++ {
+				if err := enc(tt.row); err != nil {
+					t.Fatal(err)
+				}
+			}
+			next := c.NewDecoder(buf)
+			for i := 0; i < 2; i++ {
+				got, err := next()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(got, tt.row) {
+					t.Errorf("round trip\nwant: %#v\n got: %#v", tt.row, got)
+				}
+			}
+			if _, err := next(); err != io.EOF {
+				t.Errorf("decoder error = %v, want %v", err, io.EOF)
+			}
+		})
+	}
+	run("scalars", test{row: Row{
+		drow.F("s", "a"),
+		drow.F("i", 1),
+		drow.F("i64", int64(-2)),
+		drow.F("f", 1.5),
+		drow.F("b", true),
+	}})
+	run("nil", test{row: Row{drow.F[any]("v", nil)}})
+	run("pointers", test{row: Row{
+		drow.F("int", &n),
+		drow.F("nil int", (*int)(nil)),
+		drow.F("nil string", (*string)(nil)),
+		drow.F("decimal", &d),
+		drow.F("nil decimal", (*apd.Decimal)(nil)),
+	}})
+	run("time", test{row: Row{drow.F("t", at)}})
+	run("decimal", test{row: Row{drow.F("d", d), drow.F("small", dec("0.001"))}})
+	run("nested", test{row: Row{
+		drow.F("id", 1),
+		drow.F("user", Row{
+			drow.F("name", "Ann"),
+			drow.F("address", Row{drow.F("city", "Lisbon"), drow.F[any]("zip", nil)}),
+			drow.F("created", at),
+			drow.F("balance", d),
+		}),
+	}})
+	run("slices and maps", test{row: Row{
+		drow.F("list", []any{"a", 1}),
+		drow.F("map", map[string]any{"k": "v"}),
+	}})
+}
+
+func TestSortSpill(t *testing.T) {
+	rows := []Row{}
+	for i := 0; i < 50; i++ {
+		rows = append(rows, Row{
+			drow.F("key", i%5),
+			drow.F("seq", i),
+			drow.F("at", time.Unix(int64(i), 0).UTC()),
+			drow.F("nested", Row{drow.F[any]("v", nil)}),
+		})
+	}
+	key := func(r Row) int { return r.Value("key").(int) }
+	it := Sort(etl.Values(rows...), func(a, b Row) bool { return key(a) < key(b) },
+		etl.WithSortBudget(3),
+		etl.WithSortTempDir(t.TempDir()),
+	)
+	defer it.Close()
+
+	prev := Row(nil)
+	count := 0
+	for {
+		v, err := it.Next(context.Background())
+		if err == etl.EOI {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		row := v.(Row)
+		if prev != nil {
+			if key(row) < key(prev) {
+				t.Fatalf("row %v sorted after %v", row, prev)
+			}
+			if key(row) == key(prev) && row.Value("seq").(int) < prev.Value("seq").(int) {
+				t.Fatalf("equal rows out of input order: %v after %v", row, prev)
+			}
+		}
+		if !reflect.DeepEqual(row, rows[row.Value("seq").(int)]) {
+			t.Errorf("row changed by spilling\nwant: %v\n got: %v", rows[row.Value("seq").(int)], row)
+		}
+		prev = row
+		count++
+	}
+	if count != len(rows) {
+		t.Errorf("Sort() returned %d rows, want %d", count, len(rows))
+	}
+}
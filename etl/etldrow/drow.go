@@ -2,7 +2,11 @@
 package etldrow
 
 import (
+	"context"
+	"fmt"
+
 	"github.com/stdiopt/danda/drow"
+	"github.com/stdiopt/danda/drow/expr"
 	"github.com/stdiopt/danda/etl"
 )
 
@@ -41,3 +45,73 @@ func ToMap(it Iter) Iter {
 		return row.ToMap()
 	})
 }
+
+// Filter returns an iterator that yields the rows that fn returns true.
+func Filter(it Iter, fn func(Row) bool) Iter {
+	return etl.Filter(it, fn)
+}
+
+// FilterExpr returns an iterator that yields the rows that match the
+// expression src, see package drow/expr for the syntax.
+func FilterExpr(it Iter, src string) Iter {
+	e, err := expr.CompileFilter(src)
+	if err != nil {
+		it.Close() // nolint: errcheck
+		return etl.ErrIter(err)
+	}
+	return etl.MakeIter(etl.Custom[Row]{
+		Next: func(ctx context.Context) (Row, error) {
+			for {
+				v, err := it.Next(ctx)
+				if err != nil {
+					return nil, err
+				}
+				row, ok := v.(Row)
+				if !ok {
+					return nil, fmt.Errorf("etldrow.FilterExpr: type mismatch: %T", v)
+				}
+				match, err := e.Match(row)
+				if err != nil {
+					return nil, err
+				}
+				if match {
+					return row, nil
+				}
+			}
+		},
+		Close: it.Close,
+	})
+}
+
+// Coerce returns an iterator that converts the rows to the schema s, rows
+// that don't conform fail with a *drow.ValidationError handled by policy,
+// a nil policy aborts.
+func Coerce(it Iter, s drow.Schema, policy *etl.ErrPolicy) Iter {
+	return etl.MapE(it, etl.Guard(policy, s.Coerce))
+}
+
+// Compute returns an iterator that yields rows with the fields set by the
+// assignment expressions in order, as in "total = price * qty".
+func Compute(it Iter, assigns ...string) Iter {
+	exprs := make([]*expr.Expr, len(assigns))
+	for i, src := range assigns {
+		e, err := expr.Compile(src)
+		if err == nil && e.Name() == "" {
+			err = fmt.Errorf("etldrow.Compute: %q is not an assignment", src)
+		}
+		if err != nil {
+			it.Close() // nolint: errcheck
+			return etl.ErrIter(err)
+		}
+		exprs[i] = e
+	}
+	return etl.MapE(it, func(row Row) (Row, error) {
+		for _, e := range exprs {
+			var err error
+			if row, err = e.Assign(row); err != nil {
+				return nil, err
+			}
+		}
+		return row, nil
+	})
+}
@@ -3,6 +3,7 @@ package etlhttp
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -56,6 +57,33 @@ func (g *getOptions) applyToReq(req *http.Request) {
 	}
 }
 
+// StatusError is returned by Get when the server responds with an error
+// status code.
+type StatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("http status code: %d - %v", e.StatusCode, e.Status)
+}
+
+// Retryable reports if err is worth retrying, it can be used with
+// etl.WithRetryIf, network errors, 429 and 5xx status codes are retryable.
+// Get marks these status errors with etl.Transient so the default retry
+// classifier also retries them.
+func Retryable(err error) bool {
+	var serr *StatusError
+	if errors.As(err, &serr) {
+		return retryableStatus(serr.StatusCode)
+	}
+	return etl.Retryable(err)
+}
+
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= 500
+}
+
 func Get(url string, opts ...GetOptFunc) Iter {
 	o := makeGetOptions(opts...)
 
@@ -73,7 +101,12 @@ func Get(url string, opts ...GetOptFunc) Iter {
 			return nil, fmt.Errorf("etlhttp.Get: error calling request: %w", err)
 		}
 		if res.StatusCode < 200 || res.StatusCode >= 400 {
-			return nil, fmt.Errorf("http status code: %d - %v", res.StatusCode, res.Status)
+			res.Body.Close() // nolint: errcheck
+			var err error = &StatusError{StatusCode: res.StatusCode, Status: res.Status}
+			if retryableStatus(res.StatusCode) {
+				err = etl.Transient(err)
+			}
+			return nil, err
 		}
 
 		return res, nil
@@ -0,0 +1,53 @@
+package etlhttp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stdiopt/danda/etl"
+)
+
+func TestGetRetry(t *testing.T) {
+	type test struct {
+		statuses     []int
+		wantAttempts int
+		wantStatus   int
+	}
+	run := func(name string, tt test) {
+		t.Helper()
+		t.Run(name, func(t *testing.T) {
+			attempts := 0
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.statuses[attempts])
+				attempts++
+				w.Write([]byte("ok")) // nolint: errcheck
+			}))
+			defer srv.Close()
+
+			it := etl.Retry(func() etl.Iter {
+				return Get(srv.URL)
+			}, etl.WithAttempts(len(tt.statuses)), etl.WithBackoff(time.Millisecond, time.Millisecond))
+			defer it.Close()
+			_, err := it.Next(context.Background())
+
+			var serr *StatusError
+			switch {
+			case tt.wantStatus == 0 && err != nil:
+				t.Errorf("Next() error = %v", err)
+			case tt.wantStatus != 0 && (!errors.As(err, &serr) || serr.StatusCode != tt.wantStatus):
+				t.Errorf("Next() error = %v, want status %d", err, tt.wantStatus)
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", attempts, tt.wantAttempts)
+			}
+		})
+	}
+	run("server error", test{statuses: []int{503, 500, 200}, wantAttempts: 3})
+	run("too many requests", test{statuses: []int{429, 200}, wantAttempts: 2})
+	run("not found", test{statuses: []int{404, 200}, wantAttempts: 1, wantStatus: 404})
+	run("exhausted", test{statuses: []int{502, 502}, wantAttempts: 2, wantStatus: 502})
+}
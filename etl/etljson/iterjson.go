@@ -12,15 +12,60 @@ import (
 // Iter alias to iter.Iter
 type Iter = etl.Iter
 
+type decodeOptions struct {
+	ErrPolicy *etl.ErrPolicy
+}
+
+type DecodeOptFunc func(*decodeOptions)
+
+// WithDecodeErrPolicy sets the policy used for values that can't be
+// unmarshalled into T, the raw json is passed as the value to the policy.
+// Syntax errors still abort the decoding since the stream can't be resumed.
+func WithDecodeErrPolicy(p *etl.ErrPolicy) DecodeOptFunc {
+	return func(o *decodeOptions) {
+		o.ErrPolicy = p
+	}
+}
+
+func makeDecodeOptions(opts ...DecodeOptFunc) decodeOptions {
+	o := decodeOptions{}
+	for _, fn := range opts {
+		fn(&o)
+	}
+	return o
+}
+
 // Decode returns an iterator that consumes bytes from a source iterator,
 // unmarshal, and yield data of type T
-func Decode[T any](it Iter) Iter {
+func Decode[T any](it Iter, opts ...DecodeOptFunc) Iter {
+	o := makeDecodeOptions(opts...)
 	dec := json.NewDecoder(etlio.AsReader(it))
+	if o.ErrPolicy == nil {
+		return etl.MakeIter(etl.Custom[T]{
+			Next: func(context.Context) (T, error) {
+				var v T
+				err := dec.Decode(&v)
+				return v, err
+			},
+			Close: it.Close,
+		})
+	}
 	return etl.MakeIter(etl.Custom[T]{
 		Next: func(context.Context) (T, error) {
-			var v T
-			err := dec.Decode(&v)
-			return v, err
+			for {
+				var v T
+				var raw json.RawMessage
+				if err := dec.Decode(&raw); err != nil {
+					return v, err
+				}
+				err := json.Unmarshal(raw, &v)
+				if err == nil {
+					return v, nil
+				}
+				if err := o.ErrPolicy.Handle(raw, err); err != etl.ErrSkip {
+					return v, err
+				}
+			}
 		},
 		Close: it.Close,
 	})
@@ -16,6 +16,7 @@ type perIter struct {
 	name     string
 	count    uint64
 	oldCount uint64
+	retries  uint64
 	units    map[string]uint64
 	done     bool
 }
@@ -99,6 +100,12 @@ func (m *Metrics) add(name string, v any) {
 	*/
 }
 
+func (m *Metrics) retry(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.refs[name].retries++
+}
+
 func (m *Metrics) done(name string) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -135,7 +142,7 @@ func (m *Metrics) Done() {
 	close(m.quit)
 	log.Printf("--- DONE Metrics ---")
 	for _, m := range m.perIter {
-		log.Printf("  [%s] Total processed: %d closed: %v", m.name, m.count, m.done)
+		log.Printf("  [%s] Total processed: %d retries: %d closed: %v", m.name, m.count, m.retries, m.done)
 		for k, v := range m.units {
 			log.Printf("  [%s]   %s: %d", m.name, k, v)
 		}
@@ -172,10 +179,11 @@ func (m *Metrics) spin() {
 				}
 				diff := m.count - m.oldCount
 				m.oldCount = m.count
-				log.Printf("  [%s] Processed: %s (%s/s) closed: %v",
+				log.Printf("  [%s] Processed: %s (%s/s) retries: %d closed: %v",
 					m.name,
 					humanize.Number(uint64(m.count)),
 					humanize.Number(float64(diff)/secs),
+					m.retries,
 					m.done,
 				)
 
@@ -199,3 +207,22 @@ func (m *Metrics) Count(it Iter, name string) Iter {
 		},
 	})
 }
+
+// OnRetry returns a retry option that counts the retries under name.
+//
+//	it := etl.Retry(open, m.OnRetry("http"))
+func (m *Metrics) OnRetry(name string) etl.RetryOptFunc {
+	m.create(name)
+	return etl.WithOnRetry(func(int, error) {
+		m.retry(name)
+	})
+}
+
+// Hook returns a pipeline hook that counts the values of every stage.
+//
+//	p := etl.NewPipeline().Use(m.Hook())
+func (m *Metrics) Hook() etl.StageHook {
+	return func(name string, it Iter) Iter {
+		return m.Count(it, name)
+	}
+}
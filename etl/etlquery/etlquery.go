@@ -0,0 +1,132 @@
+// Package etlquery runs SQL queries over iterators of drow.Row and gframe
+// frames without loading them into a database.
+//
+//	it := etlquery.Query(`
+//		SELECT country, sum(amount) AS total
+//		FROM sales
+//		WHERE status = 'paid'
+//		GROUP BY country
+//		ORDER BY 2 DESC
+//		LIMIT 10`, map[string]etl.Iter{"sales": rows})
+//
+// Queries are compiled to the etl primitives: WHERE and HAVING are filters,
+// the select list is a map, GROUP BY and aggregates use etlutil.Group with
+// the dagg aggregators, JOIN uses etlutil.HashJoin and ORDER BY
+// etldrow.Sort. Queries without GROUP BY and ORDER BY stream, grouping
+// keeps a row per group, joins keep the right table in memory and ordering
+// spills to disk, both past their budgets.
+//
+// The supported syntax is:
+//
+//	SELECT [DISTINCT] * | table.* | expr [[AS] alias], ...
+//	FROM table [[AS] alias]
+//	[[INNER | LEFT [OUTER] | RIGHT [OUTER] | FULL [OUTER]] JOIN table [[AS] alias]
+//		ON a.x = b.y [AND ...]]...
+//	[WHERE cond]
+//	[GROUP BY expr | position | alias, ...]
+//	[HAVING cond]
+//	[ORDER BY expr | position | alias [ASC | DESC], ...]
+//	[LIMIT n] [OFFSET n]
+//
+// Expressions are those of package drow/expr with the SQL spelling: '='
+// and '<>' compare, AND, OR and NOT, 'single quoted' strings, "double
+// quoted" names, '||' concatenates and x [NOT] BETWEEN a AND b. The
+// aggregates are count(*), count(x), count(distinct x), sum, avg, min,
+// max, stddev, variance and median, sum and avg return float64. Strings
+// that hold numbers compare and sort as numbers, as csv columns do, nulls
+// sort last in ascending order.
+//
+// Columns of joined tables are qualified as table.column, names that are
+// unique across the joined tables can be used unqualified, as in the
+// result of *.
+package etlquery
+
+import (
+	"fmt"
+
+	"github.com/stdiopt/danda/drow"
+	"github.com/stdiopt/danda/etl"
+	"github.com/stdiopt/danda/gframe"
+)
+
+// Row is a drow.Row.
+type Row = drow.Row
+
+// Stmt is a compiled query, it can run many times.
+type Stmt struct {
+	sel  *Select
+	plan *plan
+}
+
+// Prepare parses and compiles the query sql.
+func Prepare(sql string) (*Stmt, error) {
+	sel, err := Parse(sql)
+	if err != nil {
+		return nil, err
+	}
+	p, err := newPlan(sel)
+	if err != nil {
+		return nil, err
+	}
+	return &Stmt{sel: sel, plan: p}, nil
+}
+
+// Select returns the parsed statement.
+func (s *Stmt) Select() *Select { return s.sel }
+
+// Tables returns the names of the tables used by the query.
+func (s *Stmt) Tables() []string {
+	names := []string{s.sel.From.Name}
+	for _, j := range s.sel.Joins {
+		names = append(names, j.Table.Name)
+	}
+	return names
+}
+
+// Iter runs the query over the rows of tables, the iterators used by the
+// query are closed when the returned iterator is closed. A table can only
+// be used once since its rows are consumed.
+func (s *Stmt) Iter(tables map[string]etl.Iter) etl.Iter {
+	used := map[string]bool{}
+	return s.plan.iter(func(name string) (etl.Iter, error) {
+		it, ok := tables[name]
+		if !ok {
+			return nil, fmt.Errorf("etlquery: unknown table %q", name)
+		}
+		if used[name] {
+			return nil, fmt.Errorf("etlquery: table %q is used more than once", name)
+		}
+		used[name] = true
+		return it, nil
+	})
+}
+
+// Query runs the query sql over the rows of tables, see Stmt.Iter.
+func Query(sql string, tables map[string]etl.Iter) etl.Iter {
+	s, err := Prepare(sql)
+	if err != nil {
+		for _, it := range tables {
+			it.Close() // nolint: errcheck
+		}
+		return etl.ErrIter(err)
+	}
+	return s.Iter(tables)
+}
+
+// QueryFrame runs the query sql over frames and returns the result as a
+// frame, a frame can be used more than once as in self joins.
+func QueryFrame(sql string, frames map[string]gframe.Frame) gframe.Frame {
+	s, err := Prepare(sql)
+	if err != nil {
+		return gframe.ErrFrame(err)
+	}
+	it := s.plan.iter(func(name string) (etl.Iter, error) {
+		f, ok := frames[name]
+		if !ok {
+			return nil, fmt.Errorf("etlquery: unknown table %q", name)
+		}
+		return f.Iter(), nil
+	})
+	defer it.Close() // nolint: errcheck
+	return gframe.FromIter(it)
+}
@@ -0,0 +1,239 @@
+package etlquery_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stdiopt/danda/drow"
+	"github.com/stdiopt/danda/etl"
+	"github.com/stdiopt/danda/etl/etlquery"
+	"github.com/stdiopt/danda/gframe"
+)
+
+func sales() []drow.Row {
+	row := func(id int, country string, amount any, status string) drow.Row {
+		return drow.Row{
+			drow.F("id", id),
+			drow.F("country", country),
+			drow.F("amount", amount),
+			drow.F("status", status),
+		}
+	}
+	return []drow.Row{
+		row(1, "PT", 10, "paid"),
+		row(2, "ES", 20, "paid"),
+		row(3, "PT", 5, "open"),
+		row(4, "FR", "7.5", "paid"),
+		row(5, "PT", 15, "paid"),
+		row(6, "ES", nil, "paid"),
+	}
+}
+
+func users() []drow.Row {
+	row := func(country, name string) drow.Row {
+		return drow.Row{drow.F("country", country), drow.F("name", name)}
+	}
+	return []drow.Row{row("PT", "Portugal"), row("ES", "Spain"), row("IT", "Italy")}
+}
+
+// csvSales are rows as decoded from csv, all values are strings.
+func csvSales() []drow.Row {
+	row := func(id, amount string) drow.Row {
+		return drow.Row{drow.F("id", id), drow.F("amount", amount)}
+	}
+	return []drow.Row{row("1", "10"), row("2", "9"), row("3", "100"), row("4", "9.5")}
+}
+
+func TestQuery(t *testing.T) {
+	type test struct {
+		sql     string
+		want    []drow.Row
+		wantErr bool
+	}
+	run := func(name string, tt test) {
+		t.Helper()
+		t.Run(name, func(t *testing.T) {
+			it := etlquery.Query(tt.sql, map[string]etl.Iter{
+				"sales":     etl.Values(sales()...),
+				"countries": etl.Values(users()...),
+				"csv":       etl.Values(csvSales()...),
+			})
+			got, err := etl.Collect[drow.Row](it)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("wrong error\nwant: %v\n got: %v", tt.wantErr, err)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("wrong result\nwant: %#v\n got: %#v", tt.want, got)
+			}
+		})
+	}
+
+	run("select where", test{
+		sql: "SELECT id, amount * 2 AS double FROM sales WHERE country = 'PT' AND status <> 'open'",
+		want: []drow.Row{
+			{drow.F[any]("id", int64(1)), drow.F[any]("double", int64(20))},
+			{drow.F[any]("id", int64(5)), drow.F[any]("double", int64(30))},
+		},
+	})
+	run("star limit offset", test{
+		sql:  "select * from sales limit 1 offset 4",
+		want: sales()[4:5],
+	})
+	run("group by order by position", test{
+		sql: `SELECT country, sum(amount), count(*) AS n
+			FROM sales
+			WHERE status = 'paid'
+			GROUP BY country
+			ORDER BY 2 DESC`,
+		want: []drow.Row{
+			{drow.F[any]("country", "PT"), drow.F[any]("sum(amount)", 25.0), drow.F[any]("n", int64(2))},
+			{drow.F[any]("country", "ES"), drow.F[any]("sum(amount)", 20.0), drow.F[any]("n", int64(2))},
+			{drow.F[any]("country", "FR"), drow.F[any]("sum(amount)", 7.5), drow.F[any]("n", int64(1))},
+		},
+	})
+	run("having and hidden order", test{
+		sql: `SELECT country AS c, count(amount) AS n FROM sales
+			GROUP BY c HAVING count(*) > 1 ORDER BY max(id)`,
+		want: []drow.Row{
+			{drow.F[any]("c", "PT"), drow.F[any]("n", int64(3))},
+			{drow.F[any]("c", "ES"), drow.F[any]("n", int64(1))},
+		},
+	})
+	run("aggregate without group by", test{
+		sql: "SELECT count(*) AS n, count(DISTINCT country) AS c, min(id), max(id) FROM sales",
+		want: []drow.Row{
+			{drow.F[any]("n", int64(6)), drow.F[any]("c", int64(3)), drow.F[any]("min(id)", int64(1)), drow.F[any]("max(id)", int64(6))},
+		},
+	})
+	run("aggregate of no rows", test{
+		sql:  "SELECT count(*) AS n, sum(amount) AS s FROM sales WHERE id > 100",
+		want: []drow.Row{{drow.F[any]("n", int64(0)), drow.F[any]("s", nil)}},
+	})
+	run("distinct order by name", test{
+		sql: "SELECT DISTINCT country FROM sales ORDER BY country",
+		want: []drow.Row{
+			{drow.F[any]("country", "ES")},
+			{drow.F[any]("country", "FR")},
+			{drow.F[any]("country", "PT")},
+		},
+	})
+	run("order nulls last", test{
+		sql: "SELECT id FROM sales WHERE country = 'ES' ORDER BY amount, id DESC",
+		want: []drow.Row{
+			{drow.F[any]("id", int64(2))},
+			{drow.F[any]("id", int64(6))},
+		},
+	})
+	run("inner join", test{
+		sql: `SELECT s.id, c.name FROM sales s JOIN countries c ON s.country = c.country
+			WHERE amount BETWEEN 10 AND 15 ORDER BY s.id`,
+		want: []drow.Row{
+			{drow.F[any]("id", int64(1)), drow.F[any]("name", "Portugal")},
+			{drow.F[any]("id", int64(5)), drow.F[any]("name", "Portugal")},
+		},
+	})
+	run("left join group", test{
+		sql: `SELECT c.name, count(s.id) AS n FROM countries c
+			LEFT JOIN sales s ON c.country = s.country
+			GROUP BY c.name ORDER BY n DESC, name`,
+		want: []drow.Row{
+			{drow.F[any]("name", "Portugal"), drow.F[any]("n", int64(3))},
+			{drow.F[any]("name", "Spain"), drow.F[any]("n", int64(2))},
+			{drow.F[any]("name", "Italy"), drow.F[any]("n", int64(0))},
+		},
+	})
+	run("join star", test{
+		sql: "SELECT * FROM countries c JOIN sales s ON c.country = s.country WHERE id = 2",
+		want: []drow.Row{{
+			drow.F[any]("c.country", "ES"),
+			drow.F[any]("name", "Spain"),
+			drow.F[any]("id", 2),
+			drow.F[any]("s.country", "ES"),
+			drow.F[any]("amount", 20),
+			drow.F[any]("status", "paid"),
+		}},
+	})
+
+	run("string numbers", test{
+		sql: "SELECT id, amount + 1 AS next FROM csv WHERE amount > 9 ORDER BY amount + 0 DESC",
+		want: []drow.Row{
+			{drow.F[any]("id", "3"), drow.F[any]("next", int64(101))},
+			{drow.F[any]("id", "1"), drow.F[any]("next", int64(11))},
+			{drow.F[any]("id", "4"), drow.F[any]("next", 10.5)},
+		},
+	})
+	run("string numbers order lexically", test{
+		sql: "SELECT id FROM csv WHERE amount > 9 ORDER BY amount DESC",
+		want: []drow.Row{
+			{drow.F[any]("id", "4")},
+			{drow.F[any]("id", "3")},
+			{drow.F[any]("id", "1")},
+		},
+	})
+	run("syntax error", test{sql: "SELECT FROM sales", wantErr: true})
+	run("unknown table", test{sql: "SELECT * FROM nope", wantErr: true})
+	run("column not grouped", test{sql: "SELECT id, count(*) FROM sales", wantErr: true})
+	run("aggregate in where", test{sql: "SELECT id FROM sales WHERE sum(id) > 1", wantErr: true})
+	run("join non equality", test{
+		sql:     "SELECT * FROM sales s JOIN countries c ON s.id > 1",
+		wantErr: true,
+	})
+	run("eval error", test{sql: "SELECT int(status) FROM sales", wantErr: true})
+}
+
+func TestParse(t *testing.T) {
+	sel, err := etlquery.Parse(`select distinct a.x as "first name", count(distinct b.y)
+		from t1 a left outer join t2 as b on a.id = b.id and a.k = b.k
+		where x not in (1, 2) and y is not null or z || 'a' = 'ba' -- comment
+		group by 1 having count(*) > 1 order by 2 desc, x limit 10 offset 5;`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sel.Distinct || len(sel.Columns) != 2 || sel.Columns[0].Alias != "first name" {
+		t.Errorf("wrong columns: %+v", sel.Columns)
+	}
+	if got := sel.Columns[1].X.String(); got != "count_distinct(b.y)" {
+		t.Errorf("wrong aggregate: %s", got)
+	}
+	if sel.From != (etlquery.Table{Name: "t1", Alias: "a"}) || len(sel.Joins) != 1 ||
+		sel.Joins[0].Table.Ref() != "b" {
+		t.Errorf("wrong tables: %+v %+v", sel.From, sel.Joins)
+	}
+	want := `((x not in (1, 2) && y is not null) || (concat(z, "a") == "ba"))`
+	if got := sel.Where.String(); got != want {
+		t.Errorf("wrong where\nwant: %s\n got: %s", want, got)
+	}
+	if len(sel.OrderBy) != 2 || !sel.OrderBy[0].Desc || sel.OrderBy[1].Desc ||
+		sel.Limit != 10 || sel.Offset != 5 {
+		t.Errorf("wrong order/limit: %+v %d %d", sel.OrderBy, sel.Limit, sel.Offset)
+	}
+
+	for _, sql := range []string{
+		"select a from",
+		"select a from t where",
+		"select 'a from t",
+		"select a from t limit x",
+		"select sum(distinct a) from t",
+	} {
+		if _, err := etlquery.Parse(sql); err == nil {
+			t.Errorf("%q: expected error", sql)
+		}
+	}
+}
+
+func TestQueryFrame(t *testing.T) {
+	f := gframe.FromRows(sales())
+	got := etlquery.QueryFrame(`SELECT a.id, b.id AS other FROM s a
+		JOIN s b ON a.amount = b.amount
+		WHERE a.id < b.id OR a.id = 1 ORDER BY a.id`, map[string]gframe.Frame{"s": f})
+	if err := got.Err(); err != nil {
+		t.Fatal(err)
+	}
+	want := []drow.Row{{drow.F("id", int64(1)), drow.F("other", int64(1))}}
+	if !reflect.DeepEqual(got.Rows(), want) {
+		t.Errorf("wrong result\nwant: %v\n got: %v", want, got.Rows())
+	}
+}
@@ -0,0 +1,747 @@
+package etlquery
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/stdiopt/danda/drow"
+	"github.com/stdiopt/danda/drow/expr"
+	"github.com/stdiopt/danda/etl/etlutil"
+)
+
+// Select is a parsed SELECT statement, expressions use the drow/expr
+// syntax tree.
+type Select struct {
+	Distinct bool
+	Columns  []Column
+	From     Table
+	Joins    []Join
+	Where    expr.Node
+	GroupBy  []expr.Node
+	Having   expr.Node
+	OrderBy  []Order
+	Limit    int // -1 without LIMIT
+	Offset   int
+}
+
+// Column is a column of the select list.
+type Column struct {
+	X     expr.Node // nil for * and table.*
+	Table string    // table of table.*
+	Alias string
+	Text  string // source text, names columns without alias
+}
+
+// Table is a table in FROM or JOIN.
+type Table struct {
+	Name  string
+	Alias string
+}
+
+// Ref returns the name used to qualify columns of the table.
+func (t Table) Ref() string {
+	if t.Alias != "" {
+		return t.Alias
+	}
+	return t.Name
+}
+
+// Join is a JOIN clause, On holds the equality conditions.
+type Join struct {
+	Kind  etlutil.JoinKind
+	Table Table
+	On    expr.Node
+}
+
+// Order is an ORDER BY item.
+type Order struct {
+	X    expr.Node
+	Desc bool
+}
+
+// SyntaxError is returned by Parse when the query is not valid.
+type SyntaxError struct {
+	Pos int // byte offset in the query
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("etlquery: %s at position %d", e.Msg, e.Pos)
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokString
+	tokIdent
+	tokQuotedIdent
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+	end  int
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "end of query"
+	}
+	return strconv.Quote(t.text)
+}
+
+var keywords = map[string]struct{}{
+	"select": {}, "distinct": {}, "from": {}, "as": {}, "join": {},
+	"inner": {}, "left": {}, "right": {}, "full": {}, "outer": {}, "on": {},
+	"where": {}, "group": {}, "by": {}, "having": {}, "order": {}, "asc": {},
+	"desc": {}, "limit": {}, "offset": {}, "and": {}, "or": {}, "not": {},
+	"in": {}, "is": {}, "null": {}, "true": {}, "false": {}, "between": {},
+}
+
+func isKeyword(s string) bool {
+	_, ok := keywords[strings.ToLower(s)]
+	return ok
+}
+
+func isIdentRune(r rune, first bool) bool {
+	return r == '_' || unicode.IsLetter(r) || !first && unicode.IsDigit(r)
+}
+
+// operators sorted by length so the longest matches first.
+var operators = []string{
+	"<>", "!=", "==", "<=", ">=", "||",
+	"=", "<", ">", "+", "-", "*", "/", "%", "(", ")", ",", ".", ";",
+}
+
+func lex(src string) ([]token, error) {
+	var toks []token
+	for i := 0; i < len(src); {
+		r, size := utf8.DecodeRuneInString(src[i:])
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+		case strings.HasPrefix(src[i:], "--"):
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case r >= '0' && r <= '9':
+			start := i
+			for i < len(src) && (isDigit(src[i]) || src[i] == '.') {
+				i++
+			}
+			if i < len(src) && (src[i] == 'e' || src[i] == 'E') {
+				i++
+				if i < len(src) && (src[i] == '+' || src[i] == '-') {
+					i++
+				}
+				for i < len(src) && isDigit(src[i]) {
+					i++
+				}
+			}
+			toks = append(toks, token{tokNumber, src[start:i], start, i})
+		case r == '\'':
+			s, n, ok := lexQuoted(src[i:])
+			if !ok {
+				return nil, &SyntaxError{Pos: i, Msg: "unterminated string"}
+			}
+			toks = append(toks, token{tokString, s, i, i + n})
+			i += n
+		case r == '"' || r == '`':
+			s, n, ok := lexQuoted(src[i:])
+			if !ok {
+				return nil, &SyntaxError{Pos: i, Msg: "unterminated quoted name"}
+			}
+			toks = append(toks, token{tokQuotedIdent, s, i, i + n})
+			i += n
+		case isIdentRune(r, true):
+			start := i
+			for i < len(src) {
+				r, size := utf8.DecodeRuneInString(src[i:])
+				if !isIdentRune(r, false) {
+					break
+				}
+				i += size
+			}
+			toks = append(toks, token{tokIdent, src[start:i], start, i})
+		default:
+			op := ""
+			for _, o := range operators {
+				if strings.HasPrefix(src[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return nil, &SyntaxError{Pos: i, Msg: fmt.Sprintf("unexpected character %q", r)}
+			}
+			toks = append(toks, token{tokOp, op, i, i + len(op)})
+			i += len(op)
+		}
+	}
+	return append(toks, token{tokEOF, "", len(src), len(src)}), nil
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+// lexQuoted reads a string quoted by the first byte of s, the quote is
+// escaped by doubling it.
+func lexQuoted(s string) (string, int, bool) {
+	q := s[0]
+	sb := &strings.Builder{}
+	for i := 1; i < len(s); i++ {
+		if s[i] != q {
+			sb.WriteByte(s[i])
+			continue
+		}
+		if i+1 < len(s) && s[i+1] == q {
+			sb.WriteByte(q)
+			i++
+			continue
+		}
+		return sb.String(), i + 1, true
+	}
+	return "", 0, false
+}
+
+// Parse parses a SELECT statement.
+func Parse(sql string) (*Select, error) {
+	toks, err := lex(sql)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{src: sql, toks: toks}
+	sel, err := p.selectStmt()
+	if err != nil {
+		return nil, err
+	}
+	if p.is(";") {
+		p.next()
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, p.errorf(t, "unexpected %s", t)
+	}
+	return sel, nil
+}
+
+type parser struct {
+	src  string
+	toks []token
+	i    int
+}
+
+func (p *parser) peek() token { return p.toks[p.i] }
+
+func (p *parser) next() token {
+	t := p.toks[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+// is reports if the current token is the op or keyword s.
+func (p *parser) is(s ...string) bool {
+	t := p.peek()
+	for _, s := range s {
+		switch t.kind {
+		case tokOp:
+			if t.text == s {
+				return true
+			}
+		case tokIdent:
+			if strings.EqualFold(t.text, s) && isKeyword(s) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// accept consumes the keywords or ops s if they are next in sequence.
+func (p *parser) accept(s ...string) bool {
+	for i, s := range s {
+		if p.i+i >= len(p.toks) {
+			return false
+		}
+		save := p.i
+		p.i += i
+		ok := p.is(s)
+		p.i = save
+		if !ok {
+			return false
+		}
+	}
+	p.i += len(s)
+	return true
+}
+
+func (p *parser) expect(s ...string) error {
+	if !p.accept(s...) {
+		t := p.peek()
+		return p.errorf(t, "expected %q, found %s", strings.ToUpper(strings.Join(s, " ")), t)
+	}
+	return nil
+}
+
+func (p *parser) errorf(t token, format string, args ...any) error {
+	return &SyntaxError{Pos: t.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+// name parses an identifier that is not a keyword or a quoted identifier.
+func (p *parser) name(what string) (string, error) {
+	t := p.peek()
+	if t.kind == tokQuotedIdent || t.kind == tokIdent && !isKeyword(t.text) {
+		p.next()
+		return t.text, nil
+	}
+	return "", p.errorf(t, "expected %s, found %s", what, t)
+}
+
+// alias parses an optional [AS] alias.
+func (p *parser) alias() (string, error) {
+	if p.accept("as") {
+		return p.name("alias")
+	}
+	if t := p.peek(); t.kind == tokQuotedIdent || t.kind == tokIdent && !isKeyword(t.text) {
+		p.next()
+		return t.text, nil
+	}
+	return "", nil
+}
+
+func (p *parser) selectStmt() (*Select, error) {
+	if err := p.expect("select"); err != nil {
+		return nil, err
+	}
+	sel := &Select{Limit: -1}
+	sel.Distinct = p.accept("distinct")
+	for {
+		c, err := p.column()
+		if err != nil {
+			return nil, err
+		}
+		sel.Columns = append(sel.Columns, c)
+		if !p.accept(",") {
+			break
+		}
+	}
+
+	if err := p.expect("from"); err != nil {
+		return nil, err
+	}
+	var err error
+	if sel.From, err = p.table(); err != nil {
+		return nil, err
+	}
+	for {
+		j, ok, err := p.join()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		sel.Joins = append(sel.Joins, j)
+	}
+
+	if p.accept("where") {
+		if sel.Where, err = p.expr(); err != nil {
+			return nil, err
+		}
+	}
+	if p.accept("group", "by") {
+		if sel.GroupBy, err = p.exprList(); err != nil {
+			return nil, err
+		}
+	}
+	if p.accept("having") {
+		if sel.Having, err = p.expr(); err != nil {
+			return nil, err
+		}
+	}
+	if p.accept("order", "by") {
+		for {
+			x, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			o := Order{X: x}
+			if p.accept("desc") {
+				o.Desc = true
+			} else {
+				p.accept("asc")
+			}
+			sel.OrderBy = append(sel.OrderBy, o)
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+	if p.accept("limit") {
+		if sel.Limit, err = p.count("LIMIT"); err != nil {
+			return nil, err
+		}
+	}
+	if p.accept("offset") {
+		if sel.Offset, err = p.count("OFFSET"); err != nil {
+			return nil, err
+		}
+	}
+	return sel, nil
+}
+
+func (p *parser) column() (Column, error) {
+	start := p.peek()
+	if p.accept("*") {
+		return Column{Text: "*"}, nil
+	}
+	if t := p.peek(); t.kind == tokIdent || t.kind == tokQuotedIdent {
+		if p.i+2 < len(p.toks) && p.toks[p.i+1].text == "." &&
+			p.toks[p.i+2].kind == tokOp && p.toks[p.i+2].text == "*" {
+			p.i += 3
+			return Column{Table: t.text, Text: t.text + ".*"}, nil
+		}
+	}
+	x, err := p.expr()
+	if err != nil {
+		return Column{}, err
+	}
+	end := p.toks[p.i-1].end
+	alias, err := p.alias()
+	if err != nil {
+		return Column{}, err
+	}
+	return Column{X: x, Alias: alias, Text: p.src[start.pos:end]}, nil
+}
+
+func (p *parser) table() (Table, error) {
+	name, err := p.name("table name")
+	if err != nil {
+		return Table{}, err
+	}
+	alias, err := p.alias()
+	if err != nil {
+		return Table{}, err
+	}
+	return Table{Name: name, Alias: alias}, nil
+}
+
+func (p *parser) join() (Join, bool, error) {
+	var kind etlutil.JoinKind
+	switch {
+	case p.accept("join"), p.accept("inner", "join"):
+		kind = etlutil.JoinInner
+	case p.accept("left", "join"), p.accept("left", "outer", "join"):
+		kind = etlutil.JoinLeft
+	case p.accept("right", "join"), p.accept("right", "outer", "join"):
+		kind = etlutil.JoinRight
+	case p.accept("full", "join"), p.accept("full", "outer", "join"):
+		kind = etlutil.JoinOuter
+	default:
+		return Join{}, false, nil
+	}
+	t, err := p.table()
+	if err != nil {
+		return Join{}, false, err
+	}
+	if err := p.expect("on"); err != nil {
+		return Join{}, false, err
+	}
+	on, err := p.expr()
+	if err != nil {
+		return Join{}, false, err
+	}
+	return Join{Kind: kind, Table: t, On: on}, true, nil
+}
+
+func (p *parser) count(what string) (int, error) {
+	t := p.next()
+	n, err := strconv.Atoi(t.text)
+	if t.kind != tokNumber || err != nil || n < 0 {
+		return 0, p.errorf(t, "expected %s count, found %s", what, t)
+	}
+	return n, nil
+}
+
+func (p *parser) exprList() ([]expr.Node, error) {
+	var list []expr.Node
+	for {
+		x, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, x)
+		if !p.accept(",") {
+			return list, nil
+		}
+	}
+}
+
+func (p *parser) expr() (expr.Node, error) {
+	return p.or()
+}
+
+func (p *parser) or() (expr.Node, error) {
+	x, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("or") {
+		y, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		x = expr.Binary{Op: "||", X: x, Y: y}
+	}
+	return x, nil
+}
+
+func (p *parser) and() (expr.Node, error) {
+	x, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("and") {
+		y, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		x = expr.Binary{Op: "&&", X: x, Y: y}
+	}
+	return x, nil
+}
+
+func (p *parser) not() (expr.Node, error) {
+	if p.accept("not") {
+		x, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return expr.Unary{Op: "not", X: x}, nil
+	}
+	return p.comparison()
+}
+
+func (p *parser) comparison() (expr.Node, error) {
+	x, err := p.additive()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case p.is("=", "==", "<>", "!=", "<", "<=", ">", ">="):
+		op := p.next().text
+		switch op {
+		case "=":
+			op = "=="
+		case "<>":
+			op = "!="
+		}
+		y, err := p.additive()
+		if err != nil {
+			return nil, err
+		}
+		return expr.Binary{Op: op, X: x, Y: y}, nil
+	case p.is("in", "not", "between"):
+		return p.membership(x)
+	case p.accept("is"):
+		not := p.accept("not")
+		if err := p.expect("null"); err != nil {
+			return nil, err
+		}
+		return expr.IsNull{X: x, Not: not}, nil
+	}
+	return x, nil
+}
+
+// membership parses [NOT] IN (list) and [NOT] BETWEEN lo AND hi after x.
+func (p *parser) membership(x expr.Node) (expr.Node, error) {
+	not := p.accept("not")
+	switch {
+	case p.accept("in"):
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		list, err := p.exprList()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return expr.In{X: x, List: list, Not: not}, nil
+	case p.accept("between"):
+		lo, err := p.additive()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("and"); err != nil {
+			return nil, err
+		}
+		hi, err := p.additive()
+		if err != nil {
+			return nil, err
+		}
+		var n expr.Node = expr.Binary{
+			Op: "&&",
+			X:  expr.Binary{Op: ">=", X: x, Y: lo},
+			Y:  expr.Binary{Op: "<=", X: x, Y: hi},
+		}
+		if not {
+			n = expr.Unary{Op: "not", X: n}
+		}
+		return n, nil
+	}
+	t := p.peek()
+	return nil, p.errorf(t, "expected \"IN\" or \"BETWEEN\", found %s", t)
+}
+
+func (p *parser) additive() (expr.Node, error) {
+	x, err := p.multiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for p.is("+", "-", "||") {
+		op := p.next().text
+		y, err := p.multiplicative()
+		if err != nil {
+			return nil, err
+		}
+		if op == "||" {
+			x = expr.Call{Name: "concat", Args: []expr.Node{x, y}}
+			continue
+		}
+		x = expr.Binary{Op: op, X: x, Y: y}
+	}
+	return x, nil
+}
+
+func (p *parser) multiplicative() (expr.Node, error) {
+	x, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.is("*", "/", "%") {
+		op := p.next().text
+		y, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		x = expr.Binary{Op: op, X: x, Y: y}
+	}
+	return x, nil
+}
+
+func (p *parser) unary() (expr.Node, error) {
+	if p.is("-") {
+		p.next()
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		if lit, ok := x.(expr.Literal); ok {
+			switch v := lit.Value.(type) {
+			case int64:
+				return expr.Literal{Value: -v}, nil
+			case float64:
+				return expr.Literal{Value: -v}, nil
+			}
+		}
+		return expr.Unary{Op: "-", X: x}, nil
+	}
+	return p.primary()
+}
+
+func (p *parser) primary() (expr.Node, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		if n, err := strconv.ParseInt(t.text, 10, 64); err == nil {
+			return expr.Literal{Value: n}, nil
+		}
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, p.errorf(t, "invalid number %s", t)
+		}
+		return expr.Literal{Value: f}, nil
+	case tokString:
+		return expr.Literal{Value: t.text}, nil
+	case tokQuotedIdent:
+		return p.path(t.text)
+	case tokIdent:
+		switch strings.ToLower(t.text) {
+		case "null":
+			return expr.Literal{}, nil
+		case "true":
+			return expr.Literal{Value: true}, nil
+		case "false":
+			return expr.Literal{Value: false}, nil
+		}
+		if isKeyword(t.text) {
+			return nil, p.errorf(t, "unexpected keyword %s", t)
+		}
+		if p.accept("(") {
+			return p.call(strings.ToLower(t.text))
+		}
+		return p.path(t.text)
+	case tokOp:
+		if t.text == "(" {
+			x, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return x, nil
+		}
+	}
+	return nil, p.errorf(t, "unexpected %s", t)
+}
+
+// call parses the arguments of the function name after the '(', count(*)
+// has no arguments and count(distinct x) is parsed as count_distinct(x).
+func (p *parser) call(name string) (expr.Node, error) {
+	c := expr.Call{Name: name}
+	switch {
+	case p.accept(")"):
+		return c, nil
+	case name == "count" && p.accept("*", ")"):
+		return c, nil
+	case p.is("distinct"):
+		t := p.next()
+		if name != "count" {
+			return nil, p.errorf(t, "DISTINCT is only supported in count")
+		}
+		c.Name = "count_distinct"
+	}
+	args, err := p.exprList()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	c.Args = args
+	return c, nil
+}
+
+// path parses the '.name' after a name, the first name can be a table.
+func (p *parser) path(name string) (expr.Node, error) {
+	path := []drow.IntOrString{name}
+	for p.is(".") {
+		p.next()
+		t := p.next()
+		if t.kind != tokIdent && t.kind != tokQuotedIdent {
+			return nil, p.errorf(t, "expected column name, found %s", t)
+		}
+		path = append(path, t.text)
+	}
+	return expr.Field{Path: path}, nil
+}
@@ -0,0 +1,545 @@
+package etlquery
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/stdiopt/danda/drow"
+	"github.com/stdiopt/danda/drow/expr"
+	"github.com/stdiopt/danda/etl/etlutil"
+	"github.com/stdiopt/danda/util/dagg"
+)
+
+// aggregates maps the aggregate functions to the dagg aggregators, fn is nil
+// for count(*).
+var aggregates = map[string]func(name string, fn func(Row) any) dagg.OptFn[Row]{
+	"count":          dagg.Count[Row],
+	"count_distinct": dagg.CountDistinct[Row],
+	"sum":            dagg.Sum[Row],
+	"avg":            dagg.Mean[Row],
+	"min":            dagg.Min[Row],
+	"max":            dagg.Max[Row],
+	"stddev":         dagg.StdDev[Row],
+	"variance":       dagg.Variance[Row],
+	"median":         dagg.Median[Row],
+}
+
+// Names of the internal fields, grouped rows hold the group keys and the
+// aggregates, projected rows hold the ORDER BY values that aren't columns.
+func keyField(i int) string   { return fmt.Sprintf("#key%d", i) }
+func aggField(i int) string   { return fmt.Sprintf("#agg%d", i) }
+func orderField(i int) string { return fmt.Sprintf("#ord%d", i) }
+
+// plan is a compiled Select, it holds no state of a run so it can run many
+// times.
+type plan struct {
+	sel    *Select
+	refs   []string // table refs in FROM and JOIN order
+	joins  []joinPlan
+	where  *expr.Expr
+	group  *groupPlan
+	having *expr.Expr
+	cols   []colPlan
+	orders []orderPlan
+	hidden int // number of order fields appended to the columns
+}
+
+type joinPlan struct {
+	kind         etlutil.JoinKind
+	lkeys, rkeys []*expr.Expr
+}
+
+type groupPlan struct {
+	keys    []*expr.Expr
+	keyText []string
+	aggs    []aggPlan
+	aggText []string
+}
+
+type aggPlan struct {
+	fn  string
+	arg *expr.Expr // nil for count(*)
+}
+
+type colPlan struct {
+	x     *expr.Expr // nil for stars
+	table string     // ref of table.*
+	name  string
+}
+
+type orderPlan struct {
+	index int        // output column, -1 if not by position
+	name  string     // output or order field
+	x     *expr.Expr // value of the order field
+	desc  bool
+}
+
+func newPlan(sel *Select) (*plan, error) {
+	p := &plan{sel: sel}
+	tables := []Table{sel.From}
+	for _, j := range sel.Joins {
+		tables = append(tables, j.Table)
+	}
+	for _, t := range tables {
+		if p.isRef(t.Ref()) {
+			return nil, fmt.Errorf("etlquery: table %q specified more than once", t.Ref())
+		}
+		p.refs = append(p.refs, t.Ref())
+	}
+	for i, j := range sel.Joins {
+		jp, err := p.joinPlan(i, j)
+		if err != nil {
+			return nil, err
+		}
+		p.joins = append(p.joins, jp)
+	}
+
+	// resolve the columns before GROUP BY which can refer to them
+	cols := make([]expr.Node, len(sel.Columns))
+	for i, c := range sel.Columns {
+		if c.X == nil {
+			continue
+		}
+		var err error
+		if cols[i], err = p.resolve(c.X); err != nil {
+			return nil, err
+		}
+	}
+
+	if sel.Where != nil {
+		where, err := p.resolve(sel.Where)
+		if err != nil {
+			return nil, err
+		}
+		if hasAggregate(where) {
+			return nil, fmt.Errorf("etlquery: aggregate functions are not allowed in WHERE")
+		}
+		if p.where, err = expr.CompileNode(where); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := p.groupBy(cols); err != nil {
+		return nil, err
+	}
+	if err := p.columns(cols); err != nil {
+		return nil, err
+	}
+	if sel.Having != nil {
+		having, err := p.compile(sel.Having)
+		if err != nil {
+			return nil, err
+		}
+		p.having = having
+	}
+	if err := p.orderBy(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *plan) isRef(ref string) bool {
+	return contains(p.refs, ref)
+}
+
+// split splits the qualified name of a joined row in table ref and column.
+func (p *plan) split(name string) (string, string, bool) {
+	for _, ref := range p.refs {
+		if strings.HasPrefix(name, ref+".") {
+			return ref, name[len(ref)+1:], true
+		}
+	}
+	return "", "", false
+}
+
+// resolve rewrites the columns qualified with a table, single table queries
+// drop the table and joined rows use "table.column" fields.
+func (p *plan) resolve(n expr.Node) (expr.Node, error) {
+	return rewrite(n, func(n expr.Node) (expr.Node, bool, error) {
+		f, ok := n.(expr.Field)
+		if !ok {
+			return n, false, nil
+		}
+		ref, _ := f.Path[0].(string)
+		if len(f.Path) < 2 || !p.isRef(ref) {
+			return n, true, nil
+		}
+		if len(p.refs) == 1 {
+			return expr.Field{Path: f.Path[1:]}, true, nil
+		}
+		path := []drow.IntOrString{fmt.Sprintf("%s.%v", ref, f.Path[1])}
+		return expr.Field{Path: append(path, f.Path[2:]...)}, true, nil
+	})
+}
+
+// compile resolves n, rewrites it for grouped rows and compiles it.
+func (p *plan) compile(n expr.Node) (*expr.Expr, error) {
+	n, err := p.resolve(n)
+	if err != nil {
+		return nil, err
+	}
+	if p.group != nil {
+		if n, err = p.grouped(n); err != nil {
+			return nil, err
+		}
+	}
+	return expr.CompileNode(n)
+}
+
+// joinPlan splits the ON condition of the join i in the key expressions of
+// each side.
+func (p *plan) joinPlan(i int, j Join) (joinPlan, error) {
+	jp := joinPlan{kind: j.Kind}
+	right := j.Table.Ref()
+	for _, term := range conjunction(j.On) {
+		b, ok := term.(expr.Binary)
+		if !ok || b.Op != "==" {
+			return jp, fmt.Errorf("etlquery: JOIN %s: only equality conditions joined by AND are supported", right)
+		}
+		xs, err := p.joinSide(b.X, i, right)
+		if err != nil {
+			return jp, err
+		}
+		ys, err := p.joinSide(b.Y, i, right)
+		if err != nil {
+			return jp, err
+		}
+		if xs == ys {
+			return jp, fmt.Errorf("etlquery: JOIN %s: %s must compare columns of both sides", right, term)
+		}
+		l, r := b.X, b.Y
+		if xs == 1 {
+			l, r = r, l
+		}
+		lk, err := p.compile(l)
+		if err != nil {
+			return jp, err
+		}
+		rk, err := p.compile(r)
+		if err != nil {
+			return jp, err
+		}
+		jp.lkeys = append(jp.lkeys, lk)
+		jp.rkeys = append(jp.rkeys, rk)
+	}
+	return jp, nil
+}
+
+// joinSide returns 0 if n uses columns of the tables before the join i and
+// 1 if it uses columns of the joined table.
+func (p *plan) joinSide(x expr.Node, i int, right string) (int, error) {
+	side := -1
+	_, err := rewrite(x, func(n expr.Node) (expr.Node, bool, error) {
+		f, ok := n.(expr.Field)
+		if !ok {
+			return n, false, nil
+		}
+		ref, _ := f.Path[0].(string)
+		s := -1
+		if len(f.Path) > 1 {
+			switch {
+			case ref == right:
+				s = 1
+			case contains(p.refs[:i+1], ref):
+				s = 0
+			}
+		}
+		switch {
+		case s < 0:
+			return nil, true, fmt.Errorf("etlquery: JOIN %s: column %s must be qualified with a joined table", right, f)
+		case side >= 0 && side != s:
+			return nil, true, fmt.Errorf("etlquery: JOIN %s: %s uses columns of both sides", right, x)
+		}
+		side = s
+		return n, true, nil
+	})
+	if err == nil && side < 0 {
+		err = fmt.Errorf("etlquery: JOIN %s: %s doesn't use any column", right, x)
+	}
+	return side, err
+}
+
+// groupBy sets the group plan if the query has GROUP BY or aggregates, the
+// keys can be select positions or aliases.
+func (p *plan) groupBy(cols []expr.Node) error {
+	sel := p.sel
+	aggregated := len(sel.GroupBy) > 0 || sel.Having != nil
+	for _, c := range cols {
+		aggregated = aggregated || c != nil && hasAggregate(c)
+	}
+	for _, o := range sel.OrderBy {
+		aggregated = aggregated || hasAggregate(o.X)
+	}
+	if !aggregated {
+		return nil
+	}
+
+	g := &groupPlan{}
+	for _, n := range sel.GroupBy {
+		var key expr.Node
+		switch x := n.(type) {
+		case expr.Literal:
+			i, ok := x.Value.(int64)
+			if !ok || i < 1 || int(i) > len(cols) || cols[i-1] == nil {
+				return fmt.Errorf("etlquery: GROUP BY position %s is not in select list", x)
+			}
+			key = cols[i-1]
+		case expr.Field:
+			for ci, c := range sel.Columns {
+				if len(x.Path) == 1 && c.Alias != "" && c.Alias == x.Path[0] {
+					key = cols[ci]
+				}
+			}
+		}
+		if key == nil {
+			var err error
+			if key, err = p.resolve(n); err != nil {
+				return err
+			}
+		}
+		if hasAggregate(key) {
+			return fmt.Errorf("etlquery: aggregate functions are not allowed in GROUP BY")
+		}
+		e, err := expr.CompileNode(key)
+		if err != nil {
+			return err
+		}
+		g.keys = append(g.keys, e)
+		g.keyText = append(g.keyText, key.String())
+	}
+	p.group = g
+	return nil
+}
+
+// grouped rewrites n to use the fields of grouped rows, group keys and
+// aggregate calls are replaced by their fields.
+func (p *plan) grouped(n expr.Node) (expr.Node, error) {
+	g := p.group
+	return rewrite(n, func(n expr.Node) (expr.Node, bool, error) {
+		s := n.String()
+		for i, k := range g.keyText {
+			if s == k {
+				return expr.Field{Path: []drow.IntOrString{keyField(i)}}, true, nil
+			}
+		}
+		if c, ok := aggregateCall(n); ok {
+			i := -1
+			for ai, a := range g.aggText {
+				if a == s {
+					i = ai
+				}
+			}
+			if i < 0 {
+				a, err := newAggregate(c)
+				if err != nil {
+					return nil, true, err
+				}
+				i = len(g.aggs)
+				g.aggs = append(g.aggs, a)
+				g.aggText = append(g.aggText, s)
+			}
+			return expr.Field{Path: []drow.IntOrString{aggField(i)}}, true, nil
+		}
+		if f, ok := n.(expr.Field); ok {
+			return nil, true, fmt.Errorf("etlquery: column %s must appear in GROUP BY or be used in an aggregate function", f)
+		}
+		return n, false, nil
+	})
+}
+
+func newAggregate(c expr.Call) (aggPlan, error) {
+	a := aggPlan{fn: c.Name}
+	if c.Name == "count" && len(c.Args) == 0 {
+		return a, nil
+	}
+	if len(c.Args) != 1 {
+		return a, fmt.Errorf("etlquery: %s: expected 1 argument, got %d", c.Name, len(c.Args))
+	}
+	if hasAggregate(c.Args[0]) {
+		return a, fmt.Errorf("etlquery: %s: aggregate function calls cannot be nested", c)
+	}
+	var err error
+	a.arg, err = expr.CompileNode(c.Args[0])
+	return a, err
+}
+
+func (p *plan) columns(cols []expr.Node) error {
+	used := map[string]bool{}
+	for i, c := range p.sel.Columns {
+		if c.X == nil {
+			if p.group != nil {
+				return fmt.Errorf("etlquery: %s is not allowed in aggregate queries", c.Text)
+			}
+			if c.Table != "" && !p.isRef(c.Table) {
+				return fmt.Errorf("etlquery: unknown table %q in %s", c.Table, c.Text)
+			}
+			p.cols = append(p.cols, colPlan{table: c.Table})
+			continue
+		}
+		x := cols[i]
+		if p.group != nil {
+			var err error
+			if x, err = p.grouped(x); err != nil {
+				return err
+			}
+		}
+		e, err := expr.CompileNode(x)
+		if err != nil {
+			return err
+		}
+		name := c.Alias
+		if name == "" {
+			name = c.Text
+			if f, ok := c.X.(expr.Field); ok {
+				name = fmt.Sprint(f.Path[len(f.Path)-1])
+			}
+			// qualified columns of different tables can share the name
+			if used[name] {
+				name = c.Text
+			}
+		}
+		for n, base := 2, name; used[name]; n++ {
+			name = fmt.Sprintf("%s_%d", base, n)
+		}
+		used[name] = true
+		p.cols = append(p.cols, colPlan{x: e, name: name})
+	}
+	return nil
+}
+
+// orderBy plans the ORDER BY items, positions and column names sort by the
+// output column, other expressions by an order field.
+func (p *plan) orderBy() error {
+	stars := false
+	for _, c := range p.cols {
+		stars = stars || c.x == nil
+	}
+	for _, o := range p.sel.OrderBy {
+		op := orderPlan{index: -1, desc: o.Desc}
+		switch x := o.X.(type) {
+		case expr.Literal:
+			if i, ok := x.Value.(int64); ok {
+				if i < 1 || !stars && int(i) > len(p.cols) {
+					return fmt.Errorf("etlquery: ORDER BY position %d is not in select list", i)
+				}
+				op.index = int(i - 1)
+			}
+		case expr.Field:
+			for _, c := range p.cols {
+				if len(x.Path) == 1 && c.x != nil && c.name == x.Path[0] {
+					op.name = c.name
+				}
+			}
+		}
+		if op.index < 0 && op.name == "" {
+			if p.sel.Distinct {
+				return fmt.Errorf("etlquery: for SELECT DISTINCT, ORDER BY %s must appear in select list", o.X)
+			}
+			var err error
+			if op.x, err = p.compile(o.X); err != nil {
+				return err
+			}
+			op.name = orderField(p.hidden)
+			p.hidden++
+		}
+		p.orders = append(p.orders, op)
+	}
+	return nil
+}
+
+// rewrite returns n with its nodes replaced by fn, fn returns the
+// replacement and true to skip the children of the node.
+func rewrite(n expr.Node, fn func(expr.Node) (expr.Node, bool, error)) (expr.Node, error) {
+	r, skip, err := fn(n)
+	if err != nil || skip {
+		return r, err
+	}
+	switch n := r.(type) {
+	case expr.Unary:
+		if n.X, err = rewrite(n.X, fn); err != nil {
+			return nil, err
+		}
+		return n, nil
+	case expr.Binary:
+		if n.X, err = rewrite(n.X, fn); err != nil {
+			return nil, err
+		}
+		if n.Y, err = rewrite(n.Y, fn); err != nil {
+			return nil, err
+		}
+		return n, nil
+	case expr.In:
+		if n.X, err = rewrite(n.X, fn); err != nil {
+			return nil, err
+		}
+		if n.List, err = rewriteList(n.List, fn); err != nil {
+			return nil, err
+		}
+		return n, nil
+	case expr.IsNull:
+		if n.X, err = rewrite(n.X, fn); err != nil {
+			return nil, err
+		}
+		return n, nil
+	case expr.Call:
+		if n.Args, err = rewriteList(n.Args, fn); err != nil {
+			return nil, err
+		}
+		return n, nil
+	}
+	return r, nil
+}
+
+func rewriteList(ns []expr.Node, fn func(expr.Node) (expr.Node, bool, error)) ([]expr.Node, error) {
+	res := make([]expr.Node, len(ns))
+	for i, n := range ns {
+		var err error
+		if res[i], err = rewrite(n, fn); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// aggregateCall returns the call if n is an aggregate function, min and max
+// with more than one argument are the scalar functions.
+func aggregateCall(n expr.Node) (expr.Call, bool) {
+	c, ok := n.(expr.Call)
+	if !ok {
+		return c, false
+	}
+	if _, ok := aggregates[c.Name]; !ok {
+		return c, false
+	}
+	if (c.Name == "min" || c.Name == "max") && len(c.Args) > 1 {
+		return c, false
+	}
+	return c, true
+}
+
+func hasAggregate(n expr.Node) bool {
+	found := false
+	rewrite(n, func(n expr.Node) (expr.Node, bool, error) { // nolint: errcheck
+		_, ok := aggregateCall(n)
+		found = found || ok
+		return n, ok, nil
+	})
+	return found
+}
+
+// conjunction returns the terms of n joined by &&.
+func conjunction(n expr.Node) []expr.Node {
+	if b, ok := n.(expr.Binary); ok && b.Op == "&&" {
+		return append(conjunction(b.X), conjunction(b.Y)...)
+	}
+	return []expr.Node{n}
+}
+
+func contains(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
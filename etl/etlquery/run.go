@@ -0,0 +1,423 @@
+package etlquery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/stdiopt/danda/drow"
+	"github.com/stdiopt/danda/drow/expr"
+	"github.com/stdiopt/danda/etl"
+	"github.com/stdiopt/danda/etl/etldrow"
+	"github.com/stdiopt/danda/etl/etlutil"
+	"github.com/stdiopt/danda/util/dagg"
+)
+
+// iter runs the plan over the tables returned by open.
+func (p *plan) iter(open func(name string) (etl.Iter, error)) etl.Iter {
+	tables := []Table{p.sel.From}
+	for _, j := range p.sel.Joins {
+		tables = append(tables, j.Table)
+	}
+	its := make([]etl.Iter, len(tables))
+	for i, t := range tables {
+		it, err := open(t.Name)
+		if err != nil {
+			for _, it := range its[:i] {
+				it.Close() // nolint: errcheck
+			}
+			return etl.ErrIter(err)
+		}
+		its[i] = it
+	}
+
+	it := its[0]
+	if len(p.joins) > 0 {
+		it = p.join(its)
+	}
+	if p.where != nil {
+		it = filter(it, p.where)
+	}
+	if p.group != nil {
+		it = p.aggregate(it)
+		if p.having != nil {
+			it = filter(it, p.having)
+		}
+	}
+	it = etl.MapE(it, p.project)
+	if p.sel.Distinct {
+		it = distinct(it)
+	}
+	if len(p.orders) > 0 {
+		it = etldrow.Sort(it, p.less)
+		if p.hidden > 0 {
+			it = etl.Map(it, func(row Row) Row {
+				return row[:len(row)-p.hidden]
+			})
+		}
+	}
+	if n := p.sel.Offset; n > 0 {
+		it = etl.Filter(it, func(Row) bool {
+			n--
+			return n < 0
+		})
+	}
+	if p.sel.Limit >= 0 {
+		it = etl.Limit(it, p.sel.Limit)
+	}
+	return it
+}
+
+func filter(it etl.Iter, e *expr.Expr) etl.Iter {
+	return etl.MakeIter(etl.Custom[Row]{
+		Next: func(ctx context.Context) (Row, error) {
+			for {
+				v, err := it.Next(ctx)
+				if err != nil {
+					return nil, err
+				}
+				row, ok := v.(Row)
+				if !ok {
+					return nil, fmt.Errorf("etlquery: type mismatch: %T", v)
+				}
+				match, err := e.Match(row)
+				if err != nil {
+					return nil, err
+				}
+				if match {
+					return row, nil
+				}
+			}
+		},
+		Close: it.Close,
+	})
+}
+
+// keyed is a row of a join side with its join key.
+type keyed struct {
+	key string
+	row Row
+}
+
+// keyedCodec encodes keyed rows as rows with the key in an extra field, it
+// is used when the join spills to disk.
+func keyedCodec() etl.Codec[keyed] {
+	rc := etldrow.RowCodec()
+	return etl.Codec[keyed]{
+		NewEncoder: func(w io.Writer) func(keyed) error {
+			enc := rc.NewEncoder(w)
+			return func(k keyed) error {
+				row := make(Row, len(k.row), len(k.row)+1)
+				copy(row, k.row)
+				return enc(append(row, drow.F("#key", k.key)))
+			}
+		},
+		NewDecoder: func(r io.Reader) func() (keyed, error) {
+			dec := rc.NewDecoder(r)
+			return func() (keyed, error) {
+				row, err := dec()
+				if err != nil || len(row) == 0 {
+					return keyed{}, err
+				}
+				key, _ := row[len(row)-1].Value.(string)
+				return keyed{key: key, row: row[:len(row)-1]}, nil
+			}
+		},
+	}
+}
+
+// columns keeps the field names of the first row of a join side to fill
+// the side with nulls when there's no match, it is written by the join
+// goroutine.
+type columns struct {
+	mu    sync.Mutex
+	names []string
+}
+
+func (c *columns) record(row Row) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.names != nil {
+		return
+	}
+	c.names = make([]string, len(row))
+	for i, f := range row {
+		c.names[i] = f.Name
+	}
+}
+
+// nullRow returns a row with the recorded names and null values.
+func (c *columns) nullRow() Row {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	row := make(Row, len(c.names))
+	for i, n := range c.names {
+		row[i] = drow.Field{Name: n}
+	}
+	return row
+}
+
+// join joins the tables in order with fields named "table.column" and adds
+// the columns with names unique across the tables.
+func (p *plan) join(its []etl.Iter) etl.Iter {
+	it := qualify(its[0], p.refs[0])
+	for i, jp := range p.joins {
+		it = joinStep(jp, it, qualify(its[i+1], p.refs[i+1]))
+	}
+	return etl.Map(it, func(row Row) Row {
+		count := p.shortNames(row)
+		res := make(Row, len(row), len(row)+len(count))
+		copy(res, row)
+		for _, f := range row {
+			if _, col, ok := p.split(f.Name); ok && count[col] == 1 {
+				res = append(res, drow.Field{Name: col, Value: f.Value})
+			}
+		}
+		return res
+	})
+}
+
+// shortNames counts the column names of the qualified fields of row.
+func (p *plan) shortNames(row Row) map[string]int {
+	count := map[string]int{}
+	for _, f := range row {
+		if _, col, ok := p.split(f.Name); ok {
+			count[col]++
+		}
+	}
+	return count
+}
+
+func qualify(it etl.Iter, ref string) etl.Iter {
+	return etl.Map(it, func(row Row) Row {
+		res := make(Row, len(row))
+		for i, f := range row {
+			res[i] = drow.Field{Name: ref + "." + f.Name, Value: f.Value}
+		}
+		return res
+	})
+}
+
+func joinStep(jp joinPlan, l, r etl.Iter) etl.Iter {
+	lcols, rcols := &columns{}, &columns{}
+	l = etl.MapE(l, keyFunc(jp.lkeys, lcols, "l"))
+	r = etl.MapE(r, keyFunc(jp.rkeys, rcols, "r"))
+	key := func(k keyed) string { return k.key }
+	it := etlutil.HashJoin(jp.kind, l, r, key, key,
+		etlutil.WithJoinCodecs(keyedCodec(), keyedCodec()),
+	)
+	return etl.Map(it, func(jd etlutil.JoinData[keyed, keyed]) Row {
+		var left, right Row
+		if jd.Left != nil {
+			left = jd.Left.row
+		} else {
+			left = lcols.nullRow()
+		}
+		if jd.Right != nil {
+			right = jd.Right.row
+		} else {
+			right = rcols.nullRow()
+		}
+		row := make(Row, 0, len(left)+len(right))
+		return append(append(row, left...), right...)
+	})
+}
+
+// keyFunc returns a func that evaluates the join keys of a row, null keys
+// are made unique since null never matches.
+func keyFunc(keys []*expr.Expr, cols *columns, side string) func(Row) (keyed, error) {
+	nulls := 0
+	return func(row Row) (keyed, error) {
+		cols.record(row)
+		sb := &strings.Builder{}
+		for _, k := range keys {
+			v, err := k.Eval(row)
+			if err != nil {
+				return keyed{}, err
+			}
+			if v == nil {
+				nulls++
+				return keyed{key: fmt.Sprintf("\x00%s%d", side, nulls), row: row}, nil
+			}
+			fmt.Fprintf(sb, "%v\x1f", v)
+		}
+		return keyed{key: sb.String(), row: row}, nil
+	}
+}
+
+// aggregate groups the rows by the group keys, the aggregate values are
+// evaluated by dagg funcs that can't fail so the first error is kept and
+// returned by the iterator.
+func (p *plan) aggregate(it etl.Iter) etl.Iter {
+	g := p.group
+	var aerr error
+	opts := make([]dagg.OptFn[Row], len(g.aggs))
+	for i, a := range g.aggs {
+		var fn func(Row) any
+		if arg := a.arg; arg != nil {
+			fn = func(row Row) any {
+				v, err := arg.Eval(row)
+				if err != nil && aerr == nil {
+					aerr = err
+				}
+				return v
+			}
+		}
+		opts[i] = aggregates[a.fn](aggField(i), fn)
+	}
+	git := etlutil.Group(it, func(row Row) (any, error) {
+		key := make(Row, len(g.keys))
+		for i, k := range g.keys {
+			v, err := k.Eval(row)
+			if err != nil {
+				return nil, err
+			}
+			key[i] = drow.Field{Name: keyField(i), Value: v}
+		}
+		return key, nil
+	}, opts...)
+
+	n := 0
+	return etl.MakeIter(etl.Custom[Row]{
+		Next: func(ctx context.Context) (Row, error) {
+			v, err := git.Next(ctx)
+			if aerr != nil {
+				return nil, aerr
+			}
+			// aggregates without GROUP BY always yield a row
+			if errors.Is(err, etl.EOI) && n == 0 && len(g.keys) == 0 {
+				n++
+				return g.empty(), nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			n++
+			return v.(Row), nil
+		},
+		Close: git.Close,
+	})
+}
+
+// empty returns the aggregates of no rows, counts are 0 and others null.
+func (g *groupPlan) empty() Row {
+	row := make(Row, len(g.aggs))
+	for i, a := range g.aggs {
+		row[i] = drow.Field{Name: aggField(i)}
+		if a.fn == "count" || a.fn == "count_distinct" {
+			row[i].Value = 0
+		}
+	}
+	return row
+}
+
+// project evaluates the select list and appends the order fields.
+func (p *plan) project(row Row) (Row, error) {
+	res := make(Row, 0, len(p.cols)+p.hidden)
+	for _, c := range p.cols {
+		if c.x == nil {
+			res = p.appendStar(res, row, c.table)
+			continue
+		}
+		v, err := c.x.Eval(row)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, drow.Field{Name: c.name, Value: v})
+	}
+	for _, o := range p.orders {
+		if o.x == nil {
+			continue
+		}
+		v, err := o.x.Eval(row)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, drow.Field{Name: o.name, Value: v})
+	}
+	return res, nil
+}
+
+// appendStar appends the fields of * or table.*, fields of joined rows are
+// named by their column unless it is ambiguous.
+func (p *plan) appendStar(res, row Row, table string) Row {
+	if len(p.refs) == 1 {
+		return append(res, row...)
+	}
+	count := p.shortNames(row)
+	for _, f := range row {
+		ref, col, ok := p.split(f.Name)
+		switch {
+		case !ok, table != "" && ref != table:
+			continue
+		case table != "" || count[col] == 1:
+			res = append(res, drow.Field{Name: col, Value: f.Value})
+		default:
+			res = append(res, f)
+		}
+	}
+	return res
+}
+
+// less compares rows by the order items, nulls sort last in ascending
+// order.
+func (p *plan) less(a, b Row) bool {
+	for _, o := range p.orders {
+		c := compareValues(o.value(a), o.value(b))
+		if o.desc {
+			c = -c
+		}
+		if c != 0 {
+			return c < 0
+		}
+	}
+	return false
+}
+
+func (o orderPlan) value(row Row) any {
+	if o.index < 0 {
+		return row.Value(o.name)
+	}
+	if o.index < len(row) {
+		return row[o.index].Value
+	}
+	return nil
+}
+
+// compareValues compares a and b as expressions do, values that can't be
+// compared are ordered by their string representation.
+func compareValues(a, b any) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	}
+	c, err := expr.Compare(a, b)
+	if err != nil {
+		return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+	}
+	return c
+}
+
+// distinct yields the rows with distinct values.
+func distinct(it etl.Iter) etl.Iter {
+	seen := map[string]struct{}{}
+	return etl.Filter(it, func(row Row) bool {
+		sb := &strings.Builder{}
+		for _, f := range row {
+			fmt.Fprintf(sb, "%T\x00%v\x1f", f.Value, f.Value)
+		}
+		k := sb.String()
+		if _, ok := seen[k]; ok {
+			return false
+		}
+		seen[k] = struct{}{}
+		return true
+	})
+}
@@ -0,0 +1,47 @@
+package etlsql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+)
+
+// SQLPrepare prepares statements, as sql.Tx does.
+type SQLPrepare interface {
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+}
+
+// BulkInserter is implemented by dialects with a bulk load path faster
+// than multi row inserts, BulkInsert is called within the Insert
+// transaction.
+type BulkInserter interface {
+	BulkInsert(ctx context.Context, db SQLPrepare, schema, name string, table TableDef, rows []Row) error
+}
+
+// BulkDriverChecker is implemented by bulk inserters that depend on the
+// database driver, CheckBulkDriver is called before inserting when the DB
+// was opened with Open or New with a *sql.DB.
+type BulkDriverChecker interface {
+	CheckBulkDriver(drv driver.Driver) error
+}
+
+func (d DB) bulkInserter() (BulkInserter, error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+	bi, ok := d.dialect.(BulkInserter)
+	if !ok {
+		return nil, fmt.Errorf("etlsql: dialect %v does not support bulk insert", d.dialect)
+	}
+	c, ok := bi.(BulkDriverChecker)
+	if !ok {
+		return bi, nil
+	}
+	if db, ok := d.q.(interface{ Driver() driver.Driver }); ok {
+		if err := c.CheckBulkDriver(db.Driver()); err != nil {
+			return nil, err
+		}
+	}
+	return bi, nil
+}
@@ -0,0 +1,67 @@
+package etlsql
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/stdiopt/danda/etl"
+)
+
+// CheckpointTable is the table where dialects store the checkpoints.
+const CheckpointTable = "danda_checkpoints"
+
+// Checkpointer is implemented by dialects that can store checkpoint
+// positions, SaveCheckpoint is called within the Insert transaction.
+type Checkpointer interface {
+	CreateCheckpoints(ctx context.Context, db SQLExec) error
+	LoadCheckpoint(ctx context.Context, db SQLQuery, name string) (string, error)
+	SaveCheckpoint(ctx context.Context, db SQLExec, name, pos string) error
+}
+
+func (d DB) checkpointer() (Checkpointer, error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+	cp, ok := d.dialect.(Checkpointer)
+	if !ok {
+		return nil, fmt.Errorf("etlsql: dialect %v does not support checkpoints", d.dialect)
+	}
+	return cp, nil
+}
+
+// LoadCheckpoint returns the position saved for name, or an empty string if
+// there is none.
+func (d DB) LoadCheckpoint(name string) (string, error) {
+	return d.Checkpoints().Load(context.Background(), name)
+}
+
+// Checkpoints returns an etl.CheckpointStore backed by the database.
+func (d DB) Checkpoints() etl.CheckpointStore {
+	return dbCheckpoints{d}
+}
+
+type dbCheckpoints struct {
+	db DB
+}
+
+func (c dbCheckpoints) Load(ctx context.Context, name string) (string, error) {
+	cp, err := c.db.checkpointer()
+	if err != nil {
+		return "", err
+	}
+	if err := cp.CreateCheckpoints(ctx, c.db.q); err != nil {
+		return "", err
+	}
+	return cp.LoadCheckpoint(ctx, c.db.q, name)
+}
+
+func (c dbCheckpoints) Save(ctx context.Context, name, pos string) error {
+	cp, err := c.db.checkpointer()
+	if err != nil {
+		return err
+	}
+	if err := cp.CreateCheckpoints(ctx, c.db.q); err != nil {
+		return err
+	}
+	return cp.SaveCheckpoint(ctx, c.db.q, name, pos)
+}
@@ -2,6 +2,7 @@ package etlsql
 
 import (
 	"database/sql"
+	"fmt"
 	"reflect"
 	"strings"
 
@@ -89,10 +90,10 @@ func DefFromIterRows(it etl.Iter) (TableDef, error) {
 				}
 			case *apd.Decimal:
 				if v != nil {
-					col.Scale = int(v.Exponent)
+					col.Precision, col.Scale = decimalSize(col, v)
 				}
 			case apd.Decimal:
-				col.Scale = int(v.Exponent)
+				col.Precision, col.Scale = decimalSize(col, &v)
 			}
 			if f.Value == nil {
 				col.Nullable = true
@@ -104,6 +105,7 @@ func DefFromIterRows(it etl.Iter) (TableDef, error) {
 				col.Nullable = true
 			}
 			col.Type = typFromGo(typ)
+			col.Elem = elemTypFromGo(typ)
 			def.Columns[ci] = col
 		}
 		return nil
@@ -111,6 +113,47 @@ func DefFromIterRows(it etl.Iter) (TableDef, error) {
 	return def, err
 }
 
+// decimalSize returns the precision and scale for col to also hold v.
+func decimalSize(col ColDef, v *apd.Decimal) (precision, scale int) {
+	scale = col.Scale
+	if s := -int(v.Exponent); s > scale {
+		scale = s
+	}
+	digits := col.Precision - col.Scale
+	if d := int(v.NumDigits()) + int(v.Exponent); d > digits {
+		digits = d
+	}
+	return digits + scale, scale
+}
+
+// DefFromSchema returns a TableDef with the columns of the schema s.
+func DefFromSchema(s drow.Schema) (TableDef, error) {
+	def := TableDef{}
+	for _, f := range s.Fields {
+		col := ColDef{
+			Name:     f.Name,
+			Nullable: f.Nullable,
+			Length:   int64(f.Length),
+		}
+		switch f.Type {
+		case drow.TypeString:
+			col.Type = TypeVarchar
+		case drow.TypeInt:
+			col.Type = TypeBigInt
+		case drow.TypeFloat:
+			col.Type = TypeDouble
+		case drow.TypeBool:
+			col.Type = TypeBoolean
+		case drow.TypeTime:
+			col.Type = TypeTimestamp
+		default:
+			return TableDef{}, fmt.Errorf("etlsql.DefFromSchema: field %q: unsupported type %v", f.Name, f.Type)
+		}
+		def.Columns = append(def.Columns, col)
+	}
+	return def, nil
+}
+
 // equalFold returns a func used in drow.Row.At to fetch a insesitive case field
 func equalFold(s string) func(row Row) *drow.Field {
 	return func(row Row) *drow.Field {
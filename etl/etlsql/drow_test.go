@@ -0,0 +1,34 @@
+package etlsql
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stdiopt/danda/drow"
+)
+
+func TestDefFromRowsTypes(t *testing.T) {
+	type test struct {
+		v    any
+		want Type
+	}
+	run := func(name string, tt test) {
+		t.Helper()
+		t.Run(name, func(t *testing.T) {
+			def, err := DefFromRows([]Row{{drow.F("c", tt.v)}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := def.Columns[0].Type; got != tt.want {
+				t.Errorf("DefFromRows(%T) type = %v, want %v", tt.v, got, tt.want)
+			}
+		})
+	}
+	iv := Interval(time.Hour)
+
+	run("duration", test{v: 1000 * time.Hour, want: TypeBigInt})
+	run("interval", test{v: Interval(time.Hour), want: TypeInterval})
+	run("interval pointer", test{v: &iv, want: TypeInterval})
+	run("time of day", test{v: TimeOfDay(time.Hour), want: TypeTime})
+	run("time", test{v: time.Time{}, want: TypeTimestamp})
+}
@@ -29,6 +29,9 @@ type Dialect interface {
 	CreateTable(ctx context.Context, db SQLExec, schema, name string, table TableDef) error
 	AddColumns(ctx context.Context, db SQLExec, schema, name string, table TableDef) error
 	Insert(ctx context.Context, db SQLExec, schema, name string, table TableDef, rows []Row) error
+	// Upsert inserts the rows updating the existing rows with the same
+	// keys, the rows have distinct keys.
+	Upsert(ctx context.Context, db SQLExec, schema, name string, table TableDef, rows []Row, up Upsert) error
 }
 
 type Q interface {
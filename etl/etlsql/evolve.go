@@ -0,0 +1,272 @@
+package etlsql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+)
+
+// ColChange is a change of an existing column.
+type ColChange struct {
+	From, To ColDef
+}
+
+// TypeChanged tells if the column type, length or scale changes.
+func (c ColChange) TypeChanged() bool {
+	return !c.From.Eq(c.To)
+}
+
+// NullChanged tells if the column becomes nullable.
+func (c ColChange) NullChanged() bool {
+	return c.To.Nullable && !c.From.Nullable
+}
+
+// Evolver is implemented by dialects that can change existing columns,
+// AlterColumns is called within the Insert transaction.
+// A dialect that can't apply part of a change sets the change To back to
+// the kept definition, as a column that stays not null.
+type Evolver interface {
+	AlterColumns(ctx context.Context, db SQLExec, schema, name string, changes []ColChange) error
+}
+
+func (d DB) evolver() (Evolver, error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+	ev, ok := d.dialect.(Evolver)
+	if !ok {
+		return nil, fmt.Errorf("etlsql: dialect %v does not support evolving columns", d.dialect)
+	}
+	return ev, nil
+}
+
+// Widen returns the changes to the columns of d so they can hold the values
+// of the same columns in d2, columns are never narrowed. Integers widen to
+// larger integers, decimals or doubles, reals to doubles, dates to
+// timestamps, varchar lengths grow and columns become nullable. Decimals
+// grow their scale and precision keeping at least the integer digits of
+// the current type. Columns of d2 with an SQLType override only change
+// nullability.
+func (d TableDef) Widen(d2 TableDef) []ColChange {
+	var changes []ColChange
+	for _, c := range d.Columns {
+		i := d2.IndexOf(c.Name)
+		if i == -1 {
+			continue
+		}
+		n := d2.Columns[i]
+		to := c
+		if n.Nullable {
+			to.Nullable = true
+		}
+		if n.SQLType == "" && c.SQLType == "" {
+			to.Type = widerType(c.Type, n.Type)
+			switch to.Type {
+			case TypeVarchar:
+				// length 0 is unlimited
+				if c.Length > 0 && n.Length > c.Length {
+					to.Length = n.Length
+				}
+			case TypeDecimal:
+				to.Precision, to.Scale = widerDecimal(c, n)
+			}
+		}
+		ch := ColChange{From: c, To: to}
+		if ch.TypeChanged() || ch.NullChanged() {
+			changes = append(changes, ch)
+		}
+	}
+	return changes
+}
+
+type intType struct {
+	bits     int
+	unsigned bool
+	digits   int // decimal digits of the largest value
+}
+
+var intTypes = map[Type]intType{
+	TypeSmallInt:         {8, false, 3},
+	TypeInteger:          {32, false, 10},
+	TypeBigInt:           {64, false, 19},
+	TypeUnsignedSmallInt: {8, true, 3},
+	TypeUnsignedInteger:  {32, true, 10},
+	TypeUnsignedBigInt:   {64, true, 20},
+}
+
+// widerDecimal returns the precision and scale of a decimal that holds the
+// values of c and n, c being a decimal or an integer. An unconstrained
+// decimal c stays unconstrained while an unconstrained n only requires its
+// scale.
+func widerDecimal(c, n ColDef) (precision, scale int) {
+	if c.Type == TypeDecimal && c.Precision == 0 {
+		return c.Precision, c.Scale
+	}
+	digits := intDigits(c)
+	scale = c.Scale
+	if n.Type == TypeDecimal && n.Scale > scale {
+		scale = n.Scale
+	}
+	if d := intDigits(n); d > digits {
+		digits = d
+	}
+	return digits + scale, scale
+}
+
+// intDigits returns the number of integer digits held by an integer or a
+// constrained decimal column.
+func intDigits(c ColDef) int {
+	if it, ok := intTypes[c.Type]; ok {
+		return it.digits
+	}
+	if c.Type == TypeDecimal && c.Precision > 0 {
+		return c.Precision - c.Scale
+	}
+	return 0
+}
+
+// widerType returns the type that holds values of a and b, or a if there
+// is none.
+func widerType(a, b Type) Type {
+	if a == b || b == TypeUnknown {
+		return a
+	}
+	ai, aInt := intTypes[a]
+	bi, bInt := intTypes[b]
+	switch {
+	case aInt && bInt:
+		return widerInt(ai, bi)
+	case aInt && (b == TypeReal || b == TypeDouble):
+		return TypeDouble
+	case aInt && b == TypeDecimal:
+		return TypeDecimal
+	case a == TypeReal && (bInt || b == TypeDouble):
+		return TypeDouble
+	case a == TypeDate && b == TypeTimestamp:
+		return TypeTimestamp
+	}
+	return a
+}
+
+func widerInt(a, b intType) Type {
+	if a.unsigned == b.unsigned {
+		bits := a.bits
+		if b.bits > bits {
+			bits = b.bits
+		}
+		for t, it := range intTypes {
+			if it.bits == bits && it.unsigned == a.unsigned {
+				return t
+			}
+		}
+	}
+	// signed integers need twice the bits of unsigned ones
+	bits := a.bits
+	if a.unsigned {
+		bits = a.bits * 2
+	}
+	if b.unsigned && b.bits*2 > bits {
+		bits = b.bits * 2
+	}
+	if !b.unsigned && b.bits > bits {
+		bits = b.bits
+	}
+	switch {
+	case bits <= 8:
+		return TypeSmallInt
+	case bits <= 32:
+		return TypeInteger
+	case bits <= 64:
+		return TypeBigInt
+	}
+	return TypeDecimal
+}
+
+// syncDDL creates the table or changes its columns to hold rows of def
+// according to sync, it returns the resulting table definition.
+func (d DB) syncDDL(ctx context.Context, db SQLExec, schema, table string, live, def TableDef, sync DDLSync) (TableDef, error) {
+	if live.Len() == 0 {
+		if sync < DDLCreate {
+			return TableDef{}, fmt.Errorf("etlsql: table '%s' does not exists", table)
+		}
+		if err := d.dialect.CreateTable(ctx, db, schema, table, def); err != nil {
+			return TableDef{}, err
+		}
+		return def, nil
+	}
+	if missing := def.MissingOn(live); missing.Len() > 0 {
+		if sync < DDLAddColumns {
+			return TableDef{}, fmt.Errorf("etlsql: table '%s' has no columns: %s", table, missing.StrJoin(", "))
+		}
+		if err := d.dialect.AddColumns(ctx, db, schema, table, missing); err != nil {
+			return TableDef{}, err
+		}
+		live = live.WithColumns(missing.Columns...)
+	}
+	if sync < DDLEvolve {
+		return live, nil
+	}
+	changes := live.Widen(def)
+	if len(changes) == 0 {
+		return live, nil
+	}
+	ev, err := d.evolver()
+	if err != nil {
+		return TableDef{}, err
+	}
+	if err := ev.AlterColumns(ctx, db, schema, table, changes); err != nil {
+		return TableDef{}, err
+	}
+	live = live.WithColumns() // clone
+	for _, ch := range changes {
+		live.Columns[live.IndexOf(ch.From.Name)] = ch.To
+	}
+	return live, nil
+}
+
+// Evolve creates the table or adds and widens its columns to hold rows of
+// def as DDLEvolve does, it returns the DDL statements which with dryRun
+// are planned but not executed.
+func (d DB) Evolve(schema, table string, def TableDef, dryRun bool) ([]string, error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+	ctx := context.Background()
+	live, err := d.dialect.TableDef(ctx, d.q, schema, table)
+	if err != nil {
+		return nil, err
+	}
+	rec := &ddlRecorder{}
+	if dryRun {
+		_, err := d.syncDDL(ctx, rec, schema, table, live, def, DDLEvolve)
+		return rec.stmts, err
+	}
+
+	tx, err := d.q.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback() // nolint: errcheck
+
+	rec.db = tx
+	if _, err := d.syncDDL(ctx, rec, schema, table, live, def, DDLEvolve); err != nil {
+		return rec.stmts, err
+	}
+	return rec.stmts, tx.Commit()
+}
+
+// ddlRecorder records the executed statements, without db they are only
+// recorded.
+type ddlRecorder struct {
+	db    SQLExec
+	stmts []string
+}
+
+func (r *ddlRecorder) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	r.stmts = append(r.stmts, query)
+	if r.db == nil {
+		return driver.RowsAffected(0), nil
+	}
+	return r.db.ExecContext(ctx, query, args...)
+}
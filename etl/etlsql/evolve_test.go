@@ -0,0 +1,238 @@
+package etlsql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/cockroachdb/apd"
+)
+
+func TestWiderType(t *testing.T) {
+	type test struct {
+		a, b Type
+		want Type
+	}
+	run := func(name string, tt test) {
+		t.Helper()
+		t.Run(name, func(t *testing.T) {
+			if got := widerType(tt.a, tt.b); got != tt.want {
+				t.Errorf("widerType(%v, %v) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+	run("same", test{TypeInteger, TypeInteger, TypeInteger})
+	run("unknown", test{TypeInteger, TypeUnknown, TypeInteger})
+	run("larger int", test{TypeInteger, TypeBigInt, TypeBigInt})
+	run("smaller int", test{TypeBigInt, TypeSmallInt, TypeBigInt})
+	run("unsigned into signed", test{TypeInteger, TypeUnsignedInteger, TypeBigInt})
+	run("unsigned bigint into signed", test{TypeBigInt, TypeUnsignedBigInt, TypeDecimal})
+	run("small unsigned fits", test{TypeInteger, TypeUnsignedSmallInt, TypeInteger})
+	run("int to double", test{TypeInteger, TypeReal, TypeDouble})
+	run("int to decimal", test{TypeBigInt, TypeDecimal, TypeDecimal})
+	run("real to double", test{TypeReal, TypeDouble, TypeDouble})
+	run("double stays", test{TypeDouble, TypeInteger, TypeDouble})
+	run("date to timestamp", test{TypeDate, TypeTimestamp, TypeTimestamp})
+	run("timestamp stays", test{TypeTimestamp, TypeDate, TypeTimestamp})
+	run("decimal stays", test{TypeDecimal, TypeDouble, TypeDecimal})
+	run("varchar stays", test{TypeVarchar, TypeInteger, TypeVarchar})
+}
+
+func TestTableDefWiden(t *testing.T) {
+	type test struct {
+		live ColDef
+		def  ColDef
+		want *ColDef
+	}
+	run := func(name string, tt test) {
+		t.Helper()
+		t.Run(name, func(t *testing.T) {
+			tt.live.Name, tt.def.Name = "c", "c"
+			var want []ColChange
+			if tt.want != nil {
+				tt.want.Name = "c"
+				want = []ColChange{{From: tt.live, To: *tt.want}}
+			}
+			live := TableDef{Columns: []ColDef{tt.live}}
+			got := live.Widen(TableDef{Columns: []ColDef{tt.def}})
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("wrong changes\nwant: %+v\n got: %+v", want, got)
+			}
+		})
+	}
+	run("same type", test{
+		live: ColDef{Type: TypeInteger},
+		def:  ColDef{Type: TypeInteger},
+	})
+	run("never narrows int", test{
+		live: ColDef{Type: TypeBigInt},
+		def:  ColDef{Type: TypeSmallInt},
+	})
+	run("never narrows varchar", test{
+		live: ColDef{Type: TypeVarchar, Length: 10},
+		def:  ColDef{Type: TypeVarchar, Length: 5},
+	})
+	run("never makes not null", test{
+		live: ColDef{Type: TypeInteger, Nullable: true},
+		def:  ColDef{Type: TypeInteger},
+	})
+	run("unlimited varchar", test{
+		live: ColDef{Type: TypeVarchar},
+		def:  ColDef{Type: TypeVarchar, Length: 50},
+	})
+	run("nullable", test{
+		live: ColDef{Type: TypeInteger},
+		def:  ColDef{Type: TypeInteger, Nullable: true},
+		want: &ColDef{Type: TypeInteger, Nullable: true},
+	})
+	run("int to bigint", test{
+		live: ColDef{Type: TypeInteger},
+		def:  ColDef{Type: TypeBigInt},
+		want: &ColDef{Type: TypeBigInt},
+	})
+	run("varchar length", test{
+		live: ColDef{Type: TypeVarchar, Length: 10},
+		def:  ColDef{Type: TypeVarchar, Length: 20},
+		want: &ColDef{Type: TypeVarchar, Length: 20},
+	})
+	run("decimal scale keeps integer digits", test{
+		live: ColDef{Type: TypeDecimal, Precision: 10, Scale: 2},
+		def:  ColDef{Type: TypeDecimal, Precision: 10, Scale: 4},
+		want: &ColDef{Type: TypeDecimal, Precision: 12, Scale: 4},
+	})
+	run("decimal integer digits", test{
+		live: ColDef{Type: TypeDecimal, Precision: 10, Scale: 2},
+		def:  ColDef{Type: TypeDecimal, Precision: 14, Scale: 2},
+		want: &ColDef{Type: TypeDecimal, Precision: 14, Scale: 2},
+	})
+	run("decimal never narrows", test{
+		live: ColDef{Type: TypeDecimal, Precision: 20, Scale: 4},
+		def:  ColDef{Type: TypeDecimal, Precision: 10, Scale: 2},
+	})
+	run("unconstrained decimal", test{
+		live: ColDef{Type: TypeDecimal},
+		def:  ColDef{Type: TypeDecimal, Precision: 10, Scale: 2},
+	})
+	run("unconstrained decimal rows", test{
+		live: ColDef{Type: TypeDecimal, Precision: 10, Scale: 2},
+		def:  ColDef{Type: TypeDecimal, Scale: 4},
+		want: &ColDef{Type: TypeDecimal, Precision: 12, Scale: 4},
+	})
+	run("bigint to decimal", test{
+		live: ColDef{Type: TypeBigInt},
+		def:  ColDef{Type: TypeDecimal, Precision: 10, Scale: 2},
+		want: &ColDef{Type: TypeDecimal, Precision: 21, Scale: 2},
+	})
+	run("int into decimal", test{
+		live: ColDef{Type: TypeDecimal, Precision: 10, Scale: 2},
+		def:  ColDef{Type: TypeInteger},
+		want: &ColDef{Type: TypeDecimal, Precision: 12, Scale: 2},
+	})
+	run("unsigned bigint into bigint", test{
+		live: ColDef{Type: TypeBigInt},
+		def:  ColDef{Type: TypeUnsignedBigInt},
+		want: &ColDef{Type: TypeDecimal, Precision: 20},
+	})
+	run("sql type override", test{
+		live: ColDef{Type: TypeInteger, SQLType: "int4"},
+		def:  ColDef{Type: TypeBigInt, Nullable: true},
+		want: &ColDef{Type: TypeInteger, SQLType: "int4", Nullable: true},
+	})
+}
+
+func TestDecimalSize(t *testing.T) {
+	col := ColDef{Type: TypeDecimal}
+	for _, s := range []string{"1.5", "123456789012.25", "0.125"} {
+		v, _, err := apd.NewFromString(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		col.Precision, col.Scale = decimalSize(col, v)
+	}
+	if col.Precision != 15 || col.Scale != 3 {
+		t.Errorf("decimalSize() = (%d,%d), want (15,3)", col.Precision, col.Scale)
+	}
+}
+
+func TestColDefDecimalSize(t *testing.T) {
+	type test struct {
+		col              ColDef
+		precision, scale int
+	}
+	run := func(name string, tt test) {
+		t.Helper()
+		t.Run(name, func(t *testing.T) {
+			p, s := tt.col.DecimalSize()
+			if p != tt.precision || s != tt.scale {
+				t.Errorf("DecimalSize() = (%d,%d), want (%d,%d)", p, s, tt.precision, tt.scale)
+			}
+		})
+	}
+	run("unknown", test{col: ColDef{Type: TypeDecimal}})
+	run("fits default", test{col: ColDef{Type: TypeDecimal, Precision: 3}})
+	run("scale", test{col: ColDef{Type: TypeDecimal, Precision: 4, Scale: 2}, precision: 10, scale: 2})
+	run("scale only", test{col: ColDef{Type: TypeDecimal, Scale: 2}, precision: 10, scale: 2})
+	run("larger precision", test{col: ColDef{Type: TypeDecimal, Precision: 21, Scale: 2}, precision: 21, scale: 2})
+	run("larger integer", test{col: ColDef{Type: TypeDecimal, Precision: 20}, precision: 20})
+}
+
+func TestWidenUnconstrainedNumeric(t *testing.T) {
+	db := sql.OpenDB(numericConnector{})
+	defer db.Close()
+	rows, err := db.Query("SELECT amount FROM t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	typs, err := rows.ColumnTypes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	live, err := DefFromSQLTypes(typs, func(*sql.ColumnType) (reflect.Type, error) {
+		return reflect.TypeOf(apd.Decimal{}), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ColDef{Name: "amount", Type: TypeDecimal}
+	if !reflect.DeepEqual(live.Columns[0], want) {
+		t.Fatalf("DefFromSQLTypes() = %+v, want %+v", live.Columns[0], want)
+	}
+	def := TableDef{Columns: []ColDef{
+		{Name: "amount", Type: TypeDecimal, Precision: 30, Scale: 12},
+	}}
+	if changes := live.Widen(def); len(changes) != 0 {
+		t.Errorf("Widen() = %+v, want no changes", changes)
+	}
+}
+
+// numericConnector is a driver with a single numeric column reported with
+// the lib/pq sizes of an unconstrained numeric.
+type numericConnector struct{}
+
+func (c numericConnector) Connect(context.Context) (driver.Conn, error) { return c, nil }
+func (c numericConnector) Driver() driver.Driver                        { return nil }
+func (c numericConnector) Prepare(string) (driver.Stmt, error)          { return c, nil }
+func (numericConnector) Begin() (driver.Tx, error)                      { return nil, errors.New("not supported") }
+func (numericConnector) Close() error                                   { return nil }
+func (numericConnector) NumInput() int                                  { return 0 }
+
+func (numericConnector) Exec([]driver.Value) (driver.Result, error) {
+	return nil, errors.New("not supported")
+}
+
+func (numericConnector) Query([]driver.Value) (driver.Rows, error) { return numericRows{}, nil }
+
+type numericRows struct{}
+
+func (numericRows) Columns() []string         { return []string{"amount"} }
+func (numericRows) Close() error              { return nil }
+func (numericRows) Next([]driver.Value) error { return io.EOF }
+
+func (numericRows) ColumnTypePrecisionScale(int) (int64, int64, bool) {
+	return 65535, 65531, true
+}
@@ -3,6 +3,7 @@ package etlsql
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/stdiopt/danda/etl"
 )
@@ -13,6 +14,9 @@ const (
 	DDLNone DDLSync = iota
 	DDLCreate
 	DDLAddColumns
+	// DDLEvolve adds missing columns and widens the existing ones to hold
+	// the rows, see TableDef.Widen.
+	DDLEvolve
 )
 
 type insertOptions struct {
@@ -20,6 +24,14 @@ type insertOptions struct {
 	ddlSync      DDLSync
 	nullables    map[string]struct{}
 	typeOverride func(t ColDef) string
+	retry        []etl.RetryOptFunc
+	batchTimeout time.Duration
+
+	checkpoint    string
+	checkpointSrc etl.Positioner
+
+	upsert Upsert
+	bulk   bool
 }
 type insertOptFunc func(*insertOptions)
 
@@ -58,6 +70,69 @@ func WithTypeOverride(fn func(t ColDef) string) insertOptFunc {
 	}
 }
 
+// WithRetry retries a failed batch transaction with backoff, the errors
+// are classified with DB.Retryable unless etl.WithRetryIf is passed.
+func WithRetry(opts ...etl.RetryOptFunc) insertOptFunc {
+	return func(o *insertOptions) {
+		o.retry = append([]etl.RetryOptFunc{}, opts...)
+	}
+}
+
+// WithBatchTimeout inserts the pending rows when d passed since the first row
+// of the batch, so slow streams don't wait for a full batch.
+func WithBatchTimeout(d time.Duration) insertOptFunc {
+	return func(o *insertOptions) {
+		o.batchTimeout = d
+	}
+}
+
+// WithCheckpoint saves the position of src as the checkpoint name in the
+// same transaction of each batch, src is usually the source iterator that
+// Insert consumes and the position can be loaded with DB.LoadCheckpoint to
+// resume it. It can't be used with WithBatchTimeout since the batch is read
+// ahead.
+func WithCheckpoint(name string, src etl.Positioner) insertOptFunc {
+	return func(o *insertOptions) {
+		o.checkpoint = name
+		o.checkpointSrc = src
+	}
+}
+
+// WithUpsert updates the existing rows with the same keys instead of
+// inserting duplicates, rows of a batch with the same keys are merged. The
+// table needs a primary key or unique index on keys, tables created with
+// DDLCreate use keys as primary key. Without keys rows are inserted.
+func WithUpsert(keys ...string) insertOptFunc {
+	return func(o *insertOptions) {
+		o.upsert.Keys = append([]string{}, keys...)
+	}
+}
+
+// WithUpdateStrategy sets the upsert strategy of cols, or the default
+// strategy if no cols are given, it defaults to UpdateOverwrite.
+func WithUpdateStrategy(s UpdateStrategy, cols ...string) insertOptFunc {
+	return func(o *insertOptions) {
+		if len(cols) == 0 {
+			o.upsert.Default = s
+			return
+		}
+		if o.upsert.Strategies == nil {
+			o.upsert.Strategies = map[string]UpdateStrategy{}
+		}
+		for _, c := range cols {
+			o.upsert.Strategies[c] = s
+		}
+	}
+}
+
+// WithBulk loads the rows with the dialect bulk path, as COPY in postgres,
+// the dialect must implement BulkInserter. It can't be used with WithUpsert.
+func WithBulk() insertOptFunc {
+	return func(o *insertOptions) {
+		o.bulk = true
+	}
+}
+
 func (o *insertOptions) apply(opts ...insertOptFunc) {
 	for _, fn := range opts {
 		fn(o)
@@ -75,7 +150,32 @@ func (d DB) Insert(it Iter, schema, table string, opts ...insertOptFunc) error {
 	}
 	opt.apply(opts...)
 
+	var bi BulkInserter
+	if opt.bulk {
+		if len(opt.upsert.Keys) > 0 {
+			return fmt.Errorf("etlsql.DB.Insert: bulk can't be used with upsert")
+		}
+		var err error
+		if bi, err = d.bulkInserter(); err != nil {
+			return fmt.Errorf("etlsql.DB.Insert: %w", err)
+		}
+	}
+
 	ctx := context.Background()
+	var cp Checkpointer
+	if opt.checkpointSrc != nil {
+		if opt.batchTimeout > 0 {
+			return fmt.Errorf("etlsql.DB.Insert: checkpoint can't be used with batch timeout")
+		}
+		var err error
+		if cp, err = d.checkpointer(); err != nil {
+			return fmt.Errorf("etlsql.DB.Insert: %w", err)
+		}
+		if err := cp.CreateCheckpoints(ctx, d.q); err != nil {
+			return fmt.Errorf("etlsql.DB.Insert: creating checkpoints: %w", err)
+		}
+	}
+
 	tableDef, err := d.dialect.TableDef(ctx, d.q, schema, table)
 	if err != nil {
 		return err
@@ -128,29 +228,61 @@ func (d DB) Insert(it Iter, schema, table string, opts ...insertOptFunc) error {
 			}
 		}
 		// DDLSync
-		if missing := def.MissingOn(tableDef); missing.Len() > 0 {
-			var err error
-			switch {
-			case len(tableDef.Columns) == 0:
-				if opt.ddlSync < DDLCreate {
-					return fmt.Errorf("etlsql.DB.Insert: table '%s' does not exists", table)
-				}
-				err = d.dialect.CreateTable(ctx, tx, schema, table, def)
-			case opt.ddlSync == DDLAddColumns:
-				err = d.dialect.AddColumns(ctx, tx, schema, table, missing)
+		if len(opt.upsert.Keys) > 0 {
+			def.PrimaryKey = opt.upsert.Keys
+		}
+		live, err := d.syncDDL(ctx, tx, schema, table, tableDef, def, opt.ddlSync)
+		if err != nil {
+			return err
+		}
+		rows = live.NormalizeRows(rows)
+
+		switch {
+		case len(opt.upsert.Keys) > 0:
+			if rows, err = opt.upsert.merge(live, rows); err != nil {
+				return fmt.Errorf("etlsql.DB.Insert: %w", err)
 			}
-			if err != nil {
-				return err
+			err = d.dialect.Upsert(ctx, tx, schema, table, live, rows, opt.upsert)
+		case bi != nil:
+			err = bi.BulkInsert(ctx, tx, schema, table, live, rows)
+		default:
+			err = d.dialect.Insert(ctx, tx, schema, table, live, rows)
+		}
+		if err != nil {
+			return err
+		}
+		if cp != nil {
+			pos := opt.checkpointSrc.Position()
+			if err := cp.SaveCheckpoint(ctx, tx, opt.checkpoint, pos); err != nil {
+				return fmt.Errorf("saving checkpoint: %w", err)
 			}
-			tableDef = def
 		}
-		rows = tableDef.NormalizeRows(rows)
 
-		if err := d.dialect.Insert(ctx, tx, schema, table, tableDef, rows); err != nil {
+		if err := tx.Commit(); err != nil {
 			return err
 		}
+		// keep the changes only when commited, a retry syncs again
+		tableDef = live
+		return nil
+	}
+
+	if opt.retry != nil {
+		insertOnce := insert
+		retry := append([]etl.RetryOptFunc{etl.WithRetryIf(d.Retryable)}, opt.retry...)
+		insert = func(ctx context.Context, rows []Row) error {
+			return etl.RetryDo(ctx, func(ctx context.Context) error {
+				return insertOnce(ctx, rows)
+			}, retry...)
+		}
+	}
 
-		return tx.Commit()
+	if opt.batchTimeout > 0 {
+		return etl.Consume(
+			etl.Batch[Row](it, opt.batchSize, opt.batchTimeout),
+			func(rows []Row) error {
+				return insert(ctx, rows)
+			},
+		)
 	}
 
 	rows := []Row{}
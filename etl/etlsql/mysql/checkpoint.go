@@ -0,0 +1,41 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/stdiopt/danda/etl/etlsql"
+)
+
+func (mysql) CreateCheckpoints(ctx context.Context, db etlsql.SQLExec) error {
+	qry := fmt.Sprintf("CREATE TABLE IF NOT EXISTS `%s` (\n"+
+		"\t`name` VARCHAR(255) PRIMARY KEY,\n"+
+		"\t`position` TEXT NOT NULL,\n"+
+		"\t`updated_at` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP\n"+
+		")", etlsql.CheckpointTable)
+	if _, err := db.ExecContext(ctx, qry); err != nil {
+		return fmt.Errorf("createCheckpoints failed: %w", err)
+	}
+	return nil
+}
+
+func (mysql) LoadCheckpoint(ctx context.Context, db etlsql.SQLQuery, name string) (string, error) {
+	qry := fmt.Sprintf("SELECT `position` FROM `%s` WHERE `name` = ?", etlsql.CheckpointTable)
+	var pos string
+	err := db.QueryRowContext(ctx, qry, name).Scan(&pos)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return pos, err
+}
+
+func (mysql) SaveCheckpoint(ctx context.Context, db etlsql.SQLExec, name, pos string) error {
+	qry := fmt.Sprintf("INSERT INTO `%s` (`name`, `position`) VALUES (?, ?)\n"+
+		"\tON DUPLICATE KEY UPDATE `position` = VALUES(`position`)",
+		etlsql.CheckpointTable,
+	)
+	_, err := db.ExecContext(ctx, qry, name, pos)
+	return err
+}
@@ -0,0 +1,36 @@
+package mysql
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/stdiopt/danda/etl/etlsql"
+)
+
+// AlterColumns redefines the changed columns with MODIFY COLUMN in a
+// single ALTER TABLE statement.
+func (d mysql) AlterColumns(ctx context.Context, db etlsql.SQLExec, dbn, name string, changes []etlsql.ColChange) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	actions := make([]string, len(changes))
+	for i, ch := range changes {
+		sqlType, err := d.columnSQLTypeName(ch.To)
+		if err != nil {
+			return fmt.Errorf("field '%s' %w", ch.To.Name, err)
+		}
+		actions[i] = fmt.Sprintf("MODIFY COLUMN `%s` %s", ch.To.Name, sqlType)
+	}
+
+	var qry string
+	if dbn == "" {
+		qry = fmt.Sprintf("ALTER TABLE `%s` %s", name, strings.Join(actions, ", "))
+	} else {
+		qry = fmt.Sprintf("ALTER TABLE `%s`.`%s` %s", dbn, name, strings.Join(actions, ", "))
+	}
+	if _, err := db.ExecContext(ctx, qry); err != nil {
+		return fmt.Errorf("alterColumns failed: %w", err)
+	}
+	return nil
+}
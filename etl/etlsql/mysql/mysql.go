@@ -89,11 +89,14 @@ func (d mysql) CreateTable(ctx context.Context, db etlsql.SQLExec, dbname, name
 		}
 
 		fmt.Fprintf(qry, "\t`%s` %s", c.Name, sqlType)
-		if i < len(def.Columns)-1 {
+		if i < len(def.Columns)-1 || len(def.PrimaryKey) > 0 {
 			qry.WriteRune(',')
 		}
 		qry.WriteRune('\n')
 	}
+	if len(def.PrimaryKey) > 0 {
+		fmt.Fprintf(qry, "\tPRIMARY KEY (`%s`)\n", strings.Join(def.PrimaryKey, "`, `"))
+	}
 	qry.WriteString(")\n")
 
 	_, err := db.ExecContext(ctx, qry.String(), params...)
@@ -136,6 +139,39 @@ func (d mysql) AddColumns(ctx context.Context, db etlsql.SQLExec, dbn, name stri
 }
 
 func (d mysql) Insert(ctx context.Context, db etlsql.SQLExec, dbn, name string, def Table, rows []etlsql.Row) error {
+	return d.insert(ctx, db, dbn, name, def, rows, "")
+}
+
+// Upsert inserts the rows with an ON DUPLICATE KEY UPDATE clause, the
+// conflicts are on the table unique keys which should match the upsert
+// keys.
+// The new values are referenced with the VALUES() function which is
+// deprecated since MySQL 8.0.20 but, unlike a row alias, works on 5.7 and
+// MariaDB.
+func (d mysql) Upsert(ctx context.Context, db etlsql.SQLExec, dbn, name string, def Table, rows []etlsql.Row, up etlsql.Upsert) error {
+	dup := &bytes.Buffer{}
+	dup.WriteString(" ON DUPLICATE KEY UPDATE ")
+	updates := up.Updates(def)
+	if len(updates) == 0 {
+		// no op update so existing rows are kept
+		fmt.Fprintf(dup, "`%[1]s` = `%[1]s`", up.Keys[0])
+		return d.insert(ctx, db, dbn, name, def, rows, dup.String())
+	}
+	for i, c := range updates {
+		if i > 0 {
+			dup.WriteString(", ")
+		}
+		switch up.Strategy(c.Name) {
+		case etlsql.UpdateCoalesce:
+			fmt.Fprintf(dup, "`%[1]s` = COALESCE(VALUES(`%[1]s`), `%[1]s`)", c.Name)
+		default:
+			fmt.Fprintf(dup, "`%[1]s` = VALUES(`%[1]s`)", c.Name)
+		}
+	}
+	return d.insert(ctx, db, dbn, name, def, rows, dup.String())
+}
+
+func (d mysql) insert(ctx context.Context, db etlsql.SQLExec, dbn, name string, def Table, rows []etlsql.Row, suffix string) error {
 	qryBuf := &bytes.Buffer{}
 	if dbn == "" {
 		fmt.Fprintf(qryBuf, "INSERT INTO `%s` (%s) VALUES ", name, def.StrJoin(", "))
@@ -155,6 +191,7 @@ func (d mysql) Insert(ctx context.Context, db etlsql.SQLExec, dbn, name string,
 		}
 	}
 	qryBuf.WriteString(")")
+	qryBuf.WriteString(suffix)
 	//
 	params := def.RowValues(rows)
 
@@ -169,6 +206,14 @@ func (d mysql) ColumnGoType(ct *sql.ColumnType) (reflect.Type, error) {
 	//	return byteTyp, nil
 	case "DECIMAL":
 		return apdDecimalTyp, nil
+	case "DATE":
+		return dateTyp, nil
+	case "TIME":
+		return timeOfDayTyp, nil
+	case "JSON":
+		return jsonTyp, nil
+	case "BINARY", "VARBINARY", "TINYBLOB", "BLOB", "MEDIUMBLOB", "LONGBLOB":
+		return bytesTyp, nil
 	default:
 		return etlsql.ColumnGoTypeDef(ct)
 	}
@@ -177,7 +222,13 @@ func (d mysql) ColumnGoType(ct *sql.ColumnType) (reflect.Type, error) {
 // timeTyp       = reflect.TypeOf(time.Time{})
 // boolTyp       = reflect.TypeOf(bool(false))
 // byteTyp       = reflect.TypeOf(byte(0))
-var apdDecimalTyp = reflect.TypeOf(apd.Decimal{})
+var (
+	apdDecimalTyp = reflect.TypeOf(apd.Decimal{})
+	bytesTyp      = reflect.TypeOf([]byte{})
+	dateTyp       = reflect.TypeOf(etlsql.Date{})
+	timeOfDayTyp  = reflect.TypeOf(etlsql.TimeOfDay(0))
+	jsonTyp       = reflect.TypeOf(etlsql.JSON{})
+)
 
 func (d mysql) columnSQLTypeName(c Col) (string, error) {
 	if c.SQLType != "" {
@@ -218,11 +269,27 @@ func (d mysql) columnSQLTypeName(c Col) (string, error) {
 		nullable = true
 		sqlType = "datetime"
 	case etlsql.TypeDecimal:
+		// mysql decimals default to decimal(10,0)
 		sqlType = "decimal"
-		if c.Scale != 0 {
-			sqlType += fmt.Sprintf("(10,%d)", c.Scale)
+		if p, s := c.DecimalSize(); p > 0 {
+			sqlType += fmt.Sprintf("(%d,%d)", p, s)
 		}
 		def = "DEFAULT 0.0"
+	case etlsql.TypeDate:
+		nullable = true
+		sqlType = "date"
+	case etlsql.TypeTime:
+		sqlType, def = "time(6)", "DEFAULT '00:00:00'"
+	case etlsql.TypeBlob:
+		sqlType = "longblob"
+	case etlsql.TypeJSON, etlsql.TypeArray:
+		// no arrays in mysql, they are stored as json
+		sqlType = "json"
+	case etlsql.TypeUUID:
+		sqlType, def = "char(36)", "DEFAULT '00000000-0000-0000-0000-000000000000'"
+	case etlsql.TypeInterval:
+		// time ranges from -838:59:59 to 838:59:59
+		sqlType, def = "time(6)", "DEFAULT '00:00:00'"
 	}
 
 	if sqlType == "" {
@@ -0,0 +1,78 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"testing"
+
+	"github.com/stdiopt/danda/drow"
+	"github.com/stdiopt/danda/etl/etlsql"
+)
+
+func TestUpsert(t *testing.T) {
+	def := Table{Columns: []etlsql.ColDef{
+		{Name: "id"},
+		{Name: "name"},
+		{Name: "note"},
+	}}
+	rows := []etlsql.Row{{drow.F("id", 1), drow.F("name", "a"), drow.F("note", "n")}}
+	type test struct {
+		up   etlsql.Upsert
+		want string
+	}
+	run := func(name string, tt test) {
+		t.Helper()
+		t.Run(name, func(t *testing.T) {
+			db := &execRecorder{}
+			if err := Dialect.Upsert(context.Background(), db, "", "t", def, rows, tt.up); err != nil {
+				t.Fatal(err)
+			}
+			want := "INSERT INTO `t` (id, name, note) VALUES (?, ?, ?)" + tt.want
+			if db.query != want {
+				t.Errorf("Upsert() query\nwant: %s\n got: %s", want, db.query)
+			}
+		})
+	}
+	run("overwrite", test{
+		up:   etlsql.Upsert{Keys: []string{"id"}},
+		want: " ON DUPLICATE KEY UPDATE `name` = VALUES(`name`), `note` = VALUES(`note`)",
+	})
+	run("coalesce", test{
+		up: etlsql.Upsert{
+			Keys:       []string{"id"},
+			Strategies: map[string]etlsql.UpdateStrategy{"note": etlsql.UpdateCoalesce},
+		},
+		want: " ON DUPLICATE KEY UPDATE `name` = VALUES(`name`), `note` = COALESCE(VALUES(`note`), `note`)",
+	})
+	run("keep all", test{
+		up:   etlsql.Upsert{Keys: []string{"id"}, Default: etlsql.UpdateKeep},
+		want: " ON DUPLICATE KEY UPDATE `id` = `id`",
+	})
+}
+
+func TestSaveCheckpoint(t *testing.T) {
+	db := &execRecorder{}
+	if err := Dialect.SaveCheckpoint(context.Background(), db, "load", "42"); err != nil {
+		t.Fatal(err)
+	}
+	want := "INSERT INTO `danda_checkpoints` (`name`, `position`) VALUES (?, ?)\n" +
+		"\tON DUPLICATE KEY UPDATE `position` = VALUES(`position`)"
+	if db.query != want {
+		t.Errorf("SaveCheckpoint() query\nwant: %s\n got: %s", want, db.query)
+	}
+	if wantArgs := []any{"load", "42"}; !reflect.DeepEqual(db.args, wantArgs) {
+		t.Errorf("SaveCheckpoint() args = %v, want %v", db.args, wantArgs)
+	}
+}
+
+// execRecorder records the last query executed.
+type execRecorder struct {
+	query string
+	args  []any
+}
+
+func (e *execRecorder) ExecContext(_ context.Context, query string, args ...any) (sql.Result, error) {
+	e.query, e.args = query, args
+	return nil, nil
+}
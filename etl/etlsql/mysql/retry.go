@@ -0,0 +1,17 @@
+package mysql
+
+import (
+	"errors"
+
+	driver "github.com/go-sql-driver/mysql"
+)
+
+// Retryable implements etlsql.RetryClassifier, lock wait timeouts (1205)
+// and deadlocks (1213) are retryable.
+func (mysql) Retryable(err error) bool {
+	var merr *driver.MySQLError
+	if !errors.As(err, &merr) {
+		return false
+	}
+	return merr.Number == 1205 || merr.Number == 1213
+}
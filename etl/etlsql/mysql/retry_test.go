@@ -0,0 +1,28 @@
+package mysql
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	driver "github.com/go-sql-driver/mysql"
+)
+
+func TestRetryable(t *testing.T) {
+	type test struct {
+		err  error
+		want bool
+	}
+	run := func(name string, tt test) {
+		t.Helper()
+		t.Run(name, func(t *testing.T) {
+			if got := Dialect.Retryable(tt.err); got != tt.want {
+				t.Errorf("Retryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+	run("lock wait timeout", test{err: &driver.MySQLError{Number: 1205}, want: true})
+	run("deadlock", test{err: fmt.Errorf("exec: %w", &driver.MySQLError{Number: 1213}), want: true})
+	run("duplicate key", test{err: &driver.MySQLError{Number: 1062}, want: false})
+	run("other error", test{err: errors.New("fail"), want: false})
+}
@@ -0,0 +1,121 @@
+package psql
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/stdiopt/danda/etl/etlsql"
+)
+
+// rowValues returns the row values with arrays as postgres array literals
+// since etlsql writes them as json.
+func rowValues(def TableDef, rows []etlsql.Row) ([]any, error) {
+	params := def.RowValues(rows)
+	n := len(def.Columns)
+	for ci, c := range def.Columns {
+		if c.Type != etlsql.TypeArray {
+			continue
+		}
+		for i := ci; i < len(params); i += n {
+			s, ok := params[i].(string)
+			if !ok {
+				continue
+			}
+			lit, err := arrayLiteral(s)
+			if err != nil {
+				return nil, fmt.Errorf("field '%s': %w", c.Name, err)
+			}
+			params[i] = lit
+		}
+	}
+	return params, nil
+}
+
+// arrayLiteral converts a json array to a postgres array literal.
+func arrayLiteral(s string) (string, error) {
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	var arr []any
+	if err := dec.Decode(&arr); err != nil {
+		return "", fmt.Errorf("invalid array: %w", err)
+	}
+	buf := &bytes.Buffer{}
+	if err := writeArray(buf, arr); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func writeArray(buf *bytes.Buffer, arr []any) error {
+	buf.WriteByte('{')
+	for i, v := range arr {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		switch v := v.(type) {
+		case nil:
+			buf.WriteString("NULL")
+		case json.Number:
+			buf.WriteString(v.String())
+		case bool:
+			fmt.Fprint(buf, v)
+		case string:
+			quoteArrayElem(buf, v)
+		case []any:
+			if err := writeArray(buf, v); err != nil {
+				return err
+			}
+		default:
+			// objects are written as json elements
+			data, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+			quoteArrayElem(buf, string(data))
+		}
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+func quoteArrayElem(buf *bytes.Buffer, s string) {
+	buf.WriteByte('"')
+	for _, r := range s {
+		if r == '"' || r == '\\' {
+			buf.WriteByte('\\')
+		}
+		buf.WriteRune(r)
+	}
+	buf.WriteByte('"')
+}
+
+// arrayElemSQLType returns the sql type of array elements.
+func arrayElemSQLType(t etlsql.Type) string {
+	switch t {
+	case etlsql.TypeBoolean:
+		return "boolean"
+	case etlsql.TypeSmallInt, etlsql.TypeUnsignedSmallInt:
+		return "smallint"
+	case etlsql.TypeInteger, etlsql.TypeUnsignedInteger:
+		return "integer"
+	case etlsql.TypeBigInt, etlsql.TypeUnsignedBigInt:
+		return "bigint"
+	case etlsql.TypeReal:
+		return "real"
+	case etlsql.TypeDouble:
+		return "double precision"
+	case etlsql.TypeDecimal:
+		return "numeric"
+	case etlsql.TypeTimestamp:
+		return "timestamp"
+	case etlsql.TypeDate:
+		return "date"
+	case etlsql.TypeUUID:
+		return "uuid"
+	case etlsql.TypeJSON:
+		return "jsonb"
+	}
+	return "text"
+}
@@ -0,0 +1,41 @@
+package psql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/stdiopt/danda/etl/etlsql"
+)
+
+func (psql) CreateCheckpoints(ctx context.Context, db etlsql.SQLExec) error {
+	qry := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS "%s" (
+	"name" VARCHAR(255) PRIMARY KEY,
+	"position" TEXT NOT NULL,
+	"updated_at" TIMESTAMP NOT NULL DEFAULT now()
+)`, etlsql.CheckpointTable)
+	if _, err := db.ExecContext(ctx, qry); err != nil {
+		return fmt.Errorf("createCheckpoints failed: %w", err)
+	}
+	return nil
+}
+
+func (psql) LoadCheckpoint(ctx context.Context, db etlsql.SQLQuery, name string) (string, error) {
+	qry := fmt.Sprintf(`SELECT "position" FROM "%s" WHERE "name" = $1`, etlsql.CheckpointTable)
+	var pos string
+	err := db.QueryRowContext(ctx, qry, name).Scan(&pos)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return pos, err
+}
+
+func (psql) SaveCheckpoint(ctx context.Context, db etlsql.SQLExec, name, pos string) error {
+	qry := fmt.Sprintf(`INSERT INTO "%s" ("name", "position") VALUES ($1, $2)
+	ON CONFLICT ("name") DO UPDATE SET "position" = EXCLUDED."position", "updated_at" = now()`,
+		etlsql.CheckpointTable,
+	)
+	_, err := db.ExecContext(ctx, qry, name, pos)
+	return err
+}
@@ -0,0 +1,111 @@
+package psql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/cockroachdb/apd"
+	"github.com/stdiopt/danda/etl/etlsql"
+	"github.com/stdiopt/danda/util/conv"
+)
+
+// ErrCopyUnsupported is returned by bulk inserts when the driver can't run
+// COPY FROM STDIN through prepared statements.
+var ErrCopyUnsupported = errors.New("driver does not support COPY")
+
+// CheckBulkDriver implements etlsql.BulkDriverChecker, only lib/pq runs COPY
+// through prepared statements, other drivers as pgx fail to prepare it.
+func (psql) CheckBulkDriver(drv driver.Driver) error {
+	t := reflect.TypeOf(drv)
+	if t != nil && t.Kind() == reflect.Pointer && t.Elem().PkgPath() == "github.com/lib/pq" {
+		return nil
+	}
+	return fmt.Errorf("%w: %T, use lib/pq or insert without bulk", ErrCopyUnsupported, drv)
+}
+
+// BulkInsert loads the rows with COPY FROM STDIN, the driver must support
+// COPY through prepared statements as lib/pq does where each Exec sends a
+// row and the final Exec without args flushes the data.
+func (d psql) BulkInsert(ctx context.Context, db etlsql.SQLPrepare, schema, name string, def TableDef, rows []etlsql.Row) error {
+	var qry string
+	if schema == "" {
+		qry = fmt.Sprintf(`COPY "%s" (%s) FROM STDIN`, name, def.StrJoin(", "))
+	} else {
+		qry = fmt.Sprintf(`COPY "%s"."%s" (%s) FROM STDIN`, schema, name, def.StrJoin(", "))
+	}
+	stmt, err := db.PrepareContext(ctx, qry)
+	if err != nil {
+		return fmt.Errorf("copy failed: %w, %s", err, qry)
+	}
+	defer stmt.Close()
+
+	n := len(def.Columns)
+	params, err := rowValues(def, rows)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(params); i += n {
+		vals := params[i : i+n]
+		for j, v := range vals {
+			vals[j] = copyValue(v)
+		}
+		if _, err := stmt.ExecContext(ctx, vals...); err != nil {
+			return fmt.Errorf("copy failed: %w, %s", err, qry)
+		}
+	}
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		return fmt.Errorf("copy failed: %w, %s", err, qry)
+	}
+	return nil
+}
+
+// copyValue returns the COPY text representation of v, the driver escapes
+// the strings and encodes nil as null.
+func copyValue(v any) any {
+	v = conv.Deref(v)
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case string:
+		return v
+	case []byte:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		return v.Format("2006-01-02 15:04:05.999999999Z07:00")
+	case apd.Decimal:
+		return v.String()
+	case driver.Valuer:
+		dv, err := v.Value()
+		if err != nil {
+			return v
+		}
+		return copyValue(dv)
+	case float32:
+		return formatFloat(float64(v), 32)
+	case float64:
+		return formatFloat(v, 64)
+	case int8, int16, int32, int64, int, uint8, uint16, uint32, uint64, uint:
+		return fmt.Sprint(v)
+	}
+	return conv.ToString(v)
+}
+
+func formatFloat(f float64, bits int) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+	return strconv.FormatFloat(f, 'g', -1, bits)
+}
@@ -0,0 +1,120 @@
+package psql
+
+import (
+	"database/sql/driver"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/apd"
+	"github.com/lib/pq"
+	"github.com/stdiopt/danda/drow"
+	"github.com/stdiopt/danda/etl/etlsql"
+)
+
+func TestCopyValue(t *testing.T) {
+	type test struct {
+		v    any
+		want any
+	}
+	run := func(name string, tt test) {
+		t.Helper()
+		t.Run(name, func(t *testing.T) {
+			if got := copyValue(tt.v); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("copyValue(%#v) = %#v, want %#v", tt.v, got, tt.want)
+			}
+		})
+	}
+	dec := func(s string) apd.Decimal {
+		d, _, err := apd.NewFromString(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return *d
+	}
+	n, s := int64(7), "x"
+	d := dec("-12345678901234567890.50")
+
+	run("nil", test{v: nil, want: nil})
+	run("nil pointer", test{v: (*string)(nil), want: nil})
+	run("string", test{v: "a\tb", want: "a\tb"})
+	run("string pointer", test{v: &s, want: "x"})
+	run("bytes", test{v: []byte{0, 1}, want: []byte{0, 1}})
+	run("bool", test{v: true, want: "true"})
+	run("int", test{v: 42, want: "42"})
+	run("int pointer", test{v: &n, want: "7"})
+	run("uint8", test{v: uint8(255), want: "255"})
+	run("float32", test{v: float32(1.5), want: "1.5"})
+	run("float64", test{v: 0.1, want: "0.1"})
+	run("float exponent", test{v: 1e21, want: "1e+21"})
+	run("nan", test{v: math.NaN(), want: "NaN"})
+	run("inf", test{v: math.Inf(1), want: "Infinity"})
+	run("negative inf", test{v: float32(math.Inf(-1)), want: "-Infinity"})
+	run("decimal", test{v: d, want: "-12345678901234567890.50"})
+	run("decimal pointer", test{v: &d, want: "-12345678901234567890.50"})
+	run("time", test{
+		v:    time.Date(2022, 1, 2, 3, 4, 5, 6000, time.FixedZone("", 3600)),
+		want: "2022-01-02 03:04:05.000006+01:00",
+	})
+	run("time utc", test{
+		v:    time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC),
+		want: "2022-01-02 03:04:05Z",
+	})
+	run("valuer", test{
+		v:    etlsql.Date{Time: time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)},
+		want: "2022-01-02",
+	})
+	run("valuer uuid", test{
+		v:    etlsql.UUID{0x12, 0x3e, 0x45, 0x67, 0xe8, 0x9b, 0x12, 0xd3, 0xa4, 0x56, 0x42, 0x66, 0x14, 0x17, 0x40, 0x00},
+		want: "123e4567-e89b-12d3-a456-426614174000",
+	})
+	run("valuer null", test{v: etlsql.JSON(nil), want: nil})
+	run("valuer error", test{v: errValuer{}, want: errValuer{}})
+}
+
+func TestCopyRowValues(t *testing.T) {
+	def := TableDef{Columns: []etlsql.ColDef{
+		{Name: "id", Type: etlsql.TypeBigInt},
+		{Name: "tags", Type: etlsql.TypeArray, Elem: etlsql.TypeVarchar, Nullable: true},
+		{Name: "nums", Type: etlsql.TypeArray, Elem: etlsql.TypeBigInt},
+	}}
+	rows := []etlsql.Row{
+		{drow.F("id", 1), drow.F("tags", []string{"a", `b"c`}), drow.F("nums", etlsql.Array[*int64]{nil})},
+		{drow.F("id", 2), drow.F[any]("tags", nil), drow.F("nums", []int64{})},
+	}
+	params, err := rowValues(def, rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make([]any, len(params))
+	for i, p := range params {
+		got[i] = copyValue(p)
+	}
+	want := []any{
+		"1", `{"a","b\"c"}`, "{NULL}",
+		"2", nil, "{}",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("copy values\nwant: %#v\n got: %#v", want, got)
+	}
+}
+
+func TestCheckBulkDriver(t *testing.T) {
+	if err := Dialect.CheckBulkDriver(&pq.Driver{}); err != nil {
+		t.Errorf("CheckBulkDriver(pq) = %v, want nil", err)
+	}
+	err := Dialect.CheckBulkDriver(fakeDriver{})
+	if !errors.Is(err, ErrCopyUnsupported) {
+		t.Errorf("CheckBulkDriver(fake) = %v, want %v", err, ErrCopyUnsupported)
+	}
+}
+
+type errValuer struct{}
+
+func (errValuer) Value() (driver.Value, error) { return nil, errors.New("fail") }
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) { return nil, errors.New("fake") }
@@ -0,0 +1,41 @@
+package psql
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/stdiopt/danda/etl/etlsql"
+)
+
+// AlterColumns changes the column types and drops NOT NULL constraints in
+// a single ALTER TABLE statement.
+func (d psql) AlterColumns(ctx context.Context, q etlsql.SQLExec, schema, name string, changes []etlsql.ColChange) error {
+	actions := []string{}
+	for _, ch := range changes {
+		if ch.TypeChanged() {
+			sqlType, _, _ := d.sqlType(ch.To)
+			if sqlType == "" {
+				return fmt.Errorf("field '%s' dialect.psql: unsupported type: %v", ch.To.Name, ch.To.Type)
+			}
+			actions = append(actions, fmt.Sprintf(`ALTER COLUMN "%s" TYPE %s`, ch.To.Name, sqlType))
+		}
+		if ch.NullChanged() {
+			actions = append(actions, fmt.Sprintf(`ALTER COLUMN "%s" DROP NOT NULL`, ch.To.Name))
+		}
+	}
+	if len(actions) == 0 {
+		return nil
+	}
+
+	var qry string
+	if schema == "" {
+		qry = fmt.Sprintf(`ALTER TABLE "%s" %s`, name, strings.Join(actions, ", "))
+	} else {
+		qry = fmt.Sprintf(`ALTER TABLE "%s"."%s" %s`, schema, name, strings.Join(actions, ", "))
+	}
+	if _, err := q.ExecContext(ctx, qry); err != nil {
+		return fmt.Errorf("alterColumns failed: %w: %s", err, qry)
+	}
+	return nil
+}
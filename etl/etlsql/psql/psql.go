@@ -6,6 +6,7 @@ import (
 	"database/sql"
 	"fmt"
 	"reflect"
+	"strings"
 	"time"
 
 	"github.com/cockroachdb/apd"
@@ -84,11 +85,14 @@ func (d psql) CreateTable(ctx context.Context, q etlsql.SQLExec, schema, name st
 		}
 
 		fmt.Fprintf(qry, "\t\"%s\" %s", c.Name, sqlType)
-		if i < len(def.Columns)-1 {
+		if i < len(def.Columns)-1 || len(def.PrimaryKey) > 0 {
 			qry.WriteRune(',')
 		}
 		qry.WriteRune('\n')
 	}
+	if len(def.PrimaryKey) > 0 {
+		fmt.Fprintf(qry, "\tPRIMARY KEY (\"%s\")\n", strings.Join(def.PrimaryKey, `", "`))
+	}
 	qry.WriteString(")\n")
 
 	_, err := q.ExecContext(ctx, qry.String(), params...)
@@ -132,6 +136,36 @@ func (d psql) AddColumns(ctx context.Context, q etlsql.SQLExec, schema, name str
 }
 
 func (d psql) Insert(ctx context.Context, db etlsql.SQLExec, schema, name string, def TableDef, rows []etlsql.Row) error {
+	return d.insertBatches(ctx, db, schema, name, def, rows, "")
+}
+
+// Upsert inserts the rows with an ON CONFLICT clause on the upsert keys.
+func (d psql) Upsert(ctx context.Context, db etlsql.SQLExec, schema, name string, def TableDef, rows []etlsql.Row, up etlsql.Upsert) error {
+	conflict := &bytes.Buffer{}
+	fmt.Fprintf(conflict, " ON CONFLICT (%s)", strings.Join(up.Keys, ", "))
+	updates := up.Updates(def)
+	if len(updates) == 0 {
+		conflict.WriteString(" DO NOTHING")
+		return d.insertBatches(ctx, db, schema, name, def, rows, conflict.String())
+	}
+	conflict.WriteString(" DO UPDATE SET ")
+	for i, c := range updates {
+		if i > 0 {
+			conflict.WriteString(", ")
+		}
+		switch up.Strategy(c.Name) {
+		case etlsql.UpdateCoalesce:
+			fmt.Fprintf(conflict, `%[1]s = COALESCE(EXCLUDED.%[1]s, "%[2]s".%[1]s)`, c.Name, name)
+		default:
+			fmt.Fprintf(conflict, "%[1]s = EXCLUDED.%[1]s", c.Name)
+		}
+	}
+	return d.insertBatches(ctx, db, schema, name, def, rows, conflict.String())
+}
+
+// insertBatches inserts the rows in batches limited by the max number of
+// params, suffix is appended to each insert statement.
+func (d psql) insertBatches(ctx context.Context, db etlsql.SQLExec, schema, name string, def TableDef, rows []etlsql.Row, suffix string) error {
 	// some psql engines allows max 64k params per query but to be safe we
 	// will use 32k, eventually we can use a config to set this value
 	maxParams := 32767
@@ -146,22 +180,51 @@ func (d psql) Insert(ctx context.Context, db etlsql.SQLExec, schema, name string
 		}
 		offs := offset
 		eg.Go(func() error {
-			return d.insert(ctx, db, schema, name, def, rows[offs:end])
+			return d.insert(ctx, db, schema, name, def, rows[offs:end], suffix)
 		})
 	}
 	return eg.Wait()
 }
 
 func (d psql) ColumnGoType(ct *sql.ColumnType) (reflect.Type, error) {
-	switch ct.DatabaseTypeName() {
+	name := ct.DatabaseTypeName()
+	switch name {
 	case "NUMERIC":
 		return apdDecimalTyp, nil
-	default:
-		return etlsql.ColumnGoTypeDef(ct)
+	case "DATE":
+		return dateTyp, nil
+	case "TIME", "TIMETZ":
+		return timeOfDayTyp, nil
+	case "BYTEA":
+		return bytesTyp, nil
+	case "JSON", "JSONB":
+		return jsonTyp, nil
+	case "UUID":
+		return uuidTyp, nil
+	case "INTERVAL":
+		return intervalTyp, nil
+	}
+	// array types are named by the element type prefixed with _
+	if strings.HasPrefix(name, "_") {
+		switch name[1:] {
+		case "INT2", "INT4", "INT8":
+			return reflect.TypeOf(etlsql.Array[int64]{}), nil
+		case "FLOAT4", "FLOAT8":
+			return reflect.TypeOf(etlsql.Array[float64]{}), nil
+		case "NUMERIC":
+			return reflect.TypeOf(etlsql.Array[apd.Decimal]{}), nil
+		case "BOOL":
+			return reflect.TypeOf(etlsql.Array[bool]{}), nil
+		case "JSON", "JSONB":
+			return reflect.TypeOf(etlsql.Array[etlsql.JSON]{}), nil
+		default:
+			return reflect.TypeOf(etlsql.Array[string]{}), nil
+		}
 	}
+	return etlsql.ColumnGoTypeDef(ct)
 }
 
-func (d psql) insert(ctx context.Context, q etlsql.SQLExec, schema, name string, def TableDef, rows []etlsql.Row) error {
+func (d psql) insert(ctx context.Context, q etlsql.SQLExec, schema, name string, def TableDef, rows []etlsql.Row, suffix string) error {
 	qryBuf := &bytes.Buffer{}
 	var insQ string
 	if schema == "" {
@@ -186,8 +249,12 @@ func (d psql) insert(ctx context.Context, q etlsql.SQLExec, schema, name string,
 		}
 	}
 	qryBuf.WriteString(")")
+	qryBuf.WriteString(suffix)
 
-	params := def.RowValues(rows)
+	params, err := rowValues(def, rows)
+	if err != nil {
+		return err
+	}
 	if _, err := q.ExecContext(ctx, qryBuf.String(), params...); err != nil {
 		return fmt.Errorf("insert failed: %w, %s", err, insQ)
 	}
@@ -197,6 +264,12 @@ func (d psql) insert(ctx context.Context, q etlsql.SQLExec, schema, name string,
 var (
 	timeTyp       = reflect.TypeOf(time.Time{})
 	apdDecimalTyp = reflect.TypeOf(apd.Decimal{})
+	bytesTyp      = reflect.TypeOf([]byte{})
+	dateTyp       = reflect.TypeOf(etlsql.Date{})
+	timeOfDayTyp  = reflect.TypeOf(etlsql.TimeOfDay(0))
+	intervalTyp   = reflect.TypeOf(etlsql.Interval(0))
+	uuidTyp       = reflect.TypeOf(etlsql.UUID{})
+	jsonTyp       = reflect.TypeOf(etlsql.JSON{})
 )
 
 func (d *psql) columnSQLTypeName(c ColDef) (string, error) {
@@ -206,10 +279,27 @@ func (d *psql) columnSQLTypeName(c ColDef) (string, error) {
 
 	ftyp := c.Type
 
-	nullable := c.Nullable
+	sqlType, def, nullable := d.sqlType(c)
+
+	if sqlType == "" {
+		return "", fmt.Errorf("dialect.psql: unsupported type: %v", ftyp)
+	}
 
-	var sqlType string
-	var def string
+	var e string
+	sqlNull := "NULL"
+	if !nullable {
+		sqlNull = "NOT NULL"
+		if def != "" {
+			e = def
+		}
+	}
+	return fmt.Sprintf("%s %s %s", sqlType, sqlNull, e), nil
+}
+
+// sqlType returns the sql type of the column and its default value, some
+// types are always nullable.
+func (d *psql) sqlType(c ColDef) (sqlType, def string, nullable bool) {
+	nullable = c.Nullable
 	switch c.Type {
 	case etlsql.TypeBoolean:
 		sqlType, def = "boolean", "DEFAULT false"
@@ -240,23 +330,26 @@ func (d *psql) columnSQLTypeName(c ColDef) (string, error) {
 		sqlType = "timestamp"
 	case etlsql.TypeDecimal:
 		def = "DEFAULT 0.0"
+		// without precision the decimal is unconstrained
 		sqlType = "decimal"
-		if c.Scale != 0 {
-			sqlType += fmt.Sprintf("(10,%d)", c.Scale)
-		}
-	}
-
-	if sqlType == "" {
-		return "", fmt.Errorf("dialect.psql: unsupported type: %v", ftyp)
-	}
-
-	var e string
-	sqlNull := "NULL"
-	if !nullable {
-		sqlNull = "NOT NULL"
-		if def != "" {
-			e = def
+		if p, s := c.DecimalSize(); p > 0 {
+			sqlType += fmt.Sprintf("(%d,%d)", p, s)
 		}
+	case etlsql.TypeDate:
+		nullable = true
+		sqlType = "date"
+	case etlsql.TypeTime:
+		sqlType, def = "time", "DEFAULT '00:00:00'"
+	case etlsql.TypeBlob:
+		sqlType, def = "bytea", "DEFAULT ''"
+	case etlsql.TypeJSON:
+		sqlType, def = "jsonb", "DEFAULT 'null'"
+	case etlsql.TypeUUID:
+		sqlType, def = "uuid", "DEFAULT '00000000-0000-0000-0000-000000000000'"
+	case etlsql.TypeInterval:
+		sqlType, def = "interval", "DEFAULT '0'"
+	case etlsql.TypeArray:
+		sqlType, def = arrayElemSQLType(c.Elem)+"[]", "DEFAULT '{}'"
 	}
-	return fmt.Sprintf("%s %s %s", sqlType, sqlNull, e), nil
+	return sqlType, def, nullable
 }
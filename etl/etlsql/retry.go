@@ -0,0 +1,40 @@
+package etlsql
+
+import (
+	"errors"
+
+	"github.com/stdiopt/danda/etl"
+)
+
+// RetryClassifier is implemented by dialects that recognize the driver
+// errors worth retrying a transaction, as lock wait timeouts and deadlocks.
+type RetryClassifier interface {
+	Retryable(err error) bool
+}
+
+// Retryable reports if a transaction that failed with err is worth
+// retrying, it is the default classifier of WithRetry. Network errors,
+// errors marked with etl.Transient, serialization failures and the errors
+// classified by the dialect are retryable.
+func (d DB) Retryable(err error) bool {
+	if etl.Retryable(err) || IsSerializationError(err) {
+		return true
+	}
+	rc, ok := d.dialect.(RetryClassifier)
+	return ok && rc.Retryable(err)
+}
+
+// IsSerializationError reports if err has the SQLSTATE 40001 of
+// serialization failures or 40P01 of deadlocks, for drivers with errors
+// implementing SQLState as lib/pq and pgx.
+func IsSerializationError(err error) bool {
+	var serr interface{ SQLState() string }
+	if !errors.As(err, &serr) {
+		return false
+	}
+	switch serr.SQLState() {
+	case "40001", "40P01":
+		return true
+	}
+	return false
+}
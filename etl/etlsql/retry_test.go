@@ -0,0 +1,42 @@
+package etlsql
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+	"testing"
+)
+
+func TestDBRetryable(t *testing.T) {
+	type test struct {
+		err  error
+		want bool
+	}
+	db := DB{dialect: lockDialect{}}
+	run := func(name string, tt test) {
+		t.Helper()
+		t.Run(name, func(t *testing.T) {
+			if got := db.Retryable(tt.err); got != tt.want {
+				t.Errorf("Retryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+	run("plain error", test{err: errors.New("fail"), want: false})
+	run("network error", test{err: fmt.Errorf("exec: %w", syscall.ECONNRESET), want: true})
+	run("serialization failure", test{err: fmt.Errorf("exec: %w", stateError("40001")), want: true})
+	run("deadlock", test{err: stateError("40P01"), want: true})
+	run("unique violation", test{err: stateError("23505"), want: false})
+	run("dialect lock error", test{err: fmt.Errorf("exec: %w", errLock), want: true})
+}
+
+type stateError string
+
+func (e stateError) Error() string    { return "sqlstate " + string(e) }
+func (e stateError) SQLState() string { return string(e) }
+
+var errLock = errors.New("lock wait timeout")
+
+// lockDialect is a dialect that only classifies errors.
+type lockDialect struct{ Dialect }
+
+func (lockDialect) Retryable(err error) bool { return errors.Is(err, errLock) }
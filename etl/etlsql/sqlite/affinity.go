@@ -0,0 +1,53 @@
+package sqlite
+
+import "strings"
+
+// Affinity is the SQLite type affinity of a column, the storage class
+// preferred for its values.
+type Affinity int
+
+const (
+	AffinityBlob Affinity = iota
+	AffinityText
+	AffinityNumeric
+	AffinityInteger
+	AffinityReal
+)
+
+func (a Affinity) String() string {
+	switch a {
+	case AffinityBlob:
+		return "blob"
+	case AffinityText:
+		return "text"
+	case AffinityNumeric:
+		return "numeric"
+	case AffinityInteger:
+		return "integer"
+	case AffinityReal:
+		return "real"
+	}
+	return "unknown"
+}
+
+// TypeAffinity returns the affinity of a declared column type following
+// the SQLite rules in order, so "FLOATING POINT" has integer affinity since
+// it contains "INT".
+func TypeAffinity(decl string) Affinity {
+	decl = strings.ToUpper(decl)
+	switch {
+	case strings.Contains(decl, "INT"):
+		return AffinityInteger
+	case strings.Contains(decl, "CHAR"),
+		strings.Contains(decl, "CLOB"),
+		strings.Contains(decl, "TEXT"):
+		return AffinityText
+	case strings.Contains(decl, "BLOB"), strings.TrimSpace(decl) == "":
+		return AffinityBlob
+	case strings.Contains(decl, "REAL"),
+		strings.Contains(decl, "FLOA"),
+		strings.Contains(decl, "DOUB"):
+		return AffinityReal
+	}
+	return AffinityNumeric
+}
@@ -0,0 +1,41 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/stdiopt/danda/etl/etlsql"
+)
+
+func (sqlite) CreateCheckpoints(ctx context.Context, db etlsql.SQLExec) error {
+	qry := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS "%s" (
+	"name" VARCHAR(255) PRIMARY KEY,
+	"position" TEXT NOT NULL,
+	"updated_at" TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+)`, etlsql.CheckpointTable)
+	if _, err := db.ExecContext(ctx, qry); err != nil {
+		return fmt.Errorf("createCheckpoints failed: %w", err)
+	}
+	return nil
+}
+
+func (sqlite) LoadCheckpoint(ctx context.Context, db etlsql.SQLQuery, name string) (string, error) {
+	qry := fmt.Sprintf(`SELECT "position" FROM "%s" WHERE "name" = ?`, etlsql.CheckpointTable)
+	var pos string
+	err := db.QueryRowContext(ctx, qry, name).Scan(&pos)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return pos, err
+}
+
+func (sqlite) SaveCheckpoint(ctx context.Context, db etlsql.SQLExec, name, pos string) error {
+	qry := fmt.Sprintf(`INSERT INTO "%s" ("name", "position") VALUES (?, ?)
+	ON CONFLICT ("name") DO UPDATE SET "position" = excluded."position", "updated_at" = CURRENT_TIMESTAMP`,
+		etlsql.CheckpointTable,
+	)
+	_, err := db.ExecContext(ctx, qry, name, pos)
+	return err
+}
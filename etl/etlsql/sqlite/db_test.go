@@ -0,0 +1,209 @@
+package sqlite
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/apd"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stdiopt/danda/drow"
+	"github.com/stdiopt/danda/etl"
+	"github.com/stdiopt/danda/etl/etldrow"
+	"github.com/stdiopt/danda/etl/etlsql"
+)
+
+func openDB(t *testing.T) etlsql.DB {
+	t.Helper()
+	db := etlsql.Open(Dialect, "sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err := db.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestInsertQuery(t *testing.T) {
+	db := openDB(t)
+	ctx := context.Background()
+	at := time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)
+	dec := func(s string) apd.Decimal {
+		d, _, err := apd.NewFromString(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return *d
+	}
+	note := "x"
+	row := func(id int64, name, amount string, note *string) drow.Row {
+		return drow.Row{
+			drow.F("id", id),
+			drow.F("name", name),
+			drow.F("amount", dec(amount)),
+			drow.F("at", at),
+			drow.F("active", true),
+			drow.F("note", note),
+		}
+	}
+
+	err := db.Insert(etl.Values(
+		row(1, "a", "1.5", &note),
+		row(2, "b", "20.25", nil),
+		row(3, "c", "3", nil),
+	), "", "users",
+		etlsql.WithDDLSync(etlsql.DDLCreate),
+		etlsql.WithBatchSize(2),
+		etlsql.WithUpsert("id"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	def, err := Dialect.TableDef(ctx, db.Q(), "", "users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantDef := etlsql.TableDef{
+		Columns: []etlsql.ColDef{
+			{Name: "id", Type: etlsql.TypeBigInt},
+			{Name: "name", Type: etlsql.TypeVarchar, Length: 1},
+			{Name: "amount", Type: etlsql.TypeDecimal, Precision: 10, Scale: 2},
+			{Name: "at", Type: etlsql.TypeTimestamp, Nullable: true},
+			{Name: "active", Type: etlsql.TypeBoolean},
+			{Name: "note", Type: etlsql.TypeVarchar, Length: 1, Nullable: true},
+		},
+		PrimaryKey: []string{"id"},
+	}
+	if !reflect.DeepEqual(def, wantDef) {
+		t.Errorf("wrong table def\nwant: %#v\n got: %#v", wantDef, def)
+	}
+
+	// updates the row with the same key and adds a column
+	upd := append(row(2, "B", "2", nil), drow.F("email", "b@x"))
+	err = db.Insert(etl.Values(upd), "", "users",
+		etlsql.WithDDLSync(etlsql.DDLAddColumns),
+		etlsql.WithUpsert("id"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := etl.Collect[drow.Row](db.Query(`SELECT * FROM "users" ORDER BY "id"`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// nullable values are scanned as typed nil pointers or plain values
+	// and added columns are not null with the type default
+	want := []drow.Row{
+		append(row(1, "a", "1.5", nil), drow.F("email", "")),
+		upd,
+		append(row(3, "c", "3", nil), drow.F("email", "")),
+	}
+	want[0][5].Value = note
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong rows\nwant: %v\n got: %v", want, got)
+	}
+}
+
+func TestEvolveNotNull(t *testing.T) {
+	db := openDB(t)
+	ctx := context.Background()
+	err := db.Insert(etl.Values(
+		drow.Row{drow.F("id", 1), drow.F("name", "a")},
+	), "", "t", etlsql.WithDDLSync(etlsql.DDLCreate))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the column stays not null and nulls are written as the zero value
+	err = db.Insert(etl.Values(
+		drow.Row{drow.F("id", 2), drow.F[any]("name", nil)},
+		drow.Row{drow.F("id", 3), drow.F("name", "a long name")},
+	), "", "t", etlsql.WithDDLSync(etlsql.DDLEvolve))
+	if err != nil {
+		t.Fatal(err)
+	}
+	def, err := Dialect.TableDef(ctx, db.Q(), "", "t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := def.Columns[1]; c.Nullable {
+		t.Errorf("column %q is nullable, want not null", c.Name)
+	}
+	got, err := etl.Collect[drow.Row](db.Query(`SELECT "name" FROM "t" ORDER BY "id"`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []drow.Row{
+		{drow.F("name", "a")},
+		{drow.F("name", "")},
+		{drow.F("name", "a long name")},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong rows\nwant: %v\n got: %v", want, got)
+	}
+}
+
+func TestCheckpoints(t *testing.T) {
+	db := openDB(t)
+	ctx := context.Background()
+	cps := db.Checkpoints()
+	if pos, err := cps.Load(ctx, "src"); err != nil || pos != "" {
+		t.Fatalf("Load() = %q, %v, want empty", pos, err)
+	}
+	for _, pos := range []string{"1", "2"} {
+		if err := cps.Save(ctx, "src", pos); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if pos, err := cps.Load(ctx, "src"); err != nil || pos != "2" {
+		t.Errorf("Load() = %q, %v, want 2", pos, err)
+	}
+}
+
+func TestCreateFromSchema(t *testing.T) {
+	db := openDB(t)
+	ctx := context.Background()
+	schema := drow.NewSchema(
+		drow.FieldSchema{Name: "id", Type: drow.TypeInt},
+		drow.FieldSchema{Name: "name", Type: drow.TypeString, Length: 5},
+		drow.FieldSchema{Name: "score", Type: drow.TypeFloat, Nullable: true},
+		drow.FieldSchema{Name: "active", Type: drow.TypeBool},
+		drow.FieldSchema{Name: "at", Type: drow.TypeTime, Nullable: true},
+	)
+	def, err := etlsql.DefFromSchema(schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Dialect.CreateTable(ctx, db.Q(), "", "items", def); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Dialect.TableDef(ctx, db.Q(), "", "items")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, def) {
+		t.Errorf("wrong table def\nwant: %#v\n got: %#v", def, got)
+	}
+
+	// csv rows are coerced by the schema and inserted without ddl changes
+	csv := []drow.Row{
+		{drow.F("id", "1"), drow.F("name", "abc"), drow.F("score", "7.5"), drow.F("active", "true"), drow.F("at", "2022-01-02")},
+		{drow.F("id", "2"), drow.F("name", "de"), drow.F("score", ""), drow.F("active", "false"), drow.F("at", "")},
+	}
+	if err := db.Insert(etldrow.Coerce(etl.Values(csv...), schema, nil), "", "items"); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := etl.Collect[drow.Row](db.Query(`SELECT * FROM "items" ORDER BY "id"`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	score, at := 7.5, time.Date(2022, 1, 2, 0, 0, 0, 0, time.UTC)
+	want := []drow.Row{
+		{drow.F("id", int64(1)), drow.F("name", "abc"), drow.F("score", score), drow.F("active", true), drow.F("at", at)},
+		{drow.F("id", int64(2)), drow.F("name", "de"), drow.F("score", (*float64)(nil)), drow.F("active", false), drow.F("at", (*time.Time)(nil))},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("wrong rows\nwant: %v\n got: %v", want, rows)
+	}
+}
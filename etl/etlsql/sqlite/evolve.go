@@ -0,0 +1,20 @@
+package sqlite
+
+import (
+	"context"
+
+	"github.com/stdiopt/danda/etl/etlsql"
+)
+
+// AlterColumns accepts type changes without altering the table since any
+// SQLite column holds values of any type and length.
+// Columns can't become nullable without rebuilding the table so they stay
+// not null and nulls are written as the zero value as with DDLAddColumns.
+func (d sqlite) AlterColumns(ctx context.Context, q etlsql.SQLExec, schema, name string, changes []etlsql.ColChange) error {
+	for i, ch := range changes {
+		if ch.NullChanged() {
+			changes[i].To.Nullable = false
+		}
+	}
+	return nil
+}
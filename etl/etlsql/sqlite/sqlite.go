@@ -0,0 +1,413 @@
+package sqlite
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/apd"
+	"github.com/stdiopt/danda/drow"
+	"github.com/stdiopt/danda/etl/etlsql"
+)
+
+type (
+	Row      = drow.Row
+	TableDef = etlsql.TableDef
+	ColDef   = etlsql.ColDef
+)
+
+var Dialect = sqlite{}
+
+type sqlite struct{}
+
+func (sqlite) String() string { return "sqlite" }
+
+// TableDef loads the columns with pragma_table_info, schema is the name of
+// an attached database.
+func (d sqlite) TableDef(ctx context.Context, q etlsql.SQLQuery, schema, name string) (TableDef, error) {
+	qry := `SELECT "name", "type", "notnull", "pk" FROM pragma_table_info(?) ORDER BY "cid"`
+	args := []any{name}
+	if schema != "" {
+		qry = `SELECT "name", "type", "notnull", "pk" FROM pragma_table_info(?, ?) ORDER BY "cid"`
+		args = append(args, schema)
+	}
+	rows, err := q.QueryContext(ctx, qry, args...)
+	if err != nil {
+		return TableDef{}, fmt.Errorf("fetch columns: %w", err)
+	}
+	defer rows.Close()
+
+	def := TableDef{}
+	pks := map[int]string{}
+	for rows.Next() {
+		var colName, decl string
+		var notNull bool
+		var pk int
+		if err := rows.Scan(&colName, &decl, &notNull, &pk); err != nil {
+			return TableDef{}, fmt.Errorf("fetch columns: %w", err)
+		}
+		c := colType(decl)
+		c.Name = colName
+		c.Nullable = !notNull
+		def.Columns = append(def.Columns, c)
+		if pk > 0 {
+			pks[pk] = colName
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return TableDef{}, fmt.Errorf("fetch columns: %w", err)
+	}
+	for i := 1; i <= len(pks); i++ {
+		def.PrimaryKey = append(def.PrimaryKey, pks[i])
+	}
+	return def, nil
+}
+
+func (d sqlite) CreateTable(ctx context.Context, q etlsql.SQLExec, schema, name string, def TableDef) error {
+	qry := &bytes.Buffer{}
+	fmt.Fprintf(qry, "CREATE TABLE IF NOT EXISTS %s (\n", tableName(schema, name))
+	for i, c := range def.Columns {
+		sqlType, err := d.columnSQLTypeName(c)
+		if err != nil {
+			return fmt.Errorf("field '%s' %w", c.Name, err)
+		}
+
+		fmt.Fprintf(qry, "\t\"%s\" %s", c.Name, sqlType)
+		if i < len(def.Columns)-1 || len(def.PrimaryKey) > 0 {
+			qry.WriteRune(',')
+		}
+		qry.WriteRune('\n')
+	}
+	if len(def.PrimaryKey) > 0 {
+		fmt.Fprintf(qry, "\tPRIMARY KEY (%s)\n", columnList(def.PrimaryKey))
+	}
+	qry.WriteString(")\n")
+
+	if _, err := q.ExecContext(ctx, qry.String()); err != nil {
+		return fmt.Errorf("sqlite: createTable failed: %w: %v", err, qry.String())
+	}
+	return nil
+}
+
+func (d sqlite) AddColumns(ctx context.Context, q etlsql.SQLExec, schema, name string, def TableDef) error {
+	for _, col := range def.Columns {
+		sqlType, err := d.columnSQLTypeName(col)
+		if err != nil {
+			return fmt.Errorf("field '%s' %w", col.Name, err)
+		}
+		qry := fmt.Sprintf(`ALTER TABLE %s ADD COLUMN "%s" %s`,
+			tableName(schema, name),
+			col.Name, sqlType,
+		)
+		if _, err := q.ExecContext(ctx, qry); err != nil {
+			return fmt.Errorf("addColumns failed: %w: %s", err, qry)
+		}
+	}
+	return nil
+}
+
+func (d sqlite) Insert(ctx context.Context, db etlsql.SQLExec, schema, name string, def TableDef, rows []etlsql.Row) error {
+	return d.insertBatches(ctx, db, schema, name, def, rows, "")
+}
+
+// Upsert inserts the rows with an ON CONFLICT clause on the upsert keys.
+func (d sqlite) Upsert(ctx context.Context, db etlsql.SQLExec, schema, name string, def TableDef, rows []etlsql.Row, up etlsql.Upsert) error {
+	conflict := &bytes.Buffer{}
+	fmt.Fprintf(conflict, " ON CONFLICT (%s)", columnList(up.Keys))
+	updates := up.Updates(def)
+	if len(updates) == 0 {
+		conflict.WriteString(" DO NOTHING")
+		return d.insertBatches(ctx, db, schema, name, def, rows, conflict.String())
+	}
+	conflict.WriteString(" DO UPDATE SET ")
+	for i, c := range updates {
+		if i > 0 {
+			conflict.WriteString(", ")
+		}
+		switch up.Strategy(c.Name) {
+		case etlsql.UpdateCoalesce:
+			fmt.Fprintf(conflict, `"%[1]s" = COALESCE(excluded."%[1]s", "%[1]s")`, c.Name)
+		default:
+			fmt.Fprintf(conflict, `"%[1]s" = excluded."%[1]s"`, c.Name)
+		}
+	}
+	return d.insertBatches(ctx, db, schema, name, def, rows, conflict.String())
+}
+
+// insertBatches inserts the rows in sequential batches limited by the max
+// number of params, suffix is appended to each insert statement.
+func (d sqlite) insertBatches(ctx context.Context, db etlsql.SQLExec, schema, name string, def TableDef, rows []etlsql.Row, suffix string) error {
+	// SQLITE_MAX_VARIABLE_NUMBER defaults to 999 before 3.32
+	maxParams := 999
+
+	maxRows := maxParams / len(def.Columns)
+	if maxRows == 0 {
+		maxRows = 1
+	}
+	for offset := 0; offset < len(rows); offset += maxRows {
+		end := offset + maxRows
+		if end > len(rows) {
+			end = len(rows)
+		}
+		if err := d.insert(ctx, db, schema, name, def, rows[offset:end], suffix); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d sqlite) insert(ctx context.Context, q etlsql.SQLExec, schema, name string, def TableDef, rows []etlsql.Row, suffix string) error {
+	qryBuf := &bytes.Buffer{}
+	cols := make([]string, len(def.Columns))
+	for i, c := range def.Columns {
+		cols[i] = c.Name
+	}
+	insQ := fmt.Sprintf(`INSERT INTO %s (%s) VALUES `, tableName(schema, name), columnList(cols))
+	qryBuf.WriteString(insQ)
+	for i := 0; i < len(rows); i++ {
+		if i != 0 {
+			qryBuf.WriteString("),\n")
+		}
+		qryBuf.WriteString("(")
+		for ri := range def.Columns {
+			if ri > 0 {
+				qryBuf.WriteString(", ")
+			}
+			qryBuf.WriteString("?")
+		}
+	}
+	qryBuf.WriteString(")")
+	qryBuf.WriteString(suffix)
+
+	params := def.RowValues(rows)
+	if _, err := q.ExecContext(ctx, qryBuf.String(), params...); err != nil {
+		return fmt.Errorf("insert failed: %w, %s", err, insQ)
+	}
+	return nil
+}
+
+// ColumnGoType returns the go type of the column declared type, values are
+// scanned by their affinity since SQLite stores any value in any column.
+func (d sqlite) ColumnGoType(ct *sql.ColumnType) (reflect.Type, error) {
+	return goType(ct.DatabaseTypeName()), nil
+}
+
+var (
+	anyTyp        = reflect.TypeOf((*any)(nil)).Elem()
+	boolTyp       = reflect.TypeOf(false)
+	bytesTyp      = reflect.TypeOf([]byte{})
+	float64Typ    = reflect.TypeOf(float64(0))
+	int64Typ      = reflect.TypeOf(int64(0))
+	stringTyp     = reflect.TypeOf("")
+	timeTyp       = reflect.TypeOf(time.Time{})
+	apdDecimalTyp = reflect.TypeOf(apd.Decimal{})
+	dateTyp       = reflect.TypeOf(etlsql.Date{})
+	timeOfDayTyp  = reflect.TypeOf(etlsql.TimeOfDay(0))
+	intervalTyp   = reflect.TypeOf(etlsql.Interval(0))
+	uuidTyp       = reflect.TypeOf(etlsql.UUID{})
+	jsonTyp       = reflect.TypeOf(etlsql.JSON{})
+)
+
+func goType(decl string) reflect.Type {
+	switch colType(decl).Type {
+	case etlsql.TypeBoolean:
+		return boolTyp
+	case etlsql.TypeTimestamp:
+		return timeTyp
+	case etlsql.TypeDecimal:
+		return apdDecimalTyp
+	case etlsql.TypeDate:
+		return dateTyp
+	case etlsql.TypeTime:
+		return timeOfDayTyp
+	case etlsql.TypeJSON:
+		return jsonTyp
+	case etlsql.TypeUUID:
+		return uuidTyp
+	case etlsql.TypeInterval:
+		return intervalTyp
+	}
+	switch TypeAffinity(decl) {
+	case AffinityInteger:
+		return int64Typ
+	case AffinityText:
+		return stringTyp
+	case AffinityReal:
+		return float64Typ
+	case AffinityNumeric:
+		return apdDecimalTyp
+	}
+	if decl == "" {
+		return anyTyp
+	}
+	return bytesTyp
+}
+
+// colType returns the column of a declared type with the type arguments,
+// types that aren't known are solved by their affinity.
+func colType(decl string) ColDef {
+	name, args := splitDecl(decl)
+	switch name {
+	case "BOOLEAN", "BOOL":
+		return ColDef{Type: etlsql.TypeBoolean}
+	case "TINYINT", "SMALLINT", "INT2":
+		return ColDef{Type: etlsql.TypeSmallInt}
+	case "UNSIGNED SMALLINT":
+		return ColDef{Type: etlsql.TypeUnsignedSmallInt}
+	case "INT", "INTEGER", "MEDIUMINT":
+		return ColDef{Type: etlsql.TypeInteger}
+	case "UNSIGNED INTEGER", "UNSIGNED INT":
+		return ColDef{Type: etlsql.TypeUnsignedInteger}
+	case "BIGINT", "INT8":
+		return ColDef{Type: etlsql.TypeBigInt}
+	case "UNSIGNED BIG INT", "UNSIGNED BIGINT":
+		return ColDef{Type: etlsql.TypeUnsignedBigInt}
+	case "REAL", "FLOAT":
+		return ColDef{Type: etlsql.TypeReal}
+	case "DOUBLE", "DOUBLE PRECISION":
+		return ColDef{Type: etlsql.TypeDouble}
+	case "DATETIME", "TIMESTAMP":
+		return ColDef{Type: etlsql.TypeTimestamp}
+	case "DATE":
+		return ColDef{Type: etlsql.TypeDate}
+	case "TIME":
+		return ColDef{Type: etlsql.TypeTime}
+	case "BLOB":
+		return ColDef{Type: etlsql.TypeBlob}
+	case "JSON":
+		return ColDef{Type: etlsql.TypeJSON}
+	case "UUID":
+		return ColDef{Type: etlsql.TypeUUID}
+	case "INTERVAL":
+		return ColDef{Type: etlsql.TypeInterval}
+	case "DECIMAL", "NUMERIC":
+		c := ColDef{Type: etlsql.TypeDecimal}
+		if len(args) > 0 {
+			c.Precision, _ = strconv.Atoi(args[0])
+		}
+		if len(args) == 2 {
+			c.Scale, _ = strconv.Atoi(args[1])
+		}
+		return c
+	}
+	switch TypeAffinity(decl) {
+	case AffinityInteger:
+		return ColDef{Type: etlsql.TypeBigInt}
+	case AffinityText:
+		c := ColDef{Type: etlsql.TypeVarchar}
+		if len(args) > 0 {
+			c.Length, _ = strconv.ParseInt(args[0], 10, 64)
+		}
+		return c
+	case AffinityReal:
+		return ColDef{Type: etlsql.TypeDouble}
+	case AffinityNumeric:
+		return ColDef{Type: etlsql.TypeDecimal}
+	}
+	return ColDef{Type: etlsql.TypeUnknown}
+}
+
+// splitDecl splits a declared type as "VARCHAR(255)" in the upper case
+// name and arguments.
+func splitDecl(decl string) (string, []string) {
+	decl = strings.ToUpper(strings.TrimSpace(decl))
+	i := strings.IndexByte(decl, '(')
+	if i == -1 {
+		return strings.Join(strings.Fields(decl), " "), nil
+	}
+	name := strings.Join(strings.Fields(decl[:i]), " ")
+	args := strings.Split(strings.TrimSuffix(decl[i+1:], ")"), ",")
+	for j := range args {
+		args[j] = strings.TrimSpace(args[j])
+	}
+	return name, args
+}
+
+func (d sqlite) columnSQLTypeName(c ColDef) (string, error) {
+	if c.SQLType != "" {
+		return c.SQLType, nil
+	}
+
+	sqlType, def := declType(c)
+	if sqlType == "" {
+		return "", fmt.Errorf("dialect.sqlite: unsupported type: %v", c.Type)
+	}
+
+	var e string
+	sqlNull := "NULL"
+	// timestamps and dates have no default
+	if !c.Nullable && c.Type != etlsql.TypeTimestamp && c.Type != etlsql.TypeDate {
+		sqlNull = "NOT NULL"
+		e = def
+	}
+	return fmt.Sprintf("%s %s %s", sqlType, sqlNull, e), nil
+}
+
+// declType returns the declared type of a column and its default value,
+// colType reads it back as the same type.
+func declType(c ColDef) (string, string) {
+	switch c.Type {
+	case etlsql.TypeBoolean:
+		return "BOOLEAN", "DEFAULT 0"
+	case etlsql.TypeSmallInt:
+		return "SMALLINT", "DEFAULT 0"
+	case etlsql.TypeUnsignedSmallInt:
+		return "UNSIGNED SMALLINT", "DEFAULT 0"
+	case etlsql.TypeInteger:
+		return "INTEGER", "DEFAULT 0"
+	case etlsql.TypeUnsignedInteger:
+		return "UNSIGNED INTEGER", "DEFAULT 0"
+	case etlsql.TypeBigInt:
+		return "BIGINT", "DEFAULT 0"
+	case etlsql.TypeUnsignedBigInt:
+		return "UNSIGNED BIGINT", "DEFAULT 0"
+	case etlsql.TypeReal:
+		return "REAL", "DEFAULT 0.0"
+	case etlsql.TypeDouble:
+		return "DOUBLE", "DEFAULT 0.0"
+	case etlsql.TypeVarchar:
+		if c.Length > 0 {
+			return fmt.Sprintf("VARCHAR(%d)", c.Length), "DEFAULT ''"
+		}
+		return "TEXT", "DEFAULT ''"
+	case etlsql.TypeTimestamp:
+		return "TIMESTAMP", ""
+	case etlsql.TypeDecimal:
+		if p, s := c.DecimalSize(); p > 0 {
+			return fmt.Sprintf("DECIMAL(%d,%d)", p, s), "DEFAULT 0.0"
+		}
+		return "DECIMAL", "DEFAULT 0.0"
+	case etlsql.TypeDate:
+		return "DATE", ""
+	case etlsql.TypeTime:
+		return "TIME", "DEFAULT '00:00:00'"
+	case etlsql.TypeBlob:
+		return "BLOB", "DEFAULT x''"
+	case etlsql.TypeJSON:
+		return "JSON", "DEFAULT 'null'"
+	case etlsql.TypeUUID:
+		return "UUID", "DEFAULT '00000000-0000-0000-0000-000000000000'"
+	case etlsql.TypeInterval:
+		return "INTERVAL", "DEFAULT '00:00:00'"
+	case etlsql.TypeArray:
+		// arrays are stored as json
+		return "JSON", "DEFAULT '[]'"
+	}
+	return "", ""
+}
+
+func tableName(schema, name string) string {
+	if schema == "" {
+		return fmt.Sprintf(`"%s"`, name)
+	}
+	return fmt.Sprintf(`"%s"."%s"`, schema, name)
+}
+
+func columnList(cols []string) string {
+	return `"` + strings.Join(cols, `", "`) + `"`
+}
@@ -0,0 +1,85 @@
+package sqlite
+
+import (
+	"testing"
+
+	"github.com/stdiopt/danda/etl/etlsql"
+)
+
+func TestTypeAffinity(t *testing.T) {
+	tests := map[string]Affinity{
+		"INT":                 AffinityInteger,
+		"unsigned big int":    AffinityInteger,
+		"FLOATING POINT":      AffinityInteger,
+		"VARCHAR(255)":        AffinityText,
+		"NCHAR(55)":           AffinityText,
+		"CLOB":                AffinityText,
+		"BLOB":                AffinityBlob,
+		"":                    AffinityBlob,
+		"DOUBLE PRECISION":    AffinityReal,
+		"float":               AffinityReal,
+		"DECIMAL(10,5)":       AffinityNumeric,
+		"BOOLEAN":             AffinityNumeric,
+		"DATETIME":            AffinityNumeric,
+		"STRING":              AffinityNumeric,
+		"CHARINT":             AffinityInteger,
+		"TEXT COLLATE NOCASE": AffinityText,
+	}
+	for decl, want := range tests {
+		if got := TypeAffinity(decl); got != want {
+			t.Errorf("%q: wrong affinity\nwant: %v\n got: %v", decl, want, got)
+		}
+	}
+}
+
+func TestColType(t *testing.T) {
+	type test struct {
+		decl string
+		want etlsql.ColDef
+	}
+	run := func(name string, tt test) {
+		t.Helper()
+		t.Run(name, func(t *testing.T) {
+			if got := colType(tt.decl); !got.Eq(tt.want) {
+				t.Errorf("wrong type\nwant: %+v\n got: %+v", tt.want, got)
+			}
+		})
+	}
+	run("varchar length", test{decl: "varchar( 255 )", want: etlsql.ColDef{Type: etlsql.TypeVarchar, Length: 255}})
+	run("decimal scale", test{decl: "DECIMAL(10, 2)", want: etlsql.ColDef{Type: etlsql.TypeDecimal, Precision: 10, Scale: 2}})
+	run("known name", test{decl: "unsigned  bigint", want: etlsql.ColDef{Type: etlsql.TypeUnsignedBigInt}})
+	run("integer affinity", test{decl: "INT4", want: etlsql.ColDef{Type: etlsql.TypeBigInt}})
+	run("real affinity", test{decl: "FLOAT8", want: etlsql.ColDef{Type: etlsql.TypeDouble}})
+	run("numeric affinity", test{decl: "MONEY", want: etlsql.ColDef{Type: etlsql.TypeDecimal}})
+	run("blob", test{decl: "blob", want: etlsql.ColDef{Type: etlsql.TypeBlob}})
+	run("blob affinity", test{decl: "BYTES", want: etlsql.ColDef{Type: etlsql.TypeDecimal}})
+	run("no type", test{decl: "", want: etlsql.ColDef{Type: etlsql.TypeUnknown}})
+
+	// created columns are read back with the same type
+	for _, c := range []etlsql.ColDef{
+		{Type: etlsql.TypeBoolean},
+		{Type: etlsql.TypeSmallInt},
+		{Type: etlsql.TypeUnsignedSmallInt},
+		{Type: etlsql.TypeInteger},
+		{Type: etlsql.TypeUnsignedInteger},
+		{Type: etlsql.TypeBigInt},
+		{Type: etlsql.TypeUnsignedBigInt},
+		{Type: etlsql.TypeReal},
+		{Type: etlsql.TypeDouble},
+		{Type: etlsql.TypeVarchar, Length: 10},
+		{Type: etlsql.TypeTimestamp},
+		{Type: etlsql.TypeDecimal},
+		{Type: etlsql.TypeDecimal, Precision: 12, Scale: 2},
+		{Type: etlsql.TypeDate},
+		{Type: etlsql.TypeTime},
+		{Type: etlsql.TypeBlob},
+		{Type: etlsql.TypeJSON},
+		{Type: etlsql.TypeUUID},
+		{Type: etlsql.TypeInterval},
+	} {
+		decl, _ := declType(c)
+		if got := colType(decl); !got.Eq(c) {
+			t.Errorf("%v: declared as %q, read as %+v", c.Type, decl, got)
+		}
+	}
+}
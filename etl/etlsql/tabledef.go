@@ -3,6 +3,7 @@ package etlsql
 import (
 	"bytes"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"log"
 	"reflect"
@@ -11,6 +12,7 @@ import (
 
 	"github.com/cockroachdb/apd"
 	"github.com/stdiopt/danda/drow"
+	"github.com/stdiopt/danda/util/conv"
 )
 
 type Type int
@@ -29,9 +31,13 @@ const (
 	TypeVarchar               // string
 	TypeTimestamp             // time.Time
 	TypeBoolean               // bool
-	// TypeDate                         // time.Time
-	// TypeTime                         // time.Time
-	// TypeBlob                         // []byte
+	TypeDate                  // Date
+	TypeTime                  // TimeOfDay
+	TypeBlob                  // []byte
+	TypeJSON                  // JSON, maps, structs and drow.Row
+	TypeUUID                  // UUID
+	TypeInterval              // Interval
+	TypeArray                 // slices with ColDef.Elem elements
 )
 
 func (t Type) String() string {
@@ -62,6 +68,20 @@ func (t Type) String() string {
 		return "timestamp"
 	case TypeBoolean:
 		return "boolean"
+	case TypeDate:
+		return "date"
+	case TypeTime:
+		return "time"
+	case TypeBlob:
+		return "blob"
+	case TypeJSON:
+		return "json"
+	case TypeUUID:
+		return "uuid"
+	case TypeInterval:
+		return "interval"
+	case TypeArray:
+		return "array"
 	}
 	return "unknown"
 }
@@ -73,7 +93,11 @@ type ColDef struct {
 	Type     Type
 	Nullable bool
 	Length   int64 // for varchar and maybe other types
-	Scale    int   // Precision int ...
+	// Precision is the total number of digits of decimals, 0 is
+	// unconstrained.
+	Precision int
+	Scale     int  // digits after the decimal point
+	Elem      Type // element type of arrays
 	// Overrides for sql types
 	SQLType string // override
 }
@@ -83,7 +107,26 @@ func (c ColDef) Eq(c2 ColDef) bool {
 	return c.Name == c2.Name &&
 		c.Type == c2.Type &&
 		c.Length == c2.Length &&
-		c.Scale == c2.Scale
+		c.Precision == c2.Precision &&
+		c.Scale == c2.Scale &&
+		c.Elem == c2.Elem
+}
+
+// DefaultDecimalPrecision is the precision of decimal columns created with
+// a scale.
+const DefaultDecimalPrecision = 10
+
+// DecimalSize returns the precision and scale to declare a decimal column,
+// a precision is only declared when it is larger than the default or the
+// column has a scale, 0 keeps the dialect default decimal type.
+func (c ColDef) DecimalSize() (precision, scale int) {
+	switch {
+	case c.Precision > DefaultDecimalPrecision:
+		return c.Precision, c.Scale
+	case c.Scale != 0:
+		return DefaultDecimalPrecision, c.Scale
+	}
+	return 0, 0
 }
 
 // Zero returns the zero value for the column type.
@@ -107,15 +150,80 @@ func (c ColDef) Zero() any {
 		return time.Time{}
 	case TypeBoolean:
 		return false
-		// case TypeBlob:
-		//	return []byte{}
+	case TypeDate:
+		return Date{}
+	case TypeTime:
+		return TimeOfDay(0)
+	case TypeBlob:
+		return []byte{}
+	case TypeJSON:
+		return JSON("null")
+	case TypeUUID:
+		return UUID{}
+	case TypeInterval:
+		return Interval(0)
+	case TypeArray:
+		return []any{}
 	}
 	return nil
 }
 
+// Value returns v converted to the sql value of the column type, nulls of
+// non nullable columns are the zero value.
+func (c ColDef) Value(v any) any {
+	v = conv.Deref(v)
+	if v == nil {
+		if c.Nullable {
+			return nil
+		}
+		v = c.Zero()
+	}
+	switch c.Type {
+	case TypeDate:
+		if t, ok := v.(time.Time); ok {
+			return Date{t}
+		}
+	case TypeTime:
+		switch t := v.(type) {
+		case time.Time:
+			return TimeOfDayOf(t)
+		case time.Duration:
+			return TimeOfDay(t)
+		}
+	case TypeInterval:
+		if d, ok := v.(time.Duration); ok {
+			return Interval(d)
+		}
+	case TypeUUID:
+		if u, ok := v.([16]byte); ok {
+			return UUID(u)
+		}
+	case TypeJSON, TypeArray:
+		switch j := v.(type) {
+		case string:
+			return j
+		case []byte:
+			return string(j)
+		case json.RawMessage:
+			return string(j)
+		case JSON:
+			return string(j)
+		}
+		data, err := json.Marshal(v)
+		if err != nil {
+			// let the driver fail with the value
+			return v
+		}
+		return string(data)
+	}
+	return v
+}
+
 // TableDef represents an sql table definition.
 type TableDef struct {
 	Columns []ColDef
+	// PrimaryKey are the primary key columns used by CreateTable.
+	PrimaryKey []string
 }
 
 func NewTableDef(cols ...ColDef) TableDef {
@@ -124,6 +232,10 @@ func NewTableDef(cols ...ColDef) TableDef {
 	}
 }
 
+// maxDecimalPrecision is the largest precision of a constrained decimal,
+// as the postgres numeric limit.
+const maxDecimalPrecision = 1000
+
 type sqlTypeSolver func(*sql.ColumnType) (reflect.Type, error)
 
 func DefFromSQLTypes(typs []*sql.ColumnType, solverOpt ...sqlTypeSolver) (TableDef, error) {
@@ -142,16 +254,25 @@ func DefFromSQLTypes(typs []*sql.ColumnType, solverOpt ...sqlTypeSolver) (TableD
 		if n, ok := t.Length(); ok {
 			sz = n
 		}
+		// drivers report unconstrained decimals with invalid sizes as
+		// lib/pq does with 65535,65531 for numeric
+		var precision, scale int
+		if p, s, ok := t.DecimalSize(); ok && p <= maxDecimalPrecision && s <= p {
+			precision, scale = int(p), int(s)
+		}
 		nullable := false
 		if typ.Kind() == reflect.Ptr {
 			nullable = true
 		}
 		styp := typFromGo(typ)
 		cols = append(cols, ColDef{
-			Name:     t.Name(),
-			Type:     styp,
-			Nullable: nullable,
-			Length:   sz,
+			Name:      t.Name(),
+			Type:      styp,
+			Nullable:  nullable,
+			Length:    sz,
+			Precision: precision,
+			Scale:     scale,
+			Elem:      elemTypFromGo(typ),
 		})
 	}
 	ret := TableDef{
@@ -177,7 +298,8 @@ func (d TableDef) Get(colName string) (ColDef, bool) {
 
 func (d TableDef) WithColumns(col ...ColDef) TableDef {
 	clone := TableDef{
-		Columns: append([]ColDef{}, d.Columns...),
+		Columns:    append([]ColDef{}, d.Columns...),
+		PrimaryKey: d.PrimaryKey,
 	}
 	for _, c := range col {
 		i := clone.IndexOf(c.Name)
@@ -268,11 +390,7 @@ func (d TableDef) RowValues(rows []Row) []any {
 	for _, r := range rows {
 		for _, c := range d.Columns {
 			f := r.At(equalFold(c.Name))
-			v := f.Value
-			if !c.Nullable && v == nil {
-				v = c.Zero()
-			}
-			params = append(params, v)
+			params = append(params, c.Value(f.Value))
 		}
 	}
 	return params
@@ -285,6 +403,18 @@ func typFromGo(v any) Type {
 	} else {
 		typ = reflect.TypeOf(v)
 	}
+	switch typ {
+	case intervalTyp:
+		return TypeInterval
+	case dateTyp:
+		return TypeDate
+	case timeOfDayTyp:
+		return TypeTime
+	case uuidTyp, byteArray16Typ:
+		return TypeUUID
+	case jsonTyp, rawMessageTyp, rowTyp:
+		return TypeJSON
+	}
 	switch typ.Kind() {
 	case reflect.Ptr:
 		return typFromGo(typ.Elem())
@@ -314,16 +444,38 @@ func typFromGo(v any) Type {
 		return TypeVarchar
 	case reflect.Bool:
 		return TypeBoolean
+	case reflect.Slice:
+		if typ.Elem().Kind() == reflect.Uint8 {
+			return TypeBlob
+		}
+		return TypeArray
+	case reflect.Array:
+		return TypeArray
+	case reflect.Map:
+		return TypeJSON
 	case reflect.Struct:
-		if typ == reflect.TypeOf(time.Time{}) {
+		if typ == timeTyp {
 			return TypeTimestamp
 		}
-		if typ == reflect.TypeOf(apd.Decimal{}) {
+		if typ == apdDecimalTyp {
 			return TypeDecimal
 		}
+		return TypeJSON
+	case reflect.Interface:
+		return TypeUnknown
 	default:
 		log.Println("Unknown type", typ)
 		return TypeUnknown
 	}
-	return TypeUnknown
+}
+
+// elemTypFromGo returns the element type of array types.
+func elemTypFromGo(typ reflect.Type) Type {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typFromGo(typ) != TypeArray {
+		return TypeUnknown
+	}
+	return typFromGo(typ.Elem())
 }
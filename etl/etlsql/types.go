@@ -2,8 +2,12 @@ package etlsql
 
 import (
 	"database/sql"
+	"encoding/json"
 	"reflect"
 	"time"
+
+	"github.com/cockroachdb/apd"
+	"github.com/stdiopt/danda/drow"
 )
 
 var (
@@ -27,7 +31,16 @@ var (
 	timeTyp    = reflect.TypeOf(time.Time{})
 	stringTyp  = reflect.TypeOf("")
 
-	// apdDecimalTyp = reflect.TypeOf(apd.Decimal{})
+	apdDecimalTyp  = reflect.TypeOf(apd.Decimal{})
+	byteArray16Typ = reflect.TypeOf([16]byte{})
+	rawMessageTyp  = reflect.TypeOf(json.RawMessage{})
+	rowTyp         = reflect.TypeOf(drow.Row{})
+
+	dateTyp      = reflect.TypeOf(Date{})
+	timeOfDayTyp = reflect.TypeOf(TimeOfDay(0))
+	intervalTyp  = reflect.TypeOf(Interval(0))
+	uuidTyp      = reflect.TypeOf(UUID{})
+	jsonTyp      = reflect.TypeOf(JSON{})
 )
 
 func ColumnGoTypeDef(ct *sql.ColumnType) (reflect.Type, error) {
@@ -0,0 +1,115 @@
+package etlsql
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/stdiopt/danda/util/conv"
+)
+
+// UpdateStrategy is how an upsert updates a column of an existing row.
+type UpdateStrategy int
+
+const (
+	// UpdateOverwrite sets the column to the new value.
+	UpdateOverwrite UpdateStrategy = iota
+	// UpdateKeep keeps the existing value.
+	UpdateKeep
+	// UpdateCoalesce sets the column to the new value unless it is null.
+	UpdateCoalesce
+)
+
+func (s UpdateStrategy) String() string {
+	switch s {
+	case UpdateOverwrite:
+		return "overwrite"
+	case UpdateKeep:
+		return "keep"
+	case UpdateCoalesce:
+		return "coalesce"
+	}
+	return "unknown"
+}
+
+// Upsert describes how rows conflicting on the key columns are merged with
+// the existing rows.
+type Upsert struct {
+	Keys []string
+	// Default is the strategy of the columns not in Strategies.
+	Default    UpdateStrategy
+	Strategies map[string]UpdateStrategy
+}
+
+// IsKey tells if col is a key column.
+func (u Upsert) IsKey(col string) bool {
+	for _, k := range u.Keys {
+		if strings.EqualFold(k, col) {
+			return true
+		}
+	}
+	return false
+}
+
+// Strategy returns the update strategy of col.
+func (u Upsert) Strategy(col string) UpdateStrategy {
+	for c, s := range u.Strategies {
+		if strings.EqualFold(c, col) {
+			return s
+		}
+	}
+	return u.Default
+}
+
+// Updates returns the non key columns of def that are updated on conflict,
+// columns with UpdateKeep are left out.
+func (u Upsert) Updates(def TableDef) []ColDef {
+	cols := []ColDef{}
+	for _, c := range def.Columns {
+		if u.IsKey(c.Name) || u.Strategy(c.Name) == UpdateKeep {
+			continue
+		}
+		cols = append(cols, c)
+	}
+	return cols
+}
+
+// merge merges the normalized rows with the same keys in the order they
+// appear using the update strategies, since a statement can't update the
+// same row twice. Pointers are compared by value and nil pointers are null.
+func (u Upsert) merge(def TableDef, rows []Row) ([]Row, error) {
+	keys := make([]int, len(u.Keys))
+	for i, k := range u.Keys {
+		if keys[i] = def.IndexOf(k); keys[i] == -1 {
+			return nil, fmt.Errorf("upsert key '%s' is not a column", k)
+		}
+	}
+	ret := make([]Row, 0, len(rows))
+	index := map[string]int{}
+	sb := &strings.Builder{}
+	for _, r := range rows {
+		sb.Reset()
+		for _, k := range keys {
+			fmt.Fprintf(sb, "%v\x1f", conv.Deref(r[k].Value))
+		}
+		i, ok := index[sb.String()]
+		if !ok {
+			index[sb.String()] = len(ret)
+			ret = append(ret, r)
+			continue
+		}
+		merged := make(Row, len(r))
+		copy(merged, ret[i])
+		for fi, f := range r {
+			switch u.Strategy(f.Name) {
+			case UpdateOverwrite:
+				merged[fi].Value = f.Value
+			case UpdateCoalesce:
+				if conv.Deref(f.Value) != nil {
+					merged[fi].Value = f.Value
+				}
+			}
+		}
+		ret[i] = merged
+	}
+	return ret, nil
+}
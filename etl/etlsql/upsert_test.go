@@ -0,0 +1,151 @@
+package etlsql
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stdiopt/danda/drow"
+)
+
+func TestUpsertUpdates(t *testing.T) {
+	def := TableDef{Columns: []ColDef{
+		{Name: "id"},
+		{Name: "name"},
+		{Name: "created"},
+		{Name: "note"},
+	}}
+	type test struct {
+		up   Upsert
+		want []string
+	}
+	run := func(name string, tt test) {
+		t.Helper()
+		t.Run(name, func(t *testing.T) {
+			got := []string{}
+			for _, c := range tt.up.Updates(def) {
+				got = append(got, c.Name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Updates() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	run("overwrite", test{
+		up:   Upsert{Keys: []string{"id"}},
+		want: []string{"name", "created", "note"},
+	})
+	run("keep column", test{
+		up: Upsert{
+			Keys:       []string{"id"},
+			Strategies: map[string]UpdateStrategy{"created": UpdateKeep},
+		},
+		want: []string{"name", "note"},
+	})
+	run("coalesce column", test{
+		up: Upsert{
+			Keys:       []string{"id"},
+			Strategies: map[string]UpdateStrategy{"note": UpdateCoalesce},
+		},
+		want: []string{"name", "created", "note"},
+	})
+	run("keep by default", test{
+		up: Upsert{
+			Keys:       []string{"id"},
+			Default:    UpdateKeep,
+			Strategies: map[string]UpdateStrategy{"NAME": UpdateOverwrite},
+		},
+		want: []string{"name"},
+	})
+	run("composite key", test{
+		up:   Upsert{Keys: []string{"ID", "name"}},
+		want: []string{"created", "note"},
+	})
+	run("all keys", test{
+		up:   Upsert{Keys: []string{"id", "name", "created", "note"}},
+		want: []string{},
+	})
+}
+
+func TestUpsertMerge(t *testing.T) {
+	def := TableDef{Columns: []ColDef{
+		{Name: "id"},
+		{Name: "kind"},
+		{Name: "name"},
+		{Name: "note"},
+	}}
+	row := func(id int, kind string, name, note any) Row {
+		return Row{
+			drow.F("id", id),
+			drow.F("kind", kind),
+			drow.F("name", name),
+			drow.F("note", note),
+		}
+	}
+	type test struct {
+		up      Upsert
+		rows    []Row
+		want    []Row
+		wantErr bool
+	}
+	run := func(name string, tt test) {
+		t.Helper()
+		t.Run(name, func(t *testing.T) {
+			got, err := tt.up.merge(def, tt.rows)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("merge() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("merge()\nwant: %v\n got: %v", tt.want, got)
+			}
+		})
+	}
+	run("no duplicates", test{
+		up:   Upsert{Keys: []string{"id"}},
+		rows: []Row{row(1, "a", "x", nil), row(2, "a", "y", nil)},
+		want: []Row{row(1, "a", "x", nil), row(2, "a", "y", nil)},
+	})
+	run("overwrite", test{
+		up:   Upsert{Keys: []string{"id"}},
+		rows: []Row{row(1, "a", "x", "n"), row(2, "a", "y", nil), row(1, "b", "z", nil)},
+		want: []Row{row(1, "b", "z", nil), row(2, "a", "y", nil)},
+	})
+	run("keep", test{
+		up: Upsert{
+			Keys:       []string{"id"},
+			Strategies: map[string]UpdateStrategy{"name": UpdateKeep},
+		},
+		rows: []Row{row(1, "a", "x", "n"), row(1, "b", "z", "m")},
+		want: []Row{row(1, "b", "x", "m")},
+	})
+	run("coalesce", test{
+		up: Upsert{
+			Keys:    []string{"id"},
+			Default: UpdateCoalesce,
+		},
+		rows: []Row{row(1, "a", "x", "n"), row(1, "b", nil, nil), row(1, "c", "z", nil)},
+		want: []Row{row(1, "c", "z", "n")},
+	})
+	run("coalesce typed nil", test{
+		up: Upsert{
+			Keys:    []string{"id"},
+			Default: UpdateCoalesce,
+		},
+		rows: []Row{row(1, "a", "x", "n"), row(1, "a", (*string)(nil), nil)},
+		want: []Row{row(1, "a", "x", "n")},
+	})
+	run("composite key", test{
+		up:   Upsert{Keys: []string{"id", "kind"}},
+		rows: []Row{row(1, "a", "x", nil), row(1, "b", "y", nil), row(1, "a", "z", nil)},
+		want: []Row{row(1, "a", "z", nil), row(1, "b", "y", nil)},
+	})
+	run("pointer keys", test{
+		up:   Upsert{Keys: []string{"name"}},
+		rows: []Row{row(1, "a", strPtr("x"), nil), row(2, "b", strPtr("x"), nil)},
+		want: []Row{row(2, "b", strPtr("x"), nil)},
+	})
+	run("unknown key", test{
+		up:      Upsert{Keys: []string{"missing"}},
+		rows:    []Row{row(1, "a", "x", nil)},
+		wantErr: true,
+	})
+}
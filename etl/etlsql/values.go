@@ -0,0 +1,490 @@
+package etlsql
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Date is a date without time of day, as the sql DATE type.
+type Date struct {
+	time.Time
+}
+
+func (d Date) String() string {
+	return d.Format("2006-01-02")
+}
+
+// Value implements the driver.Valuer interface.
+func (d Date) Value() (driver.Value, error) {
+	return d.String(), nil
+}
+
+// Scan implements the sql.Scanner interface.
+func (d *Date) Scan(src any) error {
+	switch v := src.(type) {
+	case time.Time:
+		y, m, day := v.Date()
+		d.Time = time.Date(y, m, day, 0, 0, 0, 0, time.UTC)
+		return nil
+	case []byte:
+		return d.Scan(string(v))
+	case string:
+		if len(v) > 10 {
+			v = v[:10]
+		}
+		t, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			return fmt.Errorf("etlsql.Date: %w", err)
+		}
+		d.Time = t
+		return nil
+	}
+	return fmt.Errorf("etlsql.Date: cannot scan %T", src)
+}
+
+// TimeOfDay is a time of day as the sql TIME type, the duration since
+// midnight.
+type TimeOfDay time.Duration
+
+// TimeOfDayOf returns the time of day of t.
+func TimeOfDayOf(t time.Time) TimeOfDay {
+	h, m, s := t.Clock()
+	d := time.Duration(h)*time.Hour + time.Duration(m)*time.Minute +
+		time.Duration(s)*time.Second + time.Duration(t.Nanosecond())
+	return TimeOfDay(d)
+}
+
+// String returns the time of day as 15:04:05.999999.
+func (t TimeOfDay) String() string {
+	return formatClock(time.Duration(t))
+}
+
+// Value implements the driver.Valuer interface.
+func (t TimeOfDay) Value() (driver.Value, error) {
+	return t.String(), nil
+}
+
+// Scan implements the sql.Scanner interface.
+func (t *TimeOfDay) Scan(src any) error {
+	switch v := src.(type) {
+	case time.Time:
+		*t = TimeOfDayOf(v)
+		return nil
+	case []byte:
+		return t.Scan(string(v))
+	case string:
+		d, err := parseClock(v)
+		if err != nil {
+			return fmt.Errorf("etlsql.TimeOfDay: %w", err)
+		}
+		*t = TimeOfDay(d)
+		return nil
+	}
+	return fmt.Errorf("etlsql.TimeOfDay: cannot scan %T", src)
+}
+
+// Interval is a duration as the sql INTERVAL type, it is written as hours,
+// minutes and seconds which is also accepted by the MySQL TIME type that
+// ranges from -838:59:59 to 838:59:59. A time.Duration is stored as a bigint
+// of nanoseconds, convert it to Interval to use an interval column.
+type Interval time.Duration
+
+func (i Interval) String() string {
+	return formatClock(time.Duration(i))
+}
+
+// Value implements the driver.Valuer interface.
+func (i Interval) Value() (driver.Value, error) {
+	return i.String(), nil
+}
+
+// Scan implements the sql.Scanner interface, it parses the postgres
+// interval output as "1 year 2 mons 3 days 04:05:06" where a month is 30
+// days and a year 365 days.
+func (i *Interval) Scan(src any) error {
+	switch v := src.(type) {
+	case int64:
+		*i = Interval(time.Duration(v) * time.Microsecond)
+		return nil
+	case []byte:
+		return i.Scan(string(v))
+	case string:
+		d, err := parseInterval(v)
+		if err != nil {
+			return fmt.Errorf("etlsql.Interval: %w", err)
+		}
+		*i = Interval(d)
+		return nil
+	}
+	return fmt.Errorf("etlsql.Interval: cannot scan %T", src)
+}
+
+// UUID is an universally unique identifier as the sql UUID type.
+type UUID [16]byte
+
+// ParseUUID parses the hex representation of an UUID with or without
+// dashes.
+func ParseUUID(s string) (UUID, error) {
+	var u UUID
+	h := strings.ReplaceAll(strings.Trim(s, "{}"), "-", "")
+	if len(h) != 32 {
+		return u, fmt.Errorf("invalid uuid: %q", s)
+	}
+	if _, err := hex.Decode(u[:], []byte(h)); err != nil {
+		return u, fmt.Errorf("invalid uuid: %q", s)
+	}
+	return u, nil
+}
+
+func (u UUID) String() string {
+	h := hex.EncodeToString(u[:])
+	return h[:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
+
+// Value implements the driver.Valuer interface.
+func (u UUID) Value() (driver.Value, error) {
+	return u.String(), nil
+}
+
+// Scan implements the sql.Scanner interface.
+func (u *UUID) Scan(src any) error {
+	switch v := src.(type) {
+	case []byte:
+		if len(v) == 16 {
+			copy(u[:], v)
+			return nil
+		}
+		return u.Scan(string(v))
+	case string:
+		p, err := ParseUUID(v)
+		if err != nil {
+			return fmt.Errorf("etlsql.UUID: %w", err)
+		}
+		*u = p
+		return nil
+	}
+	return fmt.Errorf("etlsql.UUID: cannot scan %T", src)
+}
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (u UUID) MarshalText() ([]byte, error) {
+	return []byte(u.String()), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (u *UUID) UnmarshalText(data []byte) error {
+	p, err := ParseUUID(string(data))
+	if err != nil {
+		return err
+	}
+	*u = p
+	return nil
+}
+
+// JSON is an encoded json document as the sql JSON types.
+type JSON json.RawMessage
+
+// MarshalJSON implements the json.Marshaler interface.
+func (j JSON) MarshalJSON() ([]byte, error) {
+	if len(j) == 0 {
+		return []byte("null"), nil
+	}
+	return j, nil
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (j *JSON) UnmarshalJSON(data []byte) error {
+	*j = append((*j)[:0], data...)
+	return nil
+}
+
+// Value implements the driver.Valuer interface.
+func (j JSON) Value() (driver.Value, error) {
+	if j == nil {
+		return nil, nil
+	}
+	return string(j), nil
+}
+
+// Scan implements the sql.Scanner interface.
+func (j *JSON) Scan(src any) error {
+	switch v := src.(type) {
+	case []byte:
+		*j = append(JSON{}, v...)
+		return nil
+	case string:
+		*j = JSON(v)
+		return nil
+	}
+	return fmt.Errorf("etlsql.JSON: cannot scan %T", src)
+}
+
+// Array is a one dimensional array, it is written as a json array which
+// dialects without arrays store in a json column.
+type Array[T any] []T
+
+// Value implements the driver.Valuer interface.
+func (a Array[T]) Value() (driver.Value, error) {
+	if a == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal([]T(a))
+	return string(data), err
+}
+
+// Scan implements the sql.Scanner interface, it reads json arrays and
+// postgres array literals as {1,2,NULL}. Null elements can only be scanned
+// into nilable element types as Array[*int64], other element types return
+// an error instead of the zero value.
+func (a *Array[T]) Scan(src any) error {
+	var s string
+	switch v := src.(type) {
+	case []byte:
+		s = string(v)
+	case string:
+		s = v
+	default:
+		return fmt.Errorf("etlsql.Array: cannot scan %T", src)
+	}
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "{") {
+		data, err := literalToJSON(s, typ)
+		if err != nil {
+			return fmt.Errorf("etlsql.Array: %w", err)
+		}
+		s = string(data)
+	}
+	if nilable(typ) {
+		var arr []T
+		if err := json.Unmarshal([]byte(s), &arr); err != nil {
+			return fmt.Errorf("etlsql.Array: %w", err)
+		}
+		*a = arr
+		return nil
+	}
+	var ptrs []*T
+	if err := json.Unmarshal([]byte(s), &ptrs); err != nil {
+		return fmt.Errorf("etlsql.Array: %w", err)
+	}
+	if ptrs == nil {
+		*a = nil
+		return nil
+	}
+	arr := make([]T, len(ptrs))
+	for i, p := range ptrs {
+		if p == nil {
+			return fmt.Errorf("etlsql.Array: null element %d, use Array[*%v]", i, typ)
+		}
+		arr[i] = *p
+	}
+	*a = arr
+	return nil
+}
+
+// nilable reports whether values of typ can be nil.
+func nilable(typ reflect.Type) bool {
+	switch typ.Kind() {
+	case reflect.Pointer, reflect.Interface, reflect.Slice, reflect.Map:
+		return true
+	}
+	return false
+}
+
+// ParseArrayLiteral parses a one dimensional postgres array literal, null
+// elements are nil.
+func ParseArrayLiteral(s string) ([]*string, error) {
+	s = strings.TrimSpace(s)
+	if len(s) < 2 || s[0] != '{' || s[len(s)-1] != '}' {
+		return nil, fmt.Errorf("invalid array literal: %q", s)
+	}
+	body := s[1 : len(s)-1]
+	elems := []*string{}
+	if strings.TrimSpace(body) == "" {
+		return elems, nil
+	}
+	for i := 0; i <= len(body); {
+		for i < len(body) && body[i] == ' ' {
+			i++
+		}
+		var elem string
+		quoted := i < len(body) && body[i] == '"'
+		if quoted {
+			sb := strings.Builder{}
+			i++
+			for ; i < len(body) && body[i] != '"'; i++ {
+				if body[i] == '\\' && i+1 < len(body) {
+					i++
+				}
+				sb.WriteByte(body[i])
+			}
+			if i == len(body) {
+				return nil, fmt.Errorf("invalid array literal: %q", s)
+			}
+			i++
+			elem = sb.String()
+		} else {
+			start := i
+			for i < len(body) && body[i] != ',' {
+				if body[i] == '{' {
+					return nil, fmt.Errorf("multidimensional arrays not supported: %q", s)
+				}
+				i++
+			}
+			elem = strings.TrimSpace(body[start:i])
+		}
+		if !quoted && strings.EqualFold(elem, "NULL") {
+			elems = append(elems, nil)
+		} else {
+			e := elem
+			elems = append(elems, &e)
+		}
+		for i < len(body) && body[i] == ' ' {
+			i++
+		}
+		if i < len(body) && body[i] != ',' {
+			return nil, fmt.Errorf("invalid array literal: %q", s)
+		}
+		i++
+	}
+	return elems, nil
+}
+
+var textUnmarshalerTyp = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// literalToJSON converts a postgres array literal to a json array with
+// elements of typ.
+func literalToJSON(s string, typ reflect.Type) ([]byte, error) {
+	elems, err := ParseArrayLiteral(s)
+	if err != nil {
+		return nil, err
+	}
+	for typ != nil && typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	// text types as apd.Decimal are decoded from json strings
+	text := typ != nil && reflect.PointerTo(typ).Implements(textUnmarshalerTyp)
+	buf := &bytes.Buffer{}
+	buf.WriteByte('[')
+	for i, e := range elems {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		switch {
+		case e == nil:
+			buf.WriteString("null")
+		case text, typ == nil, typ.Kind() == reflect.String, typ.Kind() == reflect.Interface:
+			buf.WriteString(strconv.Quote(*e))
+		case typ.Kind() == reflect.Bool:
+			b := *e == "t" || strings.EqualFold(*e, "true")
+			buf.WriteString(strconv.FormatBool(b))
+		default:
+			buf.WriteString(*e)
+		}
+	}
+	buf.WriteByte(']')
+	return buf.Bytes(), nil
+}
+
+// formatClock formats d as hours, minutes and seconds where hours can be
+// over 24.
+func formatClock(d time.Duration) string {
+	sign := ""
+	if d < 0 {
+		sign, d = "-", -d
+	}
+	h := d / time.Hour
+	m := d % time.Hour / time.Minute
+	s := d % time.Minute / time.Second
+	us := d % time.Second / time.Microsecond
+	if us == 0 {
+		return fmt.Sprintf("%s%02d:%02d:%02d", sign, h, m, s)
+	}
+	return fmt.Sprintf("%s%02d:%02d:%02d.%06d", sign, h, m, s, us)
+}
+
+// parseClock parses [-]hh:mm[:ss[.ffffff]] with an optional time zone
+// suffix which is ignored.
+func parseClock(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexAny(s, "+Z"); i > 0 {
+		s = s[:i]
+	}
+	if i := strings.LastIndexByte(s, '-'); i > 0 {
+		s = s[:i]
+	}
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimLeft(s, "+-")
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, fmt.Errorf("invalid time: %q", s)
+	}
+	var d time.Duration
+	for i, p := range parts {
+		if i == 2 {
+			f, err := strconv.ParseFloat(p, 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid time: %q", s)
+			}
+			d += time.Duration(f * float64(time.Second))
+			continue
+		}
+		n, err := strconv.ParseInt(p, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid time: %q", s)
+		}
+		if i == 0 {
+			d += time.Duration(n) * time.Hour
+		} else {
+			d += time.Duration(n) * time.Minute
+		}
+	}
+	if neg {
+		d = -d
+	}
+	return d, nil
+}
+
+var intervalUnits = map[string]time.Duration{
+	"year":  365 * 24 * time.Hour,
+	"years": 365 * 24 * time.Hour,
+	"mon":   30 * 24 * time.Hour,
+	"mons":  30 * 24 * time.Hour,
+	"day":   24 * time.Hour,
+	"days":  24 * time.Hour,
+}
+
+func parseInterval(s string) (time.Duration, error) {
+	fields := strings.Fields(s)
+	var d time.Duration
+	for i := 0; i < len(fields); i++ {
+		f := fields[i]
+		if strings.Contains(f, ":") {
+			c, err := parseClock(f)
+			if err != nil {
+				return 0, err
+			}
+			d += c
+			continue
+		}
+		n, err := strconv.ParseInt(f, 10, 64)
+		if err != nil || i+1 == len(fields) {
+			return 0, fmt.Errorf("invalid interval: %q", s)
+		}
+		i++
+		unit, ok := intervalUnits[fields[i]]
+		if !ok {
+			return 0, fmt.Errorf("invalid interval: %q", s)
+		}
+		d += time.Duration(n) * unit
+	}
+	return d, nil
+}
@@ -0,0 +1,248 @@
+package etlsql
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/apd"
+)
+
+func TestScan(t *testing.T) {
+	type test struct {
+		dst     sql.Scanner
+		src     any
+		want    any
+		wantErr string
+	}
+	run := func(name string, tt test) {
+		t.Helper()
+		t.Run(name, func(t *testing.T) {
+			err := tt.dst.Scan(tt.src)
+			if !matchErr(err, tt.wantErr) {
+				t.Fatalf("Scan(%#v) error = %v, want %q", tt.src, err, tt.wantErr)
+			}
+			if tt.wantErr != "" {
+				return
+			}
+			got := reflect.ValueOf(tt.dst).Elem().Interface()
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Scan(%#v) = %#v, want %#v", tt.src, got, tt.want)
+			}
+		})
+	}
+	at := time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)
+	dec := func(s string) apd.Decimal {
+		d, _, err := apd.NewFromString(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return *d
+	}
+	one, two := int64(1), int64(2)
+	uuid := UUID{0x12, 0x3e, 0x45, 0x67, 0xe8, 0x9b, 0x12, 0xd3, 0xa4, 0x56, 0x42, 0x66, 0x14, 0x17, 0x40, 0x00}
+
+	run("date from time", test{
+		dst:  &Date{},
+		src:  at,
+		want: Date{time.Date(2022, 1, 2, 0, 0, 0, 0, time.UTC)},
+	})
+	run("date from timestamp string", test{
+		dst:  &Date{},
+		src:  []byte("2022-01-02 03:04:05"),
+		want: Date{time.Date(2022, 1, 2, 0, 0, 0, 0, time.UTC)},
+	})
+	run("date invalid", test{dst: &Date{}, src: "02/01/2022", wantErr: "etlsql.Date"})
+	run("date from int", test{dst: &Date{}, src: int64(1), wantErr: "cannot scan int64"})
+
+	run("time of day from time", test{
+		dst:  new(TimeOfDay),
+		src:  at,
+		want: TimeOfDay(3*time.Hour + 4*time.Minute + 5*time.Second),
+	})
+	run("time of day with fraction and zone", test{
+		dst:  new(TimeOfDay),
+		src:  "03:04:05.5+01",
+		want: TimeOfDay(3*time.Hour + 4*time.Minute + 5500*time.Millisecond),
+	})
+	run("time of day without seconds", test{
+		dst:  new(TimeOfDay),
+		src:  "03:04",
+		want: TimeOfDay(3*time.Hour + 4*time.Minute),
+	})
+	run("time of day invalid", test{dst: new(TimeOfDay), src: "3h", wantErr: "invalid time"})
+
+	run("interval clock", test{
+		dst:  new(Interval),
+		src:  "-01:30:00",
+		want: Interval(-90 * time.Minute),
+	})
+	run("interval units", test{
+		dst:  new(Interval),
+		src:  []byte("1 year 2 mons 3 days 04:05:06"),
+		want: Interval((365+60+3)*24*time.Hour + 4*time.Hour + 5*time.Minute + 6*time.Second),
+	})
+	run("interval microseconds", test{
+		dst:  new(Interval),
+		src:  int64(1500),
+		want: Interval(1500 * time.Microsecond),
+	})
+	run("interval unknown unit", test{dst: new(Interval), src: "1 week", wantErr: "invalid interval"})
+	run("interval missing unit", test{dst: new(Interval), src: "1", wantErr: "invalid interval"})
+
+	run("uuid string", test{
+		dst:  &UUID{},
+		src:  "123e4567-e89b-12d3-a456-426614174000",
+		want: uuid,
+	})
+	run("uuid braces without dashes", test{
+		dst:  &UUID{},
+		src:  "{123e4567e89b12d3a456426614174000}",
+		want: uuid,
+	})
+	run("uuid bytes", test{dst: &UUID{}, src: uuid[:], want: uuid})
+	run("uuid invalid", test{dst: &UUID{}, src: "123e4567", wantErr: "invalid uuid"})
+
+	run("json", test{dst: &JSON{}, src: []byte(`{"a":1}`), want: JSON(`{"a":1}`)})
+	run("json from int", test{dst: &JSON{}, src: int64(1), wantErr: "cannot scan int64"})
+
+	run("array json", test{dst: &Array[int64]{}, src: "[1,2]", want: Array[int64]{1, 2}})
+	run("array literal", test{dst: &Array[int64]{}, src: []byte("{1,2}"), want: Array[int64]{1, 2}})
+	run("array empty literal", test{dst: &Array[int64]{}, src: "{}", want: Array[int64]{}})
+	run("array literal null string", test{
+		dst:     &Array[string]{},
+		src:     `{a,"b,c","d\"e",NULL}`,
+		wantErr: "null element 3, use Array[*string]",
+	})
+	run("array literal quoted strings", test{
+		dst:  &Array[string]{},
+		src:  `{a,"b,c","d\"e","NULL"}`,
+		want: Array[string]{"a", "b,c", `d"e`, "NULL"},
+	})
+	run("array literal null", test{
+		dst:     &Array[int64]{},
+		src:     "{1,2,NULL}",
+		wantErr: "null element 2, use Array[*int64]",
+	})
+	run("array json null", test{
+		dst:     &Array[int64]{},
+		src:     "[1,null]",
+		wantErr: "null element 1, use Array[*int64]",
+	})
+	run("array literal null pointers", test{
+		dst:  &Array[*int64]{},
+		src:  "{1,2,NULL}",
+		want: Array[*int64]{&one, &two, nil},
+	})
+	run("array literal pointer strings", test{
+		dst:  &Array[*string]{},
+		src:  "{a,NULL}",
+		want: Array[*string]{strPtr("a"), nil},
+	})
+	run("array literal bools", test{
+		dst:  &Array[bool]{},
+		src:  "{t,f,true}",
+		want: Array[bool]{true, false, true},
+	})
+	run("array literal decimals", test{
+		dst:  &Array[apd.Decimal]{},
+		src:  "{1.10,12345678901234567890.5}",
+		want: Array[apd.Decimal]{dec("1.10"), dec("12345678901234567890.5")},
+	})
+	run("array literal uuids", test{
+		dst:  &Array[UUID]{},
+		src:  "{123e4567-e89b-12d3-a456-426614174000}",
+		want: Array[UUID]{uuid},
+	})
+	run("array multidimensional", test{
+		dst:     &Array[int64]{},
+		src:     "{{1,2},{3,4}}",
+		wantErr: "multidimensional arrays not supported",
+	})
+	run("array invalid element", test{dst: &Array[int64]{}, src: "{1,a}", wantErr: "etlsql.Array"})
+	run("array from int", test{dst: &Array[int64]{}, src: int64(1), wantErr: "cannot scan int64"})
+}
+
+func TestValue(t *testing.T) {
+	type test struct {
+		val  driver.Valuer
+		want any
+	}
+	run := func(name string, tt test) {
+		t.Helper()
+		t.Run(name, func(t *testing.T) {
+			got, err := tt.val.Value()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Value() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+	run("date", test{
+		val:  Date{time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)},
+		want: "2022-01-02",
+	})
+	run("time of day", test{
+		val:  TimeOfDay(3*time.Hour + 4*time.Minute + 5*time.Second),
+		want: "03:04:05",
+	})
+	run("time of day fraction", test{
+		val:  TimeOfDay(5*time.Second + 1500*time.Microsecond),
+		want: "00:00:05.001500",
+	})
+	run("interval over a day", test{
+		val:  Interval(-26 * time.Hour),
+		want: "-26:00:00",
+	})
+	run("uuid", test{
+		val:  UUID{0x12, 0x3e, 0x45, 0x67, 0xe8, 0x9b, 0x12, 0xd3, 0xa4, 0x56, 0x42, 0x66, 0x14, 0x17, 0x40, 0x00},
+		want: "123e4567-e89b-12d3-a456-426614174000",
+	})
+	run("json nil", test{val: JSON(nil), want: nil})
+	run("json", test{val: JSON(`[1]`), want: "[1]"})
+	run("array nil", test{val: Array[int64](nil), want: nil})
+	run("array", test{val: Array[*int64]{nil}, want: "[null]"})
+}
+
+func TestParseArrayLiteral(t *testing.T) {
+	type test struct {
+		s       string
+		want    []*string
+		wantErr string
+	}
+	run := func(name string, tt test) {
+		t.Helper()
+		t.Run(name, func(t *testing.T) {
+			got, err := ParseArrayLiteral(tt.s)
+			if !matchErr(err, tt.wantErr) {
+				t.Fatalf("ParseArrayLiteral(%q) error = %v, want %q", tt.s, err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseArrayLiteral(%q) = %v, want %v", tt.s, got, tt.want)
+			}
+		})
+	}
+	run("empty", test{s: "{}", want: []*string{}})
+	run("spaces", test{s: "{ 1 , 2 }", want: []*string{strPtr("1"), strPtr("2")}})
+	run("null", test{s: "{NULL,null}", want: []*string{nil, nil}})
+	run("quoted null", test{s: `{"NULL"}`, want: []*string{strPtr("NULL")}})
+	run("quoted escapes", test{s: `{"a\\b","c\"d"}`, want: []*string{strPtr(`a\b`), strPtr(`c"d`)}})
+	run("empty element", test{s: `{""}`, want: []*string{strPtr("")}})
+	run("not an array", test{s: "1,2", wantErr: "invalid array literal"})
+	run("unterminated quote", test{s: `{"a}`, wantErr: "invalid array literal"})
+	run("garbage after quote", test{s: `{"a"b}`, wantErr: "invalid array literal"})
+}
+
+func matchErr(err error, want string) bool {
+	if err == nil || want == "" {
+		return (err == nil) == (want == "")
+	}
+	return strings.Contains(err.Error(), want)
+}
+
+func strPtr(s string) *string { return &s }
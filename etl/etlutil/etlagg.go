@@ -2,46 +2,91 @@ package etlutil
 
 import (
 	"context"
+	"errors"
+	"fmt"
 
 	"github.com/stdiopt/danda/etl"
 	"github.com/stdiopt/danda/util/dagg"
 )
 
 // Group groups data and produces a Row with the data.
+//
+// By default the whole input is consumed before the first group is yielded,
+// with SortedInput each group is yielded as soon as its key changes.
 func Group[T any](it Iter, gfn dagg.GroupFn[T], opts ...dagg.OptFn[T]) Iter {
 	var a *dagg.Agg[T]
 	var aggRows []Row
 	curi := 0
 	return etl.MakeIter(etl.Custom[Row]{
 		Next: func(ctx context.Context) (Row, error) {
-			if aggRows == nil {
+			if a == nil {
 				a = &dagg.Agg[T]{}
 				a.GroupBy(gfn)
 				for _, fn := range opts {
 					fn(a)
 				}
-				if err := etl.ConsumeContext(ctx, it, a.Add); err != nil {
-					return nil, err
+			}
+			for {
+				if row, ok := a.Pop(); ok {
+					return row, nil
+				}
+				if aggRows != nil {
+					if curi >= len(aggRows) {
+						return nil, etl.EOI
+					}
+					row := aggRows[curi]
+					curi++
+					return row, nil
+				}
+				vv, err := it.Next(ctx)
+				if err == etl.EOI {
+					if aggRows, err = a.Result(); err != nil {
+						return nil, err
+					}
+					continue
 				}
-
-				var err error
-				aggRows, err = a.Result()
 				if err != nil {
 					return nil, err
 				}
-				// return err
+				v, ok := vv.(T)
+				if !ok {
+					return nil, fmt.Errorf("Group: type mismatch: %T", vv)
+				}
+				if err := a.Add(v); err != nil && !errors.Is(err, etl.ErrSkip) {
+					return nil, err
+				}
 			}
-			if curi >= len(aggRows) {
-				return nil, etl.EOI
+		},
+		Close: func() error {
+			err := it.Close()
+			if a != nil {
+				err = errors.Join(err, a.Close())
 			}
-			row := aggRows[curi]
-			curi++
-			return row, nil
+			return err
 		},
-		Close: it.Close,
 	})
 }
 
+// SortedInput sets the aggregator to expect values sorted by group so each
+// group is produced as soon as the key changes.
+func SortedInput[T any]() dagg.OptFn[T] {
+	return func(a *dagg.Agg[T]) {
+		a.Sorted()
+	}
+}
+
+// SpillGroups sets the maximum number of groups kept in memory, values of
+// other groups are spilled to temporary files and aggregated at the end.
+// An optional codec can be passed to encode the values, defaults to gob.
+func SpillGroups[T any](budget int, codec ...etl.Codec[T]) dagg.OptFn[T] {
+	return func(a *dagg.Agg[T]) {
+		a.Spill(budget, "")
+		if len(codec) > 0 {
+			a.SpillCodec(codec[0].NewEncoder, codec[0].NewDecoder)
+		}
+	}
+}
+
 // GroupByFuncE accepts a function that expects a V type to group iterations
 // and allows an error to be returned.
 func GroupByFuncE[T, V any](fn func(T) (V, error)) dagg.GroupFn[T] {
@@ -0,0 +1,467 @@
+package etlutil
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+
+	"github.com/stdiopt/danda/etl"
+)
+
+// JoinKind is the kind of join performed by the key based joins.
+type JoinKind int
+
+const (
+	// JoinInner yields only matching values.
+	JoinInner JoinKind = iota
+	// JoinLeft yields all left values with the matching right values if any.
+	JoinLeft
+	// JoinRight yields all right values with the matching left values if any.
+	JoinRight
+	// JoinOuter yields all values from both sides.
+	JoinOuter
+)
+
+func (k JoinKind) String() string {
+	switch k {
+	case JoinInner:
+		return "inner"
+	case JoinLeft:
+		return "left"
+	case JoinRight:
+		return "right"
+	case JoinOuter:
+		return "outer"
+	}
+	return "unknown"
+}
+
+func (k JoinKind) keepLeft() bool  { return k == JoinLeft || k == JoinOuter }
+func (k JoinKind) keepRight() bool { return k == JoinRight || k == JoinOuter }
+
+type joinOptions struct {
+	budget     int
+	partitions int
+	tempDir    string
+	lcodec     any
+	rcodec     any
+}
+
+type JoinOptFunc func(*joinOptions)
+
+// WithJoinBudget sets the maximum number of right values kept in memory, when
+// exceeded both sides are partitioned to temporary files by key and joined
+// one partition at a time.
+func WithJoinBudget(n int) JoinOptFunc {
+	return func(o *joinOptions) {
+		o.budget = n
+	}
+}
+
+// WithJoinPartitions sets the number of partitions used when the budget is
+// exceeded, at least 2.
+func WithJoinPartitions(n int) JoinOptFunc {
+	return func(o *joinOptions) {
+		o.partitions = n
+	}
+}
+
+// WithJoinTempDir sets the directory for the partition files, defaults to
+// os.TempDir.
+func WithJoinTempDir(dir string) JoinOptFunc {
+	return func(o *joinOptions) {
+		o.tempDir = dir
+	}
+}
+
+// WithJoinCodecs sets the codecs used to write partitions, defaults to
+// etl.GobCodec.
+func WithJoinCodecs[L, R any](lc etl.Codec[L], rc etl.Codec[R]) JoinOptFunc {
+	return func(o *joinOptions) {
+		o.lcodec = lc
+		o.rcodec = rc
+	}
+}
+
+func makeJoinOptions(opts ...JoinOptFunc) joinOptions {
+	o := joinOptions{
+		budget:     100_000,
+		partitions: 16,
+	}
+	for _, fn := range opts {
+		fn(&o)
+	}
+	return o
+}
+
+// InnerJoinBy is HashJoin with JoinInner.
+func InnerJoinBy[L, R any, K comparable](it1, it2 Iter, lkey func(L) K, rkey func(R) K, opts ...JoinOptFunc) Iter {
+	return HashJoin(JoinInner, it1, it2, lkey, rkey, opts...)
+}
+
+// LeftJoinBy is HashJoin with JoinLeft.
+func LeftJoinBy[L, R any, K comparable](it1, it2 Iter, lkey func(L) K, rkey func(R) K, opts ...JoinOptFunc) Iter {
+	return HashJoin(JoinLeft, it1, it2, lkey, rkey, opts...)
+}
+
+// RightJoinBy is HashJoin with JoinRight.
+func RightJoinBy[L, R any, K comparable](it1, it2 Iter, lkey func(L) K, rkey func(R) K, opts ...JoinOptFunc) Iter {
+	return HashJoin(JoinRight, it1, it2, lkey, rkey, opts...)
+}
+
+// OuterJoinBy is HashJoin with JoinOuter.
+func OuterJoinBy[L, R any, K comparable](it1, it2 Iter, lkey func(L) K, rkey func(R) K, opts ...JoinOptFunc) Iter {
+	return HashJoin(JoinOuter, it1, it2, lkey, rkey, opts...)
+}
+
+// HashJoin joins it1 and it2 by the keys returned by lkey and rkey.
+//
+// it2 is loaded into a hash index and it1 is streamed against it, matches
+// are yielded in it1 order and right values without match are yielded at the
+// end for right and outer joins.
+// If it2 exceeds the budget both sides are partitioned to disk by key hash
+// and each partition is joined in memory (grace hash join), the values are
+// then yielded one partition at a time so it1 order is only kept within a
+// partition and the unmatched right values follow each partition.
+// Partitions that still exceed the budget are partitioned again, the join
+// fails if a single key has more right values than the budget.
+func HashJoin[L, R any, K comparable](kind JoinKind, it1, it2 Iter, lkey func(L) K, rkey func(R) K, opts ...JoinOptFunc) Iter {
+	o := makeJoinOptions(opts...)
+	return etl.MakeGen(etl.Gen[JoinData[L, R]]{
+		Run: func(ctx context.Context, yield etl.Y[JoinData[L, R]]) error {
+			j := hashJoin[L, R, K]{
+				kind:   kind,
+				lkey:   lkey,
+				rkey:   rkey,
+				opts:   o,
+				yield:  yield,
+				lcodec: etl.GobCodec[L](),
+				rcodec: etl.GobCodec[R](),
+			}
+			if err := j.init(); err != nil {
+				return err
+			}
+			defer j.cleanup() // nolint: errcheck
+			return j.run(ctx, it1, it2)
+		},
+		Close: func() error {
+			return errors.Join(it1.Close(), it2.Close())
+		},
+	})
+}
+
+type joinBucket[R any] struct {
+	values  []R
+	matched bool
+}
+
+// joinTable is the in memory hash index of the right side, keys keeps the
+// insertion order so unmatched values are yielded deterministically.
+type joinTable[R any, K comparable] struct {
+	buckets map[K]*joinBucket[R]
+	keys    []K
+	count   int
+}
+
+func newJoinTable[R any, K comparable]() *joinTable[R, K] {
+	return &joinTable[R, K]{buckets: map[K]*joinBucket[R]{}}
+}
+
+func (t *joinTable[R, K]) add(k K, v R) {
+	b, ok := t.buckets[k]
+	if !ok {
+		b = &joinBucket[R]{}
+		t.buckets[k] = b
+		t.keys = append(t.keys, k)
+	}
+	b.values = append(b.values, v)
+	t.count++
+}
+
+// maxJoinLevel is the maximum number of times a partition is partitioned
+// again when it exceeds the budget.
+const maxJoinLevel = 8
+
+type hashJoin[L, R any, K comparable] struct {
+	kind   JoinKind
+	lkey   func(L) K
+	rkey   func(R) K
+	opts   joinOptions
+	yield  etl.Y[JoinData[L, R]]
+	lcodec etl.Codec[L]
+	rcodec etl.Codec[R]
+
+	parts []*joinParts[L, R]
+}
+
+func (j *hashJoin[L, R, K]) init() error {
+	if j.opts.lcodec != nil {
+		c, ok := j.opts.lcodec.(etl.Codec[L])
+		if !ok {
+			return fmt.Errorf("HashJoin: left codec type mismatch: %T", j.opts.lcodec)
+		}
+		j.lcodec = c
+	}
+	if j.opts.rcodec != nil {
+		c, ok := j.opts.rcodec.(etl.Codec[R])
+		if !ok {
+			return fmt.Errorf("HashJoin: right codec type mismatch: %T", j.opts.rcodec)
+		}
+		j.rcodec = c
+	}
+	// a single partition would never split
+	if j.opts.partitions < 2 {
+		j.opts.partitions = 2
+	}
+	return nil
+}
+
+func (j *hashJoin[L, R, K]) run(ctx context.Context, it1, it2 Iter) error {
+	table, parts, err := j.build(ctx, it2, 0)
+	if err != nil {
+		return err
+	}
+	if parts == nil {
+		return j.probe(ctx, table, it1)
+	}
+	return j.joinParts(ctx, parts, it1, 0)
+}
+
+// build loads the right values of it into a table, when the budget is
+// exceeded the values are moved to partitions by the key hash of level
+// instead and the returned table is nil.
+func (j *hashJoin[L, R, K]) build(ctx context.Context, it Iter, level int) (*joinTable[R, K], *joinParts[L, R], error) {
+	table := newJoinTable[R, K]()
+	var parts *joinParts[L, R]
+	err := etl.ConsumeContext(ctx, it, func(v R) error {
+		k := j.rkey(v)
+		if parts != nil {
+			return parts.r[j.partition(k, level)].add(v)
+		}
+		table.add(k, v)
+		if j.opts.budget <= 0 || table.count <= j.opts.budget {
+			return nil
+		}
+		// partitioning can't split the values of a single key.
+		if len(table.keys) == 1 {
+			return fmt.Errorf("HashJoin: key %v has more right values than the budget of %d", k, j.opts.budget)
+		}
+		if level >= maxJoinLevel {
+			return fmt.Errorf("HashJoin: partition exceeds the budget of %d after %d levels", j.opts.budget, level)
+		}
+		// budget exceeded, move the table to the partitions.
+		var err error
+		if parts, err = j.createParts(); err != nil {
+			return err
+		}
+		for _, k := range table.keys {
+			p := parts.r[j.partition(k, level)]
+			for _, v := range table.buckets[k].values {
+				if err := p.add(v); err != nil {
+					return err
+				}
+			}
+		}
+		table = nil
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return table, parts, nil
+}
+
+// joinParts partitions the left values of it with the right partitions of
+// level and joins each pair in memory, a right partition that exceeds the
+// budget is partitioned again with the next level.
+func (j *hashJoin[L, R, K]) joinParts(ctx context.Context, parts *joinParts[L, R], it Iter, level int) error {
+	err := etl.ConsumeContext(ctx, it, func(v L) error {
+		return parts.l[j.partition(j.lkey(v), level)].add(v)
+	})
+	if err != nil {
+		return err
+	}
+	for i := range parts.r {
+		rit, err := parts.r[i].iter()
+		if err != nil {
+			return err
+		}
+		table, sub, err := j.build(ctx, rit, level+1)
+		if err != nil {
+			return err
+		}
+		lit, err := parts.l[i].iter()
+		if err != nil {
+			return err
+		}
+		if sub == nil {
+			err = j.probe(ctx, table, lit)
+		} else {
+			err = j.joinParts(ctx, sub, lit, level+1)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return parts.remove()
+}
+
+// probe streams left values against the table and yields the unmatched
+// right values at the end if needed.
+func (j *hashJoin[L, R, K]) probe(ctx context.Context, table *joinTable[R, K], it Iter) error {
+	err := etl.ConsumeContext(ctx, it, func(v1 L) error {
+		b, ok := table.buckets[j.lkey(v1)]
+		if !ok {
+			if !j.kind.keepLeft() {
+				return nil
+			}
+			return j.yield(JoinData[L, R]{&v1, nil})
+		}
+		b.matched = true
+		for _, v2 := range b.values {
+			v1, v2 := v1, v2 // shadow
+			if err := j.yield(JoinData[L, R]{&v1, &v2}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil || !j.kind.keepRight() {
+		return err
+	}
+	for _, k := range table.keys {
+		b := table.buckets[k]
+		if b.matched {
+			continue
+		}
+		for _, v2 := range b.values {
+			v2 := v2
+			if err := j.yield(JoinData[L, R]{nil, &v2}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// partition returns the partition of k, the level is hashed with the key
+// so a partition is split when partitioned again.
+func (j *hashJoin[L, R, K]) partition(k K, level int) int {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d:%v", level, k)
+	// fnv low bits only depend on the low bits of each byte, mix them with
+	// the high bits so the level changes the partition.
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	return int(x % uint64(j.opts.partitions))
+}
+
+func (j *hashJoin[L, R, K]) createParts() (*joinParts[L, R], error) {
+	parts := &joinParts[L, R]{
+		l: make([]*partFile[L], j.opts.partitions),
+		r: make([]*partFile[R], j.opts.partitions),
+	}
+	j.parts = append(j.parts, parts)
+	for i := 0; i < j.opts.partitions; i++ {
+		var err error
+		if parts.l[i], err = newPartFile(j.opts.tempDir, j.lcodec); err != nil {
+			return nil, err
+		}
+		if parts.r[i], err = newPartFile(j.opts.tempDir, j.rcodec); err != nil {
+			return nil, err
+		}
+	}
+	return parts, nil
+}
+
+func (j *hashJoin[L, R, K]) cleanup() error {
+	var err error
+	for _, p := range j.parts {
+		err = errors.Join(err, p.remove())
+	}
+	return err
+}
+
+// joinParts are the left and right partition files of a level.
+type joinParts[L, R any] struct {
+	l []*partFile[L]
+	r []*partFile[R]
+}
+
+// remove removes the partition files, it can be called more than once.
+func (p *joinParts[L, R]) remove() error {
+	var err error
+	for _, f := range p.l {
+		err = errors.Join(err, f.remove())
+	}
+	for _, f := range p.r {
+		err = errors.Join(err, f.remove())
+	}
+	p.l, p.r = nil, nil
+	return err
+}
+
+// partFile is a temporary file of encoded values.
+type partFile[T any] struct {
+	f     *os.File
+	w     *bufio.Writer
+	enc   func(T) error
+	codec etl.Codec[T]
+}
+
+func newPartFile[T any](dir string, codec etl.Codec[T]) (*partFile[T], error) {
+	f, err := os.CreateTemp(dir, "etl-join-*")
+	if err != nil {
+		return nil, err
+	}
+	w := bufio.NewWriter(f)
+	return &partFile[T]{
+		f:     f,
+		w:     w,
+		enc:   codec.NewEncoder(w),
+		codec: codec,
+	}, nil
+}
+
+func (p *partFile[T]) add(v T) error {
+	if err := p.enc(v); err != nil {
+		return fmt.Errorf("HashJoin: encoding: %w", err)
+	}
+	return nil
+}
+
+// iter flushes the file and returns an iterator over its values.
+func (p *partFile[T]) iter() (Iter, error) {
+	if err := p.w.Flush(); err != nil {
+		return nil, err
+	}
+	if _, err := p.f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	dec := p.codec.NewDecoder(bufio.NewReader(p.f))
+	return etl.MakeIter(etl.Custom[T]{
+		Next: func(context.Context) (T, error) {
+			v, err := dec()
+			if err == io.EOF {
+				return v, etl.EOI
+			}
+			if err != nil {
+				return v, fmt.Errorf("HashJoin: decoding: %w", err)
+			}
+			return v, nil
+		},
+	}), nil
+}
+
+func (p *partFile[T]) remove() error {
+	if p == nil {
+		return nil
+	}
+	return errors.Join(p.f.Close(), os.Remove(p.f.Name()))
+}
@@ -0,0 +1,146 @@
+package etlutil
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stdiopt/danda/etl"
+)
+
+type joinItem struct {
+	K int
+	V string
+}
+
+func TestHashJoin(t *testing.T) {
+	left := []joinItem{{1, "l1"}, {2, "l2"}, {5, "l5"}, {2, "l2b"}, {4, "l4"}}
+	right := []joinItem{{2, "r2"}, {3, "r3"}, {5, "r5"}, {2, "r2b"}, {6, "r6"}}
+	key := func(v joinItem) int { return v.K }
+
+	type test struct {
+		kind JoinKind
+		opts []JoinOptFunc
+		want []string
+		// sorted compares the values regardless of order
+		sorted bool
+	}
+	run := func(name string, tt test) {
+		t.Helper()
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			opts := append([]JoinOptFunc{WithJoinTempDir(dir)}, tt.opts...)
+			it := HashJoin(tt.kind, etl.Values(left...), etl.Values(right...), key, key, opts...)
+			got, err := joinStrings[joinItem, joinItem](it)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := tt.want
+			if tt.sorted {
+				want = append([]string{}, want...)
+				sort.Strings(got)
+				sort.Strings(want)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("HashJoin(%v)\nwant: %v\n got: %v", tt.kind, want, got)
+			}
+			if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+				t.Errorf("HashJoin(%v) left %d partition files", tt.kind, len(entries))
+			}
+		})
+	}
+	inner := []string{"l2|r2", "l2|r2b", "l5|r5", "l2b|r2", "l2b|r2b"}
+	leftWant := []string{"l1|-", "l2|r2", "l2|r2b", "l5|r5", "l2b|r2", "l2b|r2b", "l4|-"}
+	rightWant := append(append([]string{}, inner...), "-|r3", "-|r6")
+	outer := append(append([]string{}, leftWant...), "-|r3", "-|r6")
+	spill := []JoinOptFunc{WithJoinBudget(2), WithJoinPartitions(3)}
+
+	run("inner", test{kind: JoinInner, want: inner})
+	run("left", test{kind: JoinLeft, want: leftWant})
+	run("right", test{kind: JoinRight, want: rightWant})
+	run("outer", test{kind: JoinOuter, want: outer})
+	run("inner spill", test{kind: JoinInner, opts: spill, want: inner, sorted: true})
+	run("left spill", test{kind: JoinLeft, opts: spill, want: leftWant, sorted: true})
+	run("right spill", test{kind: JoinRight, opts: spill, want: rightWant, sorted: true})
+	run("outer spill", test{kind: JoinOuter, opts: spill, want: outer, sorted: true})
+	run("outer spill one partition", test{
+		kind:   JoinOuter,
+		opts:   []JoinOptFunc{WithJoinBudget(2), WithJoinPartitions(1)},
+		want:   outer,
+		sorted: true,
+	})
+}
+
+func TestHashJoinRepartition(t *testing.T) {
+	left, right := []joinItem{}, []joinItem{}
+	want := []string{}
+	for i := 0; i < 40; i++ {
+		left = append(left, joinItem{i, fmt.Sprint("l", i)})
+		if i%4 != 0 {
+			right = append(right, joinItem{i, fmt.Sprint("r", i)})
+			want = append(want, fmt.Sprintf("l%d|r%d", i, i))
+			continue
+		}
+		want = append(want, fmt.Sprintf("l%d|-", i))
+	}
+	key := func(v joinItem) int { return v.K }
+
+	dir := t.TempDir()
+	// partitions of ~15 values exceed the budget and are partitioned again
+	it := LeftJoinBy(etl.Values(left...), etl.Values(right...), key, key,
+		WithJoinBudget(4), WithJoinPartitions(2), WithJoinTempDir(dir),
+	)
+	got, err := joinStrings[joinItem, joinItem](it)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(got)
+	sort.Strings(want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("LeftJoinBy()\nwant: %v\n got: %v", want, got)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("LeftJoinBy() left %d partition files", len(entries))
+	}
+}
+
+func TestHashJoinSkew(t *testing.T) {
+	right := []joinItem{{1, "a"}, {2, "b"}, {1, "c"}, {1, "d"}, {1, "e"}}
+	key := func(v joinItem) int { return v.K }
+	it := InnerJoinBy(etl.Values(joinItem{1, "l"}), etl.Values(right...), key, key,
+		WithJoinBudget(2), WithJoinTempDir(t.TempDir()),
+	)
+	_, err := joinStrings[joinItem, joinItem](it)
+	if err == nil || !strings.Contains(err.Error(), "key 1 has more right values") {
+		t.Errorf("InnerJoinBy() error = %v, want key skew error", err)
+	}
+}
+
+// joinStrings collects the JoinData values of it as "left|right" with "-"
+// for missing sides.
+func joinStrings[L, R any](it Iter) ([]string, error) {
+	defer it.Close()
+	got := []string{}
+	err := etl.Consume(it, func(d JoinData[L, R]) error {
+		l, r := "-", "-"
+		if d.Left != nil {
+			l = joinItemValue(*d.Left)
+		}
+		if d.Right != nil {
+			r = joinItemValue(*d.Right)
+		}
+		got = append(got, l+"|"+r)
+		return nil
+	})
+	return got, err
+}
+
+func joinItemValue(v any) string {
+	if v, ok := v.(joinItem); ok {
+		return v.V
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,169 @@
+package etlutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"golang.org/x/exp/constraints"
+
+	"github.com/stdiopt/danda/etl"
+)
+
+// MergeJoin joins it1 and it2 that are sorted in ascending order by the keys
+// returned by lkey and rkey, only the values of the current key are kept in
+// memory.
+// Duplicated keys on both sides yield every combination, if any of the
+// iterators is not sorted an error is returned.
+func MergeJoin[L, R any, K constraints.Ordered](kind JoinKind, it1, it2 Iter, lkey func(L) K, rkey func(R) K) Iter {
+	return etl.MakeGen(etl.Gen[JoinData[L, R]]{
+		Run: func(ctx context.Context, yield etl.Y[JoinData[L, R]]) error {
+			left := &sortedGroups[L, K]{it: it1, key: lkey, side: "left"}
+			right := &sortedGroups[R, K]{it: it2, key: rkey, side: "right"}
+
+			yieldLeft := func(vs []L) error {
+				if !kind.keepLeft() {
+					return nil
+				}
+				for _, v1 := range vs {
+					v1 := v1
+					if err := yield(JoinData[L, R]{&v1, nil}); err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+			yieldRight := func(vs []R) error {
+				if !kind.keepRight() {
+					return nil
+				}
+				for _, v2 := range vs {
+					v2 := v2
+					if err := yield(JoinData[L, R]{nil, &v2}); err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+
+			lk, lvs, lok, err := left.next(ctx)
+			if err != nil {
+				return err
+			}
+			rk, rvs, rok, err := right.next(ctx)
+			if err != nil {
+				return err
+			}
+			for lok && rok {
+				switch {
+				case lk < rk:
+					if err := yieldLeft(lvs); err != nil {
+						return err
+					}
+					if lk, lvs, lok, err = left.next(ctx); err != nil {
+						return err
+					}
+				case rk < lk:
+					if err := yieldRight(rvs); err != nil {
+						return err
+					}
+					if rk, rvs, rok, err = right.next(ctx); err != nil {
+						return err
+					}
+				default:
+					for _, v1 := range lvs {
+						for _, v2 := range rvs {
+							v1, v2 := v1, v2 // shadow
+							if err := yield(JoinData[L, R]{&v1, &v2}); err != nil {
+								return err
+							}
+						}
+					}
+					if lk, lvs, lok, err = left.next(ctx); err != nil {
+						return err
+					}
+					if rk, rvs, rok, err = right.next(ctx); err != nil {
+						return err
+					}
+				}
+			}
+			for ; lok && kind.keepLeft(); _, lvs, lok, err = left.next(ctx) {
+				if err := yieldLeft(lvs); err != nil {
+					return err
+				}
+			}
+			if err != nil {
+				return err
+			}
+			for ; rok && kind.keepRight(); _, rvs, rok, err = right.next(ctx) {
+				if err := yieldRight(rvs); err != nil {
+					return err
+				}
+			}
+			return err
+		},
+		Close: func() error {
+			return errors.Join(it1.Close(), it2.Close())
+		},
+	})
+}
+
+// sortedGroups reads consecutive values with the same key from a sorted
+// iterator.
+type sortedGroups[T any, K constraints.Ordered] struct {
+	it   Iter
+	key  func(T) K
+	side string
+
+	peek    *T
+	peekKey K
+	last    K
+	started bool
+	done    bool
+}
+
+// next returns the next key and its values, ok is false when the iterator
+// ends.
+func (g *sortedGroups[T, K]) next(ctx context.Context) (k K, vs []T, ok bool, err error) {
+	if g.peek == nil && !g.done {
+		if err := g.read(ctx); err != nil {
+			return k, nil, false, err
+		}
+	}
+	if g.peek == nil {
+		return k, nil, false, nil
+	}
+	k = g.peekKey
+	for g.peek != nil && g.peekKey == k {
+		vs = append(vs, *g.peek)
+		if err := g.read(ctx); err != nil {
+			return k, nil, false, err
+		}
+	}
+	return k, vs, true, nil
+}
+
+// read reads the next value into peek and checks the order.
+func (g *sortedGroups[T, K]) read(ctx context.Context) error {
+	g.peek = nil
+	vv, err := g.it.Next(ctx)
+	if err == etl.EOI {
+		g.done = true
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	v, ok := vv.(T)
+	if !ok {
+		return fmt.Errorf("MergeJoin: %s type mismatch: %T", g.side, vv)
+	}
+	k := g.key(v)
+	if g.started && k < g.last {
+		return fmt.Errorf("MergeJoin: %s input out of order: %v after %v", g.side, k, g.last)
+	}
+	g.started = true
+	g.last = k
+	g.peek, g.peekKey = &v, k
+	return nil
+}
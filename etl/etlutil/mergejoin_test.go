@@ -0,0 +1,96 @@
+package etlutil
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stdiopt/danda/etl"
+)
+
+func TestMergeJoin(t *testing.T) {
+	key := func(v joinItem) int { return v.K }
+	type test struct {
+		kind    JoinKind
+		left    []joinItem
+		right   []joinItem
+		want    []string
+		wantErr string
+	}
+	run := func(name string, tt test) {
+		t.Helper()
+		t.Run(name, func(t *testing.T) {
+			it := MergeJoin(tt.kind, etl.Values(tt.left...), etl.Values(tt.right...), key, key)
+			got, err := joinStrings[joinItem, joinItem](it)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("MergeJoin(%v) error = %v, want %q", tt.kind, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MergeJoin(%v)\nwant: %v\n got: %v", tt.kind, tt.want, got)
+			}
+		})
+	}
+	left := []joinItem{{1, "l1"}, {2, "l2"}, {2, "l2b"}, {4, "l4"}, {5, "l5"}}
+	right := []joinItem{{2, "r2"}, {2, "r2b"}, {3, "r3"}, {5, "r5"}, {6, "r6"}}
+
+	run("inner duplicates cross product", test{
+		kind:  JoinInner,
+		left:  left,
+		right: right,
+		want:  []string{"l2|r2", "l2|r2b", "l2b|r2", "l2b|r2b", "l5|r5"},
+	})
+	run("left", test{
+		kind:  JoinLeft,
+		left:  left,
+		right: right,
+		want:  []string{"l1|-", "l2|r2", "l2|r2b", "l2b|r2", "l2b|r2b", "l4|-", "l5|r5"},
+	})
+	run("right", test{
+		kind:  JoinRight,
+		left:  left,
+		right: right,
+		want:  []string{"l2|r2", "l2|r2b", "l2b|r2", "l2b|r2b", "-|r3", "l5|r5", "-|r6"},
+	})
+	run("outer", test{
+		kind:  JoinOuter,
+		left:  left,
+		right: right,
+		want: []string{
+			"l1|-", "l2|r2", "l2|r2b", "l2b|r2", "l2b|r2b", "-|r3", "l4|-", "l5|r5", "-|r6",
+		},
+	})
+	run("outer empty left", test{
+		kind:  JoinOuter,
+		right: []joinItem{{1, "r1"}, {1, "r1b"}},
+		want:  []string{"-|r1", "-|r1b"},
+	})
+	run("left empty right", test{
+		kind: JoinLeft,
+		left: []joinItem{{1, "l1"}, {1, "l1b"}},
+		want: []string{"l1|-", "l1b|-"},
+	})
+	run("left unsorted", test{
+		kind:    JoinInner,
+		left:    []joinItem{{2, "l2"}, {1, "l1"}},
+		right:   right,
+		wantErr: "left input out of order: 1 after 2",
+	})
+	run("right unsorted", test{
+		kind:    JoinOuter,
+		left:    left,
+		right:   []joinItem{{2, "r2"}, {6, "r6"}, {3, "r3"}},
+		wantErr: "right input out of order: 3 after 6",
+	})
+	run("unsorted after the other side ends", test{
+		kind:    JoinLeft,
+		left:    []joinItem{{1, "l1"}, {5, "l5"}, {4, "l4"}},
+		right:   []joinItem{{1, "r1"}},
+		wantErr: "left input out of order: 4 after 5",
+	})
+}
@@ -0,0 +1,49 @@
+package etlutil
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stdiopt/danda/etl"
+)
+
+func TestTee(t *testing.T) {
+	errSrc := errors.New("source close error")
+	src := etl.Seq(0, 10, 1)
+	it := etl.MakeIter(etl.Custom[any]{
+		Next: src.Next,
+		Close: func() error {
+			src.Close() // nolint: errcheck
+			return errSrc
+		},
+	})
+
+	side := []int{}
+	main := Tee(it, func(it Iter) {
+		etl.Consume(it, func(v int) error { // nolint: errcheck
+			time.Sleep(time.Millisecond)
+			side = append(side, v)
+			return nil
+		})
+	})
+	got := []int{}
+	for {
+		v, err := main.Next(context.Background())
+		if err == etl.EOI {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, v.(int))
+	}
+	if err := main.Close(); !errors.Is(err, errSrc) {
+		t.Errorf("Close() error = %v, want %v", err, errSrc)
+	}
+	// Close waited for fn, side is complete.
+	if len(got) != 10 || len(side) != 10 {
+		t.Errorf("Tee() read %d values and %d on the side, want 10", len(got), len(side))
+	}
+}
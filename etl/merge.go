@@ -0,0 +1,278 @@
+package etl
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// Merge returns an iterator that yields values from all iterators as they
+// arrive, each iterator is consumed concurrently so the order between
+// iterators is not preserved.
+// The first error stops all iterators, Close waits for the readers to stop
+// before closing the iterators.
+func Merge(its ...Iter) Iter {
+	its = append([]Iter{}, its...)
+	m := &merge{
+		its:  its,
+		ch:   make(chan msg[any]),
+		done: make(chan struct{}),
+	}
+	m.ctx, m.cancel = context.WithCancelCause(context.Background())
+	return m
+}
+
+type merge struct {
+	its    []Iter
+	ch     chan msg[any]
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+
+	startOnce sync.Once
+	mu        sync.Mutex
+	started   bool
+	closed    bool
+	done      chan struct{}
+}
+
+func (m *merge) start() {
+	m.startOnce.Do(func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if m.closed {
+			return
+		}
+		m.started = true
+		go m.run()
+	})
+}
+
+func (m *merge) run() {
+	defer close(m.done)
+	defer close(m.ch)
+	eg, ctx := errgroup.WithContext(m.ctx)
+	for _, it := range m.its {
+		it := it
+		eg.Go(func() error {
+			return ConsumeContext(ctx, it, func(v any) error {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case m.ch <- msg[any]{value: v}:
+					return nil
+				}
+			})
+		})
+	}
+	if err := eg.Wait(); err != nil {
+		select {
+		case <-m.ctx.Done():
+		case m.ch <- msg[any]{err: err}:
+		}
+	}
+}
+
+func (m *merge) Next(ctx context.Context) (any, error) {
+	m.start()
+	if err := ctx.Err(); err != nil {
+		m.cancel(err)
+		return nil, err
+	}
+	select {
+	case <-ctx.Done():
+		m.cancel(ctx.Err())
+		return nil, ctx.Err()
+	case v, ok := <-m.ch:
+		if !ok {
+			if err := context.Cause(m.ctx); err != nil {
+				return nil, err
+			}
+			return nil, EOI
+		}
+		return v.value, v.err
+	case <-m.ctx.Done():
+		return nil, context.Cause(m.ctx)
+	}
+}
+
+func (m *merge) Close() error {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil
+	}
+	m.closed = true
+	started := m.started
+	m.mu.Unlock()
+
+	m.cancel(ErrCancelled)
+	if started {
+		<-m.done
+	}
+	return closeAll(m.its)
+}
+
+// MergeSorted merges iterators that are sorted by less into a single sorted
+// iterator, values that are equal are yielded in the order of its.
+func MergeSorted[T any](less func(a, b T) bool, its ...Iter) Iter {
+	its = append([]Iter{}, its...)
+	var h *mergeHeap[T]
+	return MakeIter(Custom[T]{
+		Next: func(ctx context.Context) (T, error) {
+			var z T
+			if h == nil {
+				h = &mergeHeap[T]{less: less}
+				for i := range its {
+					if err := h.fetch(ctx, its, i); err != nil {
+						return z, err
+					}
+				}
+				heap.Init(h)
+			}
+			if h.Len() == 0 {
+				return z, EOI
+			}
+			head := h.items[0]
+			if err := h.fetch(ctx, its, head.src); err != nil {
+				return z, err
+			}
+			// fetch appended the next value of head.src, if any, swap it
+			// with the head before fixing the heap.
+			if last := len(h.items) - 1; last > 0 && h.items[last].src == head.src {
+				h.items[0] = h.items[last]
+				h.items = h.items[:last]
+				heap.Fix(h, 0)
+			} else {
+				heap.Pop(h)
+			}
+			return head.value, nil
+		},
+		Close: func() error {
+			return closeAll(its)
+		},
+	})
+}
+
+type mergeItem[T any] struct {
+	value T
+	src   int
+}
+
+type mergeHeap[T any] struct {
+	items []mergeItem[T]
+	less  func(a, b T) bool
+}
+
+// fetch appends the next value of its[i] to the heap items if any.
+func (h *mergeHeap[T]) fetch(ctx context.Context, its []Iter, i int) error {
+	vv, err := its[i].Next(ctx)
+	if err == EOI {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	v, ok := vv.(T)
+	if !ok {
+		return fmt.Errorf("iter.MergeSorted: type mismatch: %T", vv)
+	}
+	h.items = append(h.items, mergeItem[T]{value: v, src: i})
+	return nil
+}
+
+func (h mergeHeap[T]) Len() int { return len(h.items) }
+
+func (h mergeHeap[T]) Less(i, j int) bool {
+	a, b := h.items[i], h.items[j]
+	if h.less(a.value, b.value) {
+		return true
+	}
+	if h.less(b.value, a.value) {
+		return false
+	}
+	return a.src < b.src
+}
+
+func (h mergeHeap[T]) Swap(i, j int) { h.items[i], h.items[j] = h.items[j], h.items[i] }
+
+func (h *mergeHeap[T]) Push(x any) { h.items = append(h.items, x.(mergeItem[T])) }
+
+func (h *mergeHeap[T]) Pop() any {
+	last := len(h.items) - 1
+	v := h.items[last]
+	h.items = h.items[:last]
+	return v
+}
+
+// Pair is the value yielded by Zip.
+type Pair[A, B any] struct {
+	First  A
+	Second B
+}
+
+func (p Pair[A, B]) String() string {
+	return fmt.Sprintf("(%v, %v)", p.First, p.Second)
+}
+
+// Zip returns an iterator that pairs the values of a and b element-wise,
+// it stops when any of the iterators ends.
+func Zip[A, B any](a, b Iter) Iter {
+	return MakeIter(Custom[Pair[A, B]]{
+		Next: func(ctx context.Context) (Pair[A, B], error) {
+			var p Pair[A, B]
+			va, err := a.Next(ctx)
+			if err != nil {
+				return p, err
+			}
+			vb, err := b.Next(ctx)
+			if err != nil {
+				return p, err
+			}
+			var ok bool
+			if p.First, ok = va.(A); !ok {
+				return p, fmt.Errorf("iter.Zip: type mismatch: %T", va)
+			}
+			if p.Second, ok = vb.(B); !ok {
+				return p, fmt.Errorf("iter.Zip: type mismatch: %T", vb)
+			}
+			return p, nil
+		},
+		Close: func() error {
+			return closeAll([]Iter{a, b})
+		},
+	})
+}
+
+// ZipN returns an iterator that yields a []any with a value of each iterator,
+// it stops when any of the iterators ends.
+func ZipN(its ...Iter) Iter {
+	its = append([]Iter{}, its...)
+	return MakeIter(Custom[[]any]{
+		Next: func(ctx context.Context) ([]any, error) {
+			vals := make([]any, len(its))
+			for i, it := range its {
+				v, err := it.Next(ctx)
+				if err != nil {
+					return nil, err
+				}
+				vals[i] = v
+			}
+			return vals, nil
+		},
+		Close: func() error {
+			return closeAll(its)
+		},
+	})
+}
+
+func closeAll(its []Iter) error {
+	var err error
+	for _, it := range its {
+		err = errors.Join(err, it.Close())
+	}
+	return err
+}
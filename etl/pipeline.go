@@ -0,0 +1,287 @@
+package etl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// StageHook wraps the output of a pipeline stage, it can be used to add
+// metrics or logging to every stage.
+type StageHook func(name string, it Iter) Iter
+
+type pipeKind int
+
+const (
+	pipeSource pipeKind = iota
+	pipeStage
+	pipeSink
+)
+
+type pipeNode struct {
+	name   string
+	kind   pipeKind
+	inputs []string
+
+	src   Iter
+	stage func(...Iter) Iter
+	sink  func(context.Context, Iter) error
+}
+
+// Pipeline is a builder of a graph of named stages.
+//
+// Sources produce iterators, stages transform the iterators of their inputs
+// and sinks consume an input, the output of a stage with several consumers
+// is broadcasted to each of them.
+// Run runs all sinks concurrently with a single context and closes every
+// iterator of the pipeline when done, a failing sink cancels the context
+// which stops the stages and the other sinks.
+//
+//	p := etl.NewPipeline()
+//	p.Source("users", etlcsv.Decode(etlfs.ReadFile("users.csv")))
+//	p.Stage("active", func(in ...etl.Iter) etl.Iter {
+//		return etl.Filter(in[0], isActive)
+//	}, "users")
+//	p.Sink("db", func(ctx context.Context, it etl.Iter) error {
+//		return db.Insert(it, "public", "users")
+//	}, "active")
+//	p.Sink("backup", func(_ context.Context, it etl.Iter) error {
+//		return etlfs.WriteFile(etlcsv.Encode(it), "backup.csv")
+//	}, "users")
+//	err := p.Run(ctx)
+type Pipeline struct {
+	nodes  []*pipeNode
+	byName map[string]*pipeNode
+	hooks  []StageHook
+	err    error
+}
+
+// NewPipeline returns a new empty Pipeline.
+func NewPipeline() *Pipeline {
+	return &Pipeline{
+		byName: map[string]*pipeNode{},
+	}
+}
+
+// Use adds hooks that wrap the output of every source and stage.
+func (p *Pipeline) Use(hooks ...StageHook) *Pipeline {
+	p.hooks = append(p.hooks, hooks...)
+	return p
+}
+
+// Source adds a named source iterator.
+func (p *Pipeline) Source(name string, it Iter) *Pipeline {
+	return p.add(&pipeNode{name: name, kind: pipeSource, src: it})
+}
+
+// Stage adds a named stage that receives the outputs of inputs in the same
+// order and returns its output.
+func (p *Pipeline) Stage(name string, fn func(...Iter) Iter, inputs ...string) *Pipeline {
+	if len(inputs) == 0 {
+		p.err = errors.Join(p.err, fmt.Errorf("pipeline: stage %q has no inputs", name))
+	}
+	return p.add(&pipeNode{name: name, kind: pipeStage, stage: fn, inputs: inputs})
+}
+
+// Sink adds a named sink that consumes the output of input.
+func (p *Pipeline) Sink(name string, fn func(context.Context, Iter) error, input string) *Pipeline {
+	return p.add(&pipeNode{name: name, kind: pipeSink, sink: fn, inputs: []string{input}})
+}
+
+func (p *Pipeline) add(n *pipeNode) *Pipeline {
+	if _, ok := p.byName[n.name]; ok {
+		p.err = errors.Join(p.err, fmt.Errorf("pipeline: duplicated name %q", n.name))
+		return p
+	}
+	p.byName[n.name] = n
+	p.nodes = append(p.nodes, n)
+	return p
+}
+
+// Run builds the iterators and runs all sinks until they finish or the
+// first error, every iterator is closed before returning.
+func (p *Pipeline) Run(ctx context.Context) error {
+	if p.err != nil {
+		p.closeSources()
+		return p.err
+	}
+	order, err := p.sort()
+	if err != nil {
+		p.closeSources()
+		return err
+	}
+
+	consumers := map[string]int{}
+	for _, n := range p.nodes {
+		for _, in := range n.inputs {
+			consumers[in]++
+		}
+	}
+	sinks := 0
+	for _, n := range order {
+		if n.kind == pipeSink {
+			sinks++
+			continue
+		}
+		if consumers[n.name] == 0 {
+			err = errors.Join(err, fmt.Errorf("pipeline: output of %q is not consumed", n.name))
+		}
+	}
+	if sinks == 0 {
+		err = errors.Join(err, errors.New("pipeline: no sinks"))
+	}
+	if err != nil {
+		p.closeSources()
+		return err
+	}
+
+	eg, ctx := errgroup.WithContext(ctx)
+
+	var all []*pipeIter
+	track := func(it Iter) Iter {
+		pit := &pipeIter{Iter: it, ctx: ctx}
+		all = append(all, pit)
+		return pit
+	}
+	// outputs are the iterators available to consumers by node name.
+	outputs := map[string][]Iter{}
+	take := func(name string) Iter {
+		its := outputs[name]
+		outputs[name] = its[1:]
+		return its[0]
+	}
+
+	for _, n := range order {
+		var out Iter
+		switch n.kind {
+		case pipeSource:
+			out = track(n.src)
+		case pipeStage:
+			ins := make([]Iter, len(n.inputs))
+			for i, in := range n.inputs {
+				ins[i] = take(in)
+			}
+			out = track(n.stage(ins...))
+		case pipeSink:
+			n, in := n, take(n.inputs[0])
+			eg.Go(func() (err error) {
+				// detach from a broadcast as soon as the sink returns so
+				// the other consumers don't block on it.
+				defer func() {
+					CloseWithError(in, err) // nolint: errcheck
+				}()
+				if err := n.sink(ctx, in); err != nil {
+					return fmt.Errorf("pipeline: sink %q: %w", n.name, err)
+				}
+				return nil
+			})
+			continue
+		}
+		for _, h := range p.hooks {
+			out = track(h(n.name, out))
+		}
+		if c := consumers[n.name]; c > 1 {
+			for _, b := range Broadcast(out, c) {
+				outputs[n.name] = append(outputs[n.name], track(b))
+			}
+			continue
+		}
+		outputs[n.name] = []Iter{out}
+	}
+	err = eg.Wait()
+
+	// close from the sinks to the sources, broadcast branches return the
+	// same error so it's only reported once.
+	var cerr error
+	for i := len(all) - 1; i >= 0; i-- {
+		if e := all[i].Close(); e != nil && !errors.Is(cerr, e) {
+			cerr = errors.Join(cerr, e)
+		}
+	}
+	return errors.Join(err, cerr)
+}
+
+// sort returns the nodes in topological order.
+func (p *Pipeline) sort() ([]*pipeNode, error) {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := map[string]int{}
+	var order []*pipeNode
+	var visit func(n *pipeNode) error
+	visit = func(n *pipeNode) error {
+		switch state[n.name] {
+		case visiting:
+			return fmt.Errorf("pipeline: cycle at %q", n.name)
+		case visited:
+			return nil
+		}
+		state[n.name] = visiting
+		for _, in := range n.inputs {
+			dep, ok := p.byName[in]
+			if !ok {
+				return fmt.Errorf("pipeline: %q input %q not found", n.name, in)
+			}
+			if dep.kind == pipeSink {
+				return fmt.Errorf("pipeline: %q input %q is a sink", n.name, in)
+			}
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		state[n.name] = visited
+		order = append(order, n)
+		return nil
+	}
+	for _, n := range p.nodes {
+		if err := visit(n); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// closeSources closes the source iterators when the pipeline doesn't run.
+func (p *Pipeline) closeSources() {
+	for _, n := range p.nodes {
+		if n.kind == pipeSource && n.src != nil {
+			n.src.Close() // nolint: errcheck
+		}
+	}
+}
+
+// pipeIter is an iterator that can be closed several times, by the stage
+// that consumes it and by the pipeline, it stops once the pipeline context
+// is cancelled since stages might consume it with other contexts.
+type pipeIter struct {
+	Iter
+	ctx  context.Context
+	once sync.Once
+	err  error
+}
+
+func (it *pipeIter) Next(ctx context.Context) (any, error) {
+	if err := it.ctx.Err(); err != nil {
+		return nil, context.Cause(it.ctx)
+	}
+	return it.Iter.Next(ctx)
+}
+
+func (it *pipeIter) Close() error {
+	it.once.Do(func() {
+		it.err = it.Iter.Close()
+	})
+	return it.err
+}
+
+func (it *pipeIter) CloseWithError(err error) error {
+	it.once.Do(func() {
+		it.err = CloseWithError(it.Iter, err)
+	})
+	return it.err
+}
@@ -0,0 +1,36 @@
+package etl
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPipelineSinkError(t *testing.T) {
+	errSink := errors.New("sink error")
+
+	p := NewPipeline()
+	p.Source("nums", Seq(0, 1000, 1))
+	p.Sink("a", func(ctx context.Context, it Iter) error {
+		if _, err := it.Next(ctx); err != nil {
+			return err
+		}
+		return errSink
+	}, "nums")
+	// b ignores the context as sinks that don't take one do.
+	p.Sink("b", func(_ context.Context, it Iter) error {
+		return Consume(it, func(int) error { return nil })
+	}, "nums")
+
+	done := make(chan error, 1)
+	go func() { done <- p.Run(context.Background()) }()
+	select {
+	case err := <-done:
+		if !errors.Is(err, errSink) {
+			t.Errorf("Run() error = %v, want %v", err, errSink)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run() did not return")
+	}
+}
@@ -0,0 +1,100 @@
+package etl
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Limiter is a token bucket rate limiter, it can be shared by several stages
+// and worker pools so a whole pipeline respects an upstream quota.
+type Limiter struct {
+	mu       sync.Mutex
+	interval time.Duration // time to refill one token
+	burst    float64
+	tokens   float64
+	last     time.Time
+}
+
+// NewLimiter returns a limiter that allows rate events per second with bursts
+// of at most burst events, if rate <= 0 there is no limit.
+func NewLimiter(rate float64, burst int) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	l := &Limiter{
+		burst:  float64(burst),
+		tokens: float64(burst),
+	}
+	if rate > 0 {
+		l.interval = time.Duration(float64(time.Second) / rate)
+	}
+	return l
+}
+
+// Wait blocks until an event is allowed or ctx is done.
+func (l *Limiter) Wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := sleepContext(ctx, l.reserve()); err != nil {
+		l.release()
+		return err
+	}
+	return nil
+}
+
+// reserve takes a token and returns the time to wait until it's available.
+func (l *Limiter) reserve() time.Duration {
+	if l.interval <= 0 {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if !l.last.IsZero() {
+		l.tokens += float64(now.Sub(l.last)) / float64(l.interval)
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+	}
+	l.last = now
+	l.tokens--
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens * float64(l.interval))
+}
+
+// release returns a reserved token that wasn't used.
+func (l *Limiter) release() {
+	if l.interval <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tokens++
+}
+
+// RateLimit returns an iterator that yields at most rate values per second
+// from it with bursts of at most burst values.
+func RateLimit(it Iter, rate float64, burst int) Iter {
+	return RateLimitWith(it, NewLimiter(rate, burst))
+}
+
+// RateLimitWith returns an iterator that waits on the limiter l before
+// fetching each value from it.
+func RateLimitWith(it Iter, l *Limiter) Iter {
+	return MakeIter(Custom[any]{
+		Next: func(ctx context.Context) (any, error) {
+			if err := l.Wait(ctx); err != nil {
+				return nil, err
+			}
+			return it.Next(ctx)
+		},
+		Close: it.Close,
+	})
+}
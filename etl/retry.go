@@ -0,0 +1,264 @@
+package etl
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"syscall"
+	"time"
+)
+
+type retryOptions struct {
+	attempts  int
+	initial   time.Duration
+	max       time.Duration
+	factor    float64
+	jitter    float64
+	retryable func(error) bool
+	onRetry   func(attempt int, err error)
+}
+
+type RetryOptFunc func(*retryOptions)
+
+// WithAttempts sets the maximum number of attempts, including the first one.
+func WithAttempts(n int) RetryOptFunc {
+	return func(o *retryOptions) {
+		o.attempts = n
+	}
+}
+
+// WithBackoff sets the initial and the maximum delay between attempts.
+func WithBackoff(initial, max time.Duration) RetryOptFunc {
+	return func(o *retryOptions) {
+		o.initial = initial
+		o.max = max
+	}
+}
+
+// WithBackoffFactor sets the multiplier applied to the delay on each attempt.
+func WithBackoffFactor(f float64) RetryOptFunc {
+	return func(o *retryOptions) {
+		o.factor = f
+	}
+}
+
+// WithJitter sets the random fraction [0,1] of the delay that is added or
+// removed from each delay.
+func WithJitter(j float64) RetryOptFunc {
+	return func(o *retryOptions) {
+		o.jitter = j
+	}
+}
+
+// WithRetryIf sets the func that classifies if an error is retryable, by
+// default errors marked with Transient and network errors are retried, see
+// Retryable.
+func WithRetryIf(fn func(error) bool) RetryOptFunc {
+	return func(o *retryOptions) {
+		o.retryable = fn
+	}
+}
+
+// WithOnRetry sets a func that is called before each retry with the number
+// of the failed attempt and the error.
+func WithOnRetry(fn func(attempt int, err error)) RetryOptFunc {
+	return func(o *retryOptions) {
+		prev := o.onRetry
+		o.onRetry = func(attempt int, err error) {
+			if prev != nil {
+				prev(attempt, err)
+			}
+			fn(attempt, err)
+		}
+	}
+}
+
+// Transient marks err as retryable by the default classifier.
+func Transient(err error) error {
+	if err == nil {
+		return nil
+	}
+	return transientError{err}
+}
+
+// IsTransient reports if err was marked with Transient.
+func IsTransient(err error) bool {
+	var terr transientError
+	return errors.As(err, &terr)
+}
+
+// Retryable is the default retry classifier, it reports if err was marked
+// with Transient or is a network error.
+func Retryable(err error) bool {
+	return IsTransient(err) || IsNetworkError(err)
+}
+
+// IsNetworkError reports if err is a network timeout or a connection that
+// was reset, refused or closed before the response ended.
+func IsNetworkError(err error) bool {
+	var nerr net.Error
+	if errors.As(err, &nerr) && nerr.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+type transientError struct {
+	err error
+}
+
+func (e transientError) Error() string { return e.err.Error() }
+
+func (e transientError) Unwrap() error { return e.err }
+
+func makeRetryOptions(opts ...RetryOptFunc) retryOptions {
+	o := retryOptions{
+		attempts: 3,
+		initial:  100 * time.Millisecond,
+		max:      10 * time.Second,
+		factor:   2,
+		jitter:   0.2,
+	}
+	for _, fn := range opts {
+		fn(&o)
+	}
+	return o
+}
+
+// shouldRetry returns true if err can be retried after the attempt n.
+func (o retryOptions) shouldRetry(n int, err error) bool {
+	if n >= o.attempts {
+		return false
+	}
+	if err == EOI || errors.Is(err, ErrSkip) ||
+		errors.Is(err, context.Canceled) ||
+		errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if o.retryable != nil {
+		return o.retryable(err)
+	}
+	return Retryable(err)
+}
+
+// delay returns the backoff duration after the attempt n.
+func (o retryOptions) delay(n int) time.Duration {
+	d := float64(o.initial)
+	for i := 1; i < n; i++ {
+		d *= o.factor
+		if o.max > 0 && d > float64(o.max) {
+			d = float64(o.max)
+			break
+		}
+	}
+	if o.jitter > 0 {
+		d += d * o.jitter * (rand.Float64()*2 - 1)
+	}
+	if o.max > 0 && d > float64(o.max) {
+		d = float64(o.max)
+	}
+	return time.Duration(d)
+}
+
+// wait is called after a failed attempt n, it returns an error if the
+// context is done before the backoff delay.
+func (o retryOptions) wait(ctx context.Context, n int, err error) error {
+	if o.onRetry != nil {
+		o.onRetry(n, err)
+	}
+	return sleepContext(ctx, o.delay(n))
+}
+
+// RetryDo calls fn until it succeeds, the error is not retryable or the
+// maximum number of attempts is reached, in which case the last error is
+// returned.
+func RetryDo(ctx context.Context, fn func(context.Context) error, opts ...RetryOptFunc) error {
+	o := makeRetryOptions(opts...)
+	for n := 1; ; n++ {
+		err := fn(ctx)
+		if err == nil || !o.shouldRetry(n, err) {
+			return err
+		}
+		if werr := o.wait(ctx, n, err); werr != nil {
+			return werr
+		}
+	}
+}
+
+// RetryFunc wraps fn so it's retried with backoff, it can be used in MapE
+// and WorkersMap.
+func RetryFunc[Ti, To any](fn func(context.Context, Ti) (To, error), opts ...RetryOptFunc) func(context.Context, Ti) (To, error) {
+	o := makeRetryOptions(opts...)
+	return func(ctx context.Context, v Ti) (To, error) {
+		for n := 1; ; n++ {
+			r, err := fn(ctx, v)
+			if err == nil || !o.shouldRetry(n, err) {
+				return r, err
+			}
+			if werr := o.wait(ctx, n, err); werr != nil {
+				return r, werr
+			}
+		}
+	}
+}
+
+// Retry returns an iterator over the iterator returned by open, if it fails
+// before producing any value it will be closed and opened again with backoff.
+// Errors after the first value are returned as is since retrying would
+// produce duplicates.
+//
+//	it := etl.Retry(func() etl.Iter {
+//		return etlhttp.Get(url)
+//	}, etl.WithAttempts(5))
+func Retry(open func() Iter, opts ...RetryOptFunc) Iter {
+	o := makeRetryOptions(opts...)
+	var cur Iter
+	started := false
+	return MakeIter(Custom[any]{
+		Next: func(ctx context.Context) (any, error) {
+			for n := 1; ; n++ {
+				if cur == nil {
+					cur = open()
+				}
+				v, err := cur.Next(ctx)
+				if err == nil {
+					started = true
+					return v, nil
+				}
+				if started || !o.shouldRetry(n, err) {
+					return nil, err
+				}
+				cur.Close() // nolint: errcheck
+				cur = nil
+				if werr := o.wait(ctx, n, err); werr != nil {
+					return nil, werr
+				}
+			}
+		},
+		Close: func() error {
+			if cur == nil {
+				return nil
+			}
+			return cur.Close()
+		},
+	})
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,63 @@
+package etl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestRetryable(t *testing.T) {
+	type test struct {
+		err  error
+		want bool
+	}
+	run := func(name string, tt test) {
+		t.Helper()
+		t.Run(name, func(t *testing.T) {
+			if got := Retryable(tt.err); got != tt.want {
+				t.Errorf("Retryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+	timeout := &net.OpError{Op: "read", Net: "tcp", Err: os.ErrDeadlineExceeded}
+	reset := &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}
+
+	run("plain error", test{err: errors.New("fail"), want: false})
+	run("transient", test{err: fmt.Errorf("wrap: %w", Transient(errors.New("fail"))), want: true})
+	run("timeout", test{err: fmt.Errorf("wrap: %w", timeout), want: true})
+	run("connection reset", test{err: fmt.Errorf("wrap: %w", reset), want: true})
+	run("connection refused", test{err: syscall.ECONNREFUSED, want: true})
+	run("unexpected eof", test{err: io.ErrUnexpectedEOF, want: true})
+	run("dns not found", test{err: &net.DNSError{Err: "no such host", IsNotFound: true}, want: false})
+}
+
+func TestRetryDoDefault(t *testing.T) {
+	type test struct {
+		err          error
+		wantAttempts int
+	}
+	run := func(name string, tt test) {
+		t.Helper()
+		t.Run(name, func(t *testing.T) {
+			attempts := 0
+			err := RetryDo(context.Background(), func(context.Context) error {
+				attempts++
+				return tt.err
+			}, WithAttempts(3), WithBackoff(0, 0))
+			if !errors.Is(err, tt.err) {
+				t.Errorf("RetryDo() error = %v, want %v", err, tt.err)
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("RetryDo() attempts = %d, want %d", attempts, tt.wantAttempts)
+			}
+		})
+	}
+	run("network error", test{err: syscall.ECONNRESET, wantAttempts: 3})
+	run("permanent error", test{err: errors.New("fail"), wantAttempts: 1})
+	run("canceled", test{err: context.Canceled, wantAttempts: 1})
+}
@@ -0,0 +1,137 @@
+//go:build go1.23
+
+package etl
+
+import (
+	"context"
+	"fmt"
+	stditer "iter"
+)
+
+// All returns an iter.Seq2 that ranges over the values of it, any error is
+// passed as the second value and ends the loop.
+// The iterator is closed when the loop ends, including early breaks.
+//
+//	for row, err := range etl.All[drow.Row](ctx, it) {
+//		if err != nil {
+//			return err
+//		}
+//		...
+//	}
+func All[T any](ctx context.Context, it Iter) stditer.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		defer it.Close()
+		var z T
+		for {
+			if err := ctx.Err(); err != nil {
+				yield(z, err)
+				return
+			}
+			vv, err := it.Next(ctx)
+			if err == EOI {
+				return
+			}
+			if err != nil {
+				yield(z, err)
+				return
+			}
+			v, ok := vv.(T)
+			if !ok {
+				yield(z, fmt.Errorf("iter.All: type mismatch: %T", vv))
+				return
+			}
+			if !yield(v, nil) {
+				return
+			}
+		}
+	}
+}
+
+// Elems returns an iter.Seq that ranges over the values of it, if an error
+// occurs the loop ends and the error is stored in errp.
+// The iterator is closed when the loop ends, including early breaks.
+//
+//	var err error
+//	for row := range etl.Elems[drow.Row](ctx, it, &err) {
+//		...
+//	}
+//	if err != nil {
+//		return err
+//	}
+func Elems[T any](ctx context.Context, it Iter, errp *error) stditer.Seq[T] {
+	return func(yield func(T) bool) {
+		for v, err := range All[T](ctx, it) {
+			if err != nil {
+				if errp != nil {
+					*errp = err
+				}
+				return
+			}
+			if !yield(v) {
+				return
+			}
+		}
+	}
+}
+
+// TypedAll is the TypedIter version of All.
+func TypedAll[T any](ctx context.Context, it TypedIter[T]) stditer.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		defer it.Close()
+		for {
+			if err := ctx.Err(); err != nil {
+				var z T
+				yield(z, err)
+				return
+			}
+			v, err := it.Next(ctx)
+			if err == EOI {
+				return
+			}
+			if err != nil {
+				yield(v, err)
+				return
+			}
+			if !yield(v, nil) {
+				return
+			}
+		}
+	}
+}
+
+// FromSeq returns an iterator that yields the values of seq.
+// Closing the iterator stops the sequence.
+func FromSeq[T any](seq stditer.Seq[T]) Iter {
+	return MakeGen(Gen[T]{
+		Run: func(_ context.Context, yield Y[T]) error {
+			var err error
+			for v := range seq {
+				if err = yield(v); err != nil {
+					break
+				}
+			}
+			return err
+		},
+	})
+}
+
+// FromSeq2 returns an iterator that yields the values of seq, the iteration
+// stops on the first non nil error which is returned by Next.
+// Closing the iterator stops the sequence.
+func FromSeq2[T any](seq stditer.Seq2[T, error]) Iter {
+	return MakeGen(Gen[T]{
+		Run: func(_ context.Context, yield Y[T]) error {
+			var err error
+			for v, serr := range seq {
+				if serr != nil {
+					err = serr
+					break
+				}
+				if err = yield(v); err != nil {
+					break
+				}
+			}
+			return err
+		},
+	})
+}
@@ -0,0 +1,201 @@
+package etl
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+type sortOptions struct {
+	budget  int
+	tempDir string
+	codec   any
+}
+
+type SortOptFunc func(*sortOptions)
+
+// WithSortBudget sets the maximum number of values kept in memory, when
+// exceeded the values are sorted and spilled to a temporary file.
+func WithSortBudget(n int) SortOptFunc {
+	return func(o *sortOptions) {
+		o.budget = n
+	}
+}
+
+// WithSortTempDir sets the directory for the temporary files, defaults to
+// os.TempDir.
+func WithSortTempDir(dir string) SortOptFunc {
+	return func(o *sortOptions) {
+		o.tempDir = dir
+	}
+}
+
+// WithSortCodec sets the codec used to spill values to disk, defaults to
+// GobCodec.
+func WithSortCodec[T any](c Codec[T]) SortOptFunc {
+	return func(o *sortOptions) {
+		o.codec = c
+	}
+}
+
+func makeSortOptions(opts ...SortOptFunc) sortOptions {
+	o := sortOptions{
+		budget: 100_000,
+	}
+	for _, fn := range opts {
+		fn(&o)
+	}
+	return o
+}
+
+// Sort returns an iterator that yields the values of it sorted by less, the
+// sort is stable.
+// The input is consumed on the first Next, up to the budget values are
+// sorted in memory, beyond that sorted runs are spilled to temporary files
+// and merged back, the files are removed on Close.
+func Sort[T any](it Iter, less func(a, b T) bool, opts ...SortOptFunc) Iter {
+	o := makeSortOptions(opts...)
+	s := &sorter[T]{
+		less:  less,
+		opts:  o,
+		codec: GobCodec[T](),
+	}
+	var merged Iter
+	return MakeIter(Custom[T]{
+		Next: func(ctx context.Context) (T, error) {
+			var z T
+			if merged == nil {
+				if err := s.init(); err != nil {
+					return z, err
+				}
+				m, err := s.sort(ctx, it)
+				if err != nil {
+					return z, err
+				}
+				merged = m
+			}
+			vv, err := merged.Next(ctx)
+			if err != nil {
+				return z, err
+			}
+			v, _ := vv.(T)
+			return v, nil
+		},
+		Close: func() error {
+			err := it.Close()
+			if merged != nil {
+				err = errors.Join(err, merged.Close())
+			}
+			return errors.Join(err, s.cleanup())
+		},
+	})
+}
+
+type sorter[T any] struct {
+	less  func(a, b T) bool
+	opts  sortOptions
+	codec Codec[T]
+	files []*os.File
+}
+
+func (s *sorter[T]) init() error {
+	if s.opts.codec == nil {
+		return nil
+	}
+	c, ok := s.opts.codec.(Codec[T])
+	if !ok {
+		return fmt.Errorf("iter.Sort: codec type mismatch: %T", s.opts.codec)
+	}
+	s.codec = c
+	return nil
+}
+
+// sort consumes it and returns an iterator over the sorted values.
+func (s *sorter[T]) sort(ctx context.Context, it Iter) (Iter, error) {
+	var buf []T
+	err := ConsumeContext(ctx, it, func(v T) error {
+		buf = append(buf, v)
+		if s.opts.budget <= 0 || len(buf) < s.opts.budget {
+			return nil
+		}
+		if err := s.spill(buf); err != nil {
+			return err
+		}
+		buf = buf[:0]
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(buf, func(i, j int) bool {
+		return s.less(buf[i], buf[j])
+	})
+	if len(s.files) == 0 {
+		return Values(buf...), nil
+	}
+	runs := make([]Iter, 0, len(s.files)+1)
+	for _, f := range s.files {
+		r, err := s.run(f)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, r)
+	}
+	// remaining values are the last run so equal values keep the input order.
+	runs = append(runs, Values(buf...))
+	return MergeSorted(s.less, runs...), nil
+}
+
+// spill sorts vals and writes them to a new temporary file.
+func (s *sorter[T]) spill(vals []T) error {
+	sort.SliceStable(vals, func(i, j int) bool {
+		return s.less(vals[i], vals[j])
+	})
+	f, err := os.CreateTemp(s.opts.tempDir, "etl-sort-*")
+	if err != nil {
+		return err
+	}
+	s.files = append(s.files, f)
+
+	w := bufio.NewWriter(f)
+	enc := s.codec.NewEncoder(w)
+	for _, v := range vals {
+		if err := enc(v); err != nil {
+			return fmt.Errorf("iter.Sort: encoding: %w", err)
+		}
+	}
+	return w.Flush()
+}
+
+// run returns an iterator over the values of a spilled file.
+func (s *sorter[T]) run(f *os.File) (Iter, error) {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	dec := s.codec.NewDecoder(bufio.NewReader(f))
+	return MakeIter(Custom[T]{
+		Next: func(context.Context) (T, error) {
+			v, err := dec()
+			if err == io.EOF {
+				return v, EOI
+			}
+			if err != nil {
+				return v, fmt.Errorf("iter.Sort: decoding: %w", err)
+			}
+			return v, nil
+		},
+	}), nil
+}
+
+func (s *sorter[T]) cleanup() error {
+	var err error
+	for _, f := range s.files {
+		err = errors.Join(err, f.Close(), os.Remove(f.Name()))
+	}
+	s.files = nil
+	return err
+}
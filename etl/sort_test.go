@@ -0,0 +1,90 @@
+package etl
+
+import (
+	"context"
+	"math/rand"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+type sortItem struct {
+	Key, Index int
+}
+
+func TestSort(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	items := make([]sortItem, 1000)
+	for i := range items {
+		// few keys so runs have many equal values
+		items[i] = sortItem{Key: rnd.Intn(10), Index: i}
+	}
+	want := append([]sortItem{}, items...)
+	sort.SliceStable(want, func(i, j int) bool { return want[i].Key < want[j].Key })
+	less := func(a, b sortItem) bool { return a.Key < b.Key }
+
+	type test struct {
+		opts      []SortOptFunc
+		wantFiles int
+	}
+	run := func(name string, tt test) {
+		t.Helper()
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			opts := append([]SortOptFunc{WithSortTempDir(dir)}, tt.opts...)
+			it := Sort(Values(items...), less, opts...)
+
+			got := []sortItem{}
+			for {
+				v, err := it.Next(context.Background())
+				if err == EOI {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, v.(sortItem))
+				if len(got) == 1 {
+					if n := countFiles(t, dir); n != tt.wantFiles {
+						t.Errorf("Sort() spilled %d files, want %d", n, tt.wantFiles)
+					}
+				}
+			}
+			if err := it.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Sort() is not sorted and stable")
+			}
+			if n := countFiles(t, dir); n != 0 {
+				t.Errorf("Sort() left %d files after Close, want 0", n)
+			}
+		})
+	}
+	run("in memory", test{wantFiles: 0})
+	run("spill", test{opts: []SortOptFunc{WithSortBudget(7)}, wantFiles: 142})
+	run("spill json", test{
+		opts:      []SortOptFunc{WithSortBudget(100), WithSortCodec(JSONCodec[sortItem]())},
+		wantFiles: 10,
+	})
+}
+
+func TestSortCodecMismatch(t *testing.T) {
+	it := Sort(Values(1, 2), func(a, b int) bool { return a < b },
+		WithSortCodec(JSONCodec[string]()),
+	)
+	defer it.Close()
+	if _, err := it.Next(context.Background()); err == nil {
+		t.Error("Next() error = nil, want codec type mismatch")
+	}
+}
+
+func countFiles(t *testing.T, dir string) int {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(entries)
+}
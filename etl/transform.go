@@ -52,22 +52,28 @@ func Map[Ti, To any](it Iter, fn func(Ti) To) Iter {
 	})
 }
 
-// Map returns an interator that transforms the values of the source
-// iterator using the func fn.
+// MapE returns an interator that transforms the values of the source
+// iterator using the func fn, if fn returns ErrSkip the value is dropped.
 func MapE[Ti, To any](it Iter, fn func(Ti) (To, error)) Iter {
 	return MakeIter(Custom[To]{
 		Next: func(ctx context.Context) (To, error) {
 			var z To
-			vv, err := it.Next(ctx)
-			if err != nil {
-				return z, err
-			}
-			v, ok := vv.(Ti)
-			if !ok {
-				return z, fmt.Errorf("iter.Map: type mismatch: %T", vv)
-			}
+			for {
+				vv, err := it.Next(ctx)
+				if err != nil {
+					return z, err
+				}
+				v, ok := vv.(Ti)
+				if !ok {
+					return z, fmt.Errorf("iter.Map: type mismatch: %T", vv)
+				}
 
-			return fn(v)
+				r, err := fn(v)
+				if errors.Is(err, ErrSkip) {
+					continue
+				}
+				return r, err
+			}
 		},
 		Close: it.Close,
 	})
@@ -0,0 +1,262 @@
+package etl
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// TypedIter is the type safe counterpart of Iter, values are returned as T
+// so no type assertion is needed on each Next.
+type TypedIter[T any] interface {
+	Next(context.Context) (T, error)
+	Close() error
+}
+
+// typedNexter is implemented by iterators that can return values without
+// boxing them into an interface.
+type typedNexter[T any] interface {
+	typedNext(context.Context) (T, error)
+}
+
+func (it *iter[T]) typedNext(ctx context.Context) (T, error) {
+	if it.nextfn == nil {
+		var z T
+		return z, EOI
+	}
+	return it.nextfn(ctx)
+}
+
+// MakeTyped creates a new typed iterator based on the funcs in c.
+func MakeTyped[T any](c Custom[T]) TypedIter[T] {
+	return &typedIter[T]{
+		nextfn:  c.Next,
+		closefn: c.Close,
+	}
+}
+
+type typedIter[T any] struct {
+	nextfn  func(context.Context) (T, error)
+	closefn func() error
+}
+
+func (it *typedIter[T]) Next(ctx context.Context) (T, error) {
+	if it.nextfn == nil {
+		var z T
+		return z, EOI
+	}
+	return it.nextfn(ctx)
+}
+
+func (it *typedIter[T]) Close() error {
+	if it.closefn == nil {
+		return nil
+	}
+	return it.closefn()
+}
+
+// AsTyped returns a typed view of it, values that are not of type T will
+// return an error.
+// If it was created with MakeIter[T] or Untyped[T] values are fetched
+// directly without type assertions.
+func AsTyped[T any](it Iter) TypedIter[T] {
+	switch v := it.(type) {
+	case untypedIter[T]:
+		return v.it
+	case typedNexter[T]:
+		return MakeTyped(Custom[T]{
+			Next:  v.typedNext,
+			Close: it.Close,
+		})
+	}
+	return MakeTyped(Custom[T]{
+		Next: func(ctx context.Context) (T, error) {
+			var z T
+			vv, err := it.Next(ctx)
+			if err != nil {
+				return z, err
+			}
+			v, ok := vv.(T)
+			if !ok {
+				return z, fmt.Errorf("iter.AsTyped: type mismatch: %T", vv)
+			}
+			return v, nil
+		},
+		Close: it.Close,
+	})
+}
+
+// Untyped returns an Iter from a TypedIter so it can be used with the untyped
+// stages.
+func Untyped[T any](it TypedIter[T]) Iter {
+	return untypedIter[T]{it: it}
+}
+
+type untypedIter[T any] struct {
+	it TypedIter[T]
+}
+
+func (u untypedIter[T]) Next(ctx context.Context) (any, error) {
+	return u.it.Next(ctx)
+}
+
+func (u untypedIter[T]) Close() error {
+	return u.it.Close()
+}
+
+func (u untypedIter[T]) typedNext(ctx context.Context) (T, error) {
+	return u.it.Next(ctx)
+}
+
+// TypedValues returns a typed iterator that iterates over the variadic arguments.
+func TypedValues[T any](vs ...T) TypedIter[T] {
+	return MakeTyped(Custom[T]{
+		Next: func(context.Context) (T, error) {
+			var z T
+			if len(vs) == 0 {
+				return z, EOI
+			}
+			v := vs[0]
+			vs = vs[1:]
+			return v, nil
+		},
+	})
+}
+
+// TypedMap returns a typed iterator that transforms the values of the source
+// iterator using the func fn.
+func TypedMap[Ti, To any](it TypedIter[Ti], fn func(Ti) To) TypedIter[To] {
+	return MakeTyped(Custom[To]{
+		Next: func(ctx context.Context) (To, error) {
+			v, err := it.Next(ctx)
+			if err != nil {
+				var z To
+				return z, err
+			}
+			return fn(v), nil
+		},
+		Close: it.Close,
+	})
+}
+
+// TypedMapE returns a typed iterator that transforms the values of the source
+// iterator using the func fn which might return an error.
+func TypedMapE[Ti, To any](it TypedIter[Ti], fn func(Ti) (To, error)) TypedIter[To] {
+	return MakeTyped(Custom[To]{
+		Next: func(ctx context.Context) (To, error) {
+			v, err := it.Next(ctx)
+			if err != nil {
+				var z To
+				return z, err
+			}
+			return fn(v)
+		},
+		Close: it.Close,
+	})
+}
+
+// TypedFilter returns a typed iterator that only passes through the values
+// where fn returns true.
+func TypedFilter[T any](it TypedIter[T], fn FilterFunc[T]) TypedIter[T] {
+	return MakeTyped(Custom[T]{
+		Next: func(ctx context.Context) (T, error) {
+			for {
+				v, err := it.Next(ctx)
+				if err != nil {
+					return v, err
+				}
+				if fn(v) {
+					return v, nil
+				}
+			}
+		},
+		Close: it.Close,
+	})
+}
+
+// TypedPeek calls the func fn each time the Next from the iterator is called.
+func TypedPeek[T any](it TypedIter[T], fn func(v T)) TypedIter[T] {
+	return MakeTyped(Custom[T]{
+		Next: func(ctx context.Context) (T, error) {
+			v, err := it.Next(ctx)
+			if err != nil {
+				return v, err
+			}
+			fn(v)
+			return v, nil
+		},
+		Close: it.Close,
+	})
+}
+
+// TypedChunk converts incoming values into slices of n values.
+func TypedChunk[T any](it TypedIter[T], n int) TypedIter[[]T] {
+	return MakeTyped(Custom[[]T]{
+		Next: func(ctx context.Context) ([]T, error) {
+			var vals []T
+			for i := 0; i < n; i++ {
+				v, err := it.Next(ctx)
+				if err == EOI && len(vals) > 0 {
+					break
+				}
+				if err != nil {
+					return nil, err
+				}
+				vals = append(vals, v)
+			}
+			return vals, nil
+		},
+		Close: it.Close,
+	})
+}
+
+// TypedLimit returns a typed iterator that returns at most n values from it.
+// Closing the returned iterator will close the given iterator.
+func TypedLimit[T any](it TypedIter[T], n int) TypedIter[T] {
+	return MakeTyped(Custom[T]{
+		Next: func(ctx context.Context) (T, error) {
+			if n <= 0 {
+				var z T
+				return z, EOI
+			}
+			n--
+			return it.Next(ctx)
+		},
+		Close: it.Close,
+	})
+}
+
+// TypedConsumeContext iterates over the typed iterator and calls fn for each
+// value.
+func TypedConsumeContext[T any](ctx context.Context, it TypedIter[T], fn func(T) error) error {
+	for {
+		v, err := it.Next(ctx)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if fn == nil {
+			continue
+		}
+		if err := fn(v); err != nil {
+			return err
+		}
+	}
+}
+
+// TypedConsume iterates over the typed iterator and calls fn for each value.
+func TypedConsume[T any](it TypedIter[T], fn func(T) error) error {
+	return TypedConsumeContext(context.Background(), it, fn)
+}
+
+// TypedCollect collects all typed iterator values into a slice.
+func TypedCollect[T any](it TypedIter[T]) ([]T, error) {
+	var xs []T
+	err := TypedConsume(it, func(v T) error {
+		xs = append(xs, v)
+		return nil
+	})
+	return xs, err
+}
@@ -0,0 +1,279 @@
+package etl
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Batch converts incoming values into slices of at most n values, a batch is
+// also yielded when d passed since its first value, whichever comes first.
+// If n <= 0 batches are only flushed by time, if d <= 0 it behaves like Chunk.
+func Batch[T any](it Iter, n int, d time.Duration) Iter {
+	return MakeGen(Gen[[]T]{
+		Run: func(ctx context.Context, yield Y[[]T]) error {
+			vals := readAsync[T](ctx, it)
+
+			var batch []T
+			var timer *time.Timer
+			var timeout <-chan time.Time
+			flush := func() error {
+				if timer != nil {
+					timer.Stop()
+					timer, timeout = nil, nil
+				}
+				if len(batch) == 0 {
+					return nil
+				}
+				b := batch
+				batch = nil
+				return yield(b)
+			}
+			for {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-timeout:
+					timer, timeout = nil, nil
+					if err := flush(); err != nil {
+						return err
+					}
+				case m, ok := <-vals:
+					if !ok {
+						return flush()
+					}
+					if m.err != nil {
+						return m.err
+					}
+					batch = append(batch, m.value)
+					if len(batch) == 1 && d > 0 {
+						timer = time.NewTimer(d)
+						timeout = timer.C
+					}
+					if n > 0 && len(batch) >= n {
+						if err := flush(); err != nil {
+							return err
+						}
+					}
+				}
+			}
+		},
+		Close: it.Close,
+	})
+}
+
+// WindowData is the value yielded by the window stages, it contains the
+// values whose time is in [Start, End).
+type WindowData[T any] struct {
+	Start  time.Time
+	End    time.Time
+	Values []T
+}
+
+func (w WindowData[T]) String() string {
+	return fmt.Sprintf("[%s, %s) %d values",
+		w.Start.Format(time.RFC3339Nano),
+		w.End.Format(time.RFC3339Nano),
+		len(w.Values),
+	)
+}
+
+type windowOptions struct {
+	eventTime func(any) (time.Time, error)
+	lateness  time.Duration
+}
+
+type WindowOptFunc func(*windowOptions)
+
+// WithEventTime uses the time returned by fn to place values in windows
+// instead of the wall-clock time the value arrives.
+// Windows are flushed when a value past its end is seen, values older than
+// the flushed windows are dropped.
+func WithEventTime[T any](fn func(T) time.Time) WindowOptFunc {
+	return func(o *windowOptions) {
+		o.eventTime = func(vv any) (time.Time, error) {
+			v, ok := vv.(T)
+			if !ok {
+				return time.Time{}, fmt.Errorf("iter.Window: type mismatch: %T", vv)
+			}
+			return fn(v), nil
+		}
+	}
+}
+
+// WithAllowedLateness delays flushing event time windows by d so values
+// arriving out of order up to d are still placed in their windows.
+func WithAllowedLateness(d time.Duration) WindowOptFunc {
+	return func(o *windowOptions) {
+		o.lateness = d
+	}
+}
+
+func makeWindowOptions(opts ...WindowOptFunc) windowOptions {
+	o := windowOptions{}
+	for _, fn := range opts {
+		fn(&o)
+	}
+	return o
+}
+
+// TumblingWindow groups values into fixed, non overlapping windows of size.
+func TumblingWindow[T any](it Iter, size time.Duration, opts ...WindowOptFunc) Iter {
+	return Window[T](it, size, size, opts...)
+}
+
+// SlidingWindow groups values into windows of size that start every slide,
+// a value can belong to several windows.
+func SlidingWindow[T any](it Iter, size, slide time.Duration, opts ...WindowOptFunc) Iter {
+	return Window[T](it, size, slide, opts...)
+}
+
+// Window groups values into windows of size starting every slide, windows
+// are aligned to the zero time and yielded as WindowData[T] in start order.
+// Windows without values are not yielded.
+//
+// By default values are placed by the wall-clock time they arrive and
+// windows are flushed when their end time passes, WithEventTime can be used
+// to place values by a time extracted from the value.
+// Remaining windows are flushed when the iterator ends.
+func Window[T any](it Iter, size, slide time.Duration, opts ...WindowOptFunc) Iter {
+	o := makeWindowOptions(opts...)
+	if slide <= 0 {
+		slide = size
+	}
+	return MakeGen(Gen[WindowData[T]]{
+		Run: func(ctx context.Context, yield Y[WindowData[T]]) error {
+			if size <= 0 {
+				return fmt.Errorf("iter.Window: invalid size: %v", size)
+			}
+			vals := readAsync[T](ctx, it)
+			open := map[int64]*WindowData[T]{}
+			var watermark time.Time
+
+			// flush yields the windows that end before or at wm.
+			flush := func(wm time.Time, all bool) error {
+				var ws []*WindowData[T]
+				for k, w := range open {
+					if all || !w.End.After(wm) {
+						ws = append(ws, w)
+						delete(open, k)
+					}
+				}
+				sort.Slice(ws, func(i, j int) bool {
+					return ws[i].Start.Before(ws[j].Start)
+				})
+				for _, w := range ws {
+					if err := yield(*w); err != nil {
+						return err
+					}
+				}
+				return nil
+			}
+			add := func(t time.Time, v T) {
+				for s := t.Truncate(slide); s.After(t.Add(-size)); s = s.Add(-slide) {
+					end := s.Add(size)
+					// window was already flushed
+					if !watermark.IsZero() && !end.After(watermark) {
+						continue
+					}
+					w, ok := open[s.UnixNano()]
+					if !ok {
+						w = &WindowData[T]{Start: s, End: end}
+						open[s.UnixNano()] = w
+					}
+					w.Values = append(w.Values, v)
+				}
+			}
+
+			for {
+				var timer *time.Timer
+				var timeout <-chan time.Time
+				if o.eventTime == nil && len(open) > 0 {
+					next := time.Time{}
+					for _, w := range open {
+						if next.IsZero() || w.End.Before(next) {
+							next = w.End
+						}
+					}
+					timer = time.NewTimer(time.Until(next))
+					timeout = timer.C
+				}
+				var err error
+				select {
+				case <-ctx.Done():
+					err = ctx.Err()
+				case <-timeout:
+					watermark = time.Now()
+					err = flush(watermark, false)
+				case m, ok := <-vals:
+					switch {
+					case !ok:
+						err = flush(watermark, true)
+						if err == nil {
+							err = EOI
+						}
+					case m.err != nil:
+						err = m.err
+					case o.eventTime == nil:
+						add(time.Now(), m.value)
+					default:
+						var t time.Time
+						t, err = o.eventTime(m.value)
+						if err != nil {
+							break
+						}
+						add(t, m.value)
+						if wm := t.Add(-o.lateness); wm.After(watermark) {
+							watermark = wm
+							err = flush(watermark, false)
+						}
+					}
+				}
+				if timer != nil {
+					timer.Stop()
+				}
+				if err == EOI {
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+			}
+		},
+		Close: it.Close,
+	})
+}
+
+// readAsync reads it in a goroutine so values can be selected along with
+// timers, the channel is closed when it ends or on the first error.
+func readAsync[T any](ctx context.Context, it Iter) <-chan msg[T] {
+	ch := make(chan msg[T])
+	go func() {
+		defer close(ch)
+		for {
+			var m msg[T]
+			vv, err := it.Next(ctx)
+			if err == EOI {
+				return
+			}
+			if err == nil {
+				v, ok := vv.(T)
+				if !ok {
+					err = fmt.Errorf("iter: type mismatch: %T", vv)
+				}
+				m.value = v
+			}
+			m.err = err
+			select {
+			case ch <- m:
+			case <-ctx.Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return ch
+}
@@ -2,10 +2,55 @@ package etl
 
 import (
 	"context"
+	"errors"
+	"fmt"
 
 	"golang.org/x/sync/errgroup"
 )
 
+type workersOptions struct {
+	retry   []RetryOptFunc
+	limiter *Limiter
+}
+
+type WorkersOptFunc func(*workersOptions)
+
+// WithWorkersRetry retries the func of WorkersMap, WorkersMapOrdered and
+// WorkersConsume with backoff when it fails for a value. Workers and
+// WorkersValue fail with this option as they can't retry a single value.
+func WithWorkersRetry(opts ...RetryOptFunc) WorkersOptFunc {
+	return func(o *workersOptions) {
+		o.retry = append(o.retry, opts...)
+		if o.retry == nil {
+			o.retry = []RetryOptFunc{}
+		}
+	}
+}
+
+// WithWorkersLimiter makes workers wait on the limiter l before processing
+// each value, the same limiter can be shared by several pools.
+func WithWorkersLimiter(l *Limiter) WorkersOptFunc {
+	return func(o *workersOptions) {
+		o.limiter = l
+	}
+}
+
+func makeWorkersOptions(opts ...WorkersOptFunc) workersOptions {
+	o := workersOptions{}
+	for _, fn := range opts {
+		fn(&o)
+	}
+	return o
+}
+
+// workersMapFunc applies the options to a worker map func.
+func workersMapFunc[Ti, To any](o workersOptions, fn func(context.Context, Ti) (To, error)) func(context.Context, Ti) (To, error) {
+	if o.retry != nil {
+		fn = RetryFunc(fn, o.retry...)
+	}
+	return fn
+}
+
 type W[To any] struct {
 	Iter
 	ID    int
@@ -16,16 +61,32 @@ func (w W[To]) Yield(v To) error {
 	return w.yield(v)
 }
 
+// errWorkersRetry is returned by pools that don't support WithWorkersRetry.
+var errWorkersRetry = errors.New("WithWorkersRetry is not supported, use WorkersMap or RetryFunc")
+
 // Workers iterates over a slice of values and calls a worker func for each value.
-func Workers[To any](it Iter, workers int, fn func(context.Context, W[To]) error) Iter {
+func Workers[To any](it Iter, workers int, fn func(context.Context, W[To]) error, opts ...WorkersOptFunc) Iter {
+	o := makeWorkersOptions(opts...)
+	if o.retry != nil {
+		it.Close() // nolint: errcheck
+		return ErrIter(fmt.Errorf("etl.Workers: %w", errWorkersRetry))
+	}
+	return workersIter(it, workers, fn, o)
+}
+
+func workersIter[To any](it Iter, workers int, fn func(context.Context, W[To]) error, o workersOptions) Iter {
 	return MakeGen(Gen[To]{
 		Run: func(ctx context.Context, yield Y[To]) error {
 			itval := make(chan any)
 
 			eg, ctx := errgroup.WithContext(ctx)
 			for i := 0; i < workers; i++ {
+				var wit Iter = Chan(itval)
+				if o.limiter != nil {
+					wit = RateLimitWith(wit, o.limiter)
+				}
 				w := W[To]{
-					Iter:  Chan(itval),
+					Iter:  wit,
 					ID:    i,
 					yield: yield,
 				}
@@ -52,36 +113,146 @@ func Workers[To any](it Iter, workers int, fn func(context.Context, W[To]) error
 }
 
 // WorkersMap is a convinitent func that calls fn for every consumed value, it will yield the result
-func WorkersMap[Ti, To any](it Iter, workers int, fn func(context.Context, Ti) (To, error)) Iter {
-	return Workers(it, workers, func(ctx context.Context, w W[To]) error {
+// if fn returns ErrSkip the value is dropped.
+func WorkersMap[Ti, To any](it Iter, workers int, fn func(context.Context, Ti) (To, error), opts ...WorkersOptFunc) Iter {
+	o := makeWorkersOptions(opts...)
+	fn = workersMapFunc(o, fn)
+	return workersIter(it, workers, func(ctx context.Context, w W[To]) error {
 		return ConsumeContext(ctx, w, func(v Ti) error {
 			r, err := fn(ctx, v)
+			if errors.Is(err, ErrSkip) {
+				return nil
+			}
 			if err != nil {
 				return err
 			}
 			return w.Yield(r)
 		})
+	}, o)
+}
+
+// WorkersMapOrdered is like WorkersMap but results are yielded in the same
+// order as the values consumed from it.
+// window is the maximum number of values in flight (being processed or
+// waiting to be yielded), it caps memory when a slow value holds back the
+// ones behind it, if lower than workers it will be set to workers, workers
+// is at least 1.
+// If fn returns ErrSkip the value is dropped.
+func WorkersMapOrdered[Ti, To any](it Iter, workers, window int, fn func(context.Context, Ti) (To, error), opts ...WorkersOptFunc) Iter {
+	o := makeWorkersOptions(opts...)
+	fn = workersMapFunc(o, fn)
+	if workers < 1 {
+		workers = 1
+	}
+	if window < workers {
+		window = workers
+	}
+	type job struct {
+		value Ti
+		res   chan msg[To]
+	}
+	return MakeGen(Gen[To]{
+		Run: func(ctx context.Context, yield Y[To]) error {
+			jobs := make(chan job)
+			// pending keeps the result channels in the input order, the
+			// one being awaited by the yielding loop is also in flight.
+			pending := make(chan chan msg[To], window-1)
+
+			eg, ctx := errgroup.WithContext(ctx)
+			for i := 0; i < workers; i++ {
+				eg.Go(func() error {
+					for j := range jobs {
+						if err := o.limiter.Wait(ctx); err != nil {
+							j.res <- msg[To]{err: err}
+							return err
+						}
+						v, err := fn(ctx, j.value)
+						j.res <- msg[To]{value: v, err: err}
+						if err != nil && !errors.Is(err, ErrSkip) {
+							return err
+						}
+					}
+					return nil
+				})
+			}
+			eg.Go(func() error {
+				defer close(jobs)
+				defer close(pending)
+				return ConsumeContext(ctx, it, func(v Ti) error {
+					res := make(chan msg[To], 1)
+					select {
+					case pending <- res:
+					case <-ctx.Done():
+						return ctx.Err()
+					}
+					select {
+					case jobs <- job{value: v, res: res}:
+					case <-ctx.Done():
+						return ctx.Err()
+					}
+					return nil
+				})
+			})
+			eg.Go(func() error {
+				for res := range pending {
+					select {
+					case m := <-res:
+						if errors.Is(m.err, ErrSkip) {
+							continue
+						}
+						if m.err != nil {
+							return m.err
+						}
+						if err := yield(m.value); err != nil {
+							return err
+						}
+					case <-ctx.Done():
+						return ctx.Err()
+					}
+				}
+				return nil
+			})
+			return eg.Wait()
+		},
+		Close: it.Close,
 	})
 }
 
 // WorkersValue is a convinitent func that calls fn for every consumed value, it will yield any value
-// by calling the yield func.
-func WorkersValue[Ti, To any](it Iter, workers int, fn func(context.Context, Ti, Y[To]) error) Iter {
-	return Workers(it, workers, func(ctx context.Context, w W[To]) error {
+// by calling the yield func, if fn returns ErrSkip the value is dropped.
+func WorkersValue[Ti, To any](it Iter, workers int, fn func(context.Context, Ti, Y[To]) error, opts ...WorkersOptFunc) Iter {
+	o := makeWorkersOptions(opts...)
+	if o.retry != nil {
+		it.Close() // nolint: errcheck
+		return ErrIter(fmt.Errorf("etl.WorkersValue: %w", errWorkersRetry))
+	}
+	return workersIter(it, workers, func(ctx context.Context, w W[To]) error {
 		return ConsumeContext(ctx, w, func(v Ti) error {
-			return fn(ctx, v, w.Yield)
+			if err := fn(ctx, v, w.Yield); !errors.Is(err, ErrSkip) {
+				return err
+			}
+			return nil
 		})
-	})
+	}, o)
 }
 
 // WorkersConsume creates a pool of workers that call fn for every iteration value.
 // this will close the consumed Iter upon finish.
-func WorkersConsume[Ti any](it Iter, workers int, fn func(context.Context, Ti) error) error {
-	return WorkersConsumeContext(context.Background(), it, workers, fn)
+func WorkersConsume[Ti any](it Iter, workers int, fn func(context.Context, Ti) error, opts ...WorkersOptFunc) error {
+	return WorkersConsumeContext(context.Background(), it, workers, fn, opts...)
 }
 
-func WorkersConsumeContext[Ti any](ctx context.Context, it Iter, workers int, fn func(context.Context, Ti) error) error {
+func WorkersConsumeContext[Ti any](ctx context.Context, it Iter, workers int, fn func(context.Context, Ti) error, opts ...WorkersOptFunc) error {
 	defer it.Close()
+	o := makeWorkersOptions(opts...)
+	if o.retry != nil {
+		fnOnce := fn
+		fn = func(ctx context.Context, v Ti) error {
+			return RetryDo(ctx, func(ctx context.Context) error {
+				return fnOnce(ctx, v)
+			}, o.retry...)
+		}
+	}
 
 	eg, ctx := errgroup.WithContext(ctx)
 	itval := make(chan Ti)
@@ -93,7 +264,10 @@ func WorkersConsumeContext[Ti any](ctx context.Context, it Iter, workers int, fn
 					if !ok {
 						return nil
 					}
-					if err := fn(ctx, v); err != nil {
+					if err := o.limiter.Wait(ctx); err != nil {
+						return err
+					}
+					if err := fn(ctx, v); err != nil && !errors.Is(err, ErrSkip) {
 						return err
 					}
 				case <-ctx.Done():
@@ -0,0 +1,77 @@
+package etl
+
+import (
+	"context"
+	"math/rand"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWorkersMapOrdered(t *testing.T) {
+	type test struct {
+		workers, window int
+		wantWindow      int
+	}
+	run := func(name string, tt test) {
+		t.Helper()
+		t.Run(name, func(t *testing.T) {
+			const n = 200
+			var started int32
+			delays := make([]time.Duration, n)
+			rnd := rand.New(rand.NewSource(1))
+			for i := range delays {
+				delays[i] = time.Duration(rnd.Intn(1000)) * time.Microsecond
+			}
+			it := WorkersMapOrdered(Seq(0, n, 1), tt.workers, tt.window, func(_ context.Context, v int) (int, error) {
+				atomic.AddInt32(&started, 1)
+				time.Sleep(delays[v])
+				return v * 2, nil
+			})
+			defer it.Close()
+
+			ctx := context.Background()
+			// nothing is consumed so the window fills up and stops there.
+			if _, err := it.Next(ctx); err != nil {
+				t.Fatal(err)
+			}
+			deadline := time.Now().Add(5 * time.Second)
+			for atomic.LoadInt32(&started) < int32(tt.wantWindow+1) && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+			time.Sleep(20 * time.Millisecond)
+			// the value received is no longer in flight.
+			if got := int(atomic.LoadInt32(&started)) - 1; got != tt.wantWindow {
+				t.Fatalf("%d values in flight with a stalled consumer, want %d", got, tt.wantWindow)
+			}
+
+			received, maxInFlight := 1, 0
+			for want := 1; ; want++ {
+				v, err := it.Next(ctx)
+				if err == EOI {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				received++
+				if v != want*2 {
+					t.Fatalf("value %d = %v, want %v", want, v, want*2)
+				}
+				if inFlight := int(atomic.LoadInt32(&started)) - received; inFlight > maxInFlight {
+					maxInFlight = inFlight
+				}
+				time.Sleep(delays[want] / 2)
+			}
+			if received != n {
+				t.Errorf("received %d values, want %d", received, n)
+			}
+			if maxInFlight > tt.wantWindow {
+				t.Errorf("max %d values in flight, want at most %d", maxInFlight, tt.wantWindow)
+			}
+		})
+	}
+	run("window", test{workers: 4, window: 6, wantWindow: 6})
+	run("window lower than workers", test{workers: 3, window: 1, wantWindow: 3})
+	run("single worker", test{workers: 1, window: 1, wantWindow: 1})
+}
@@ -3,6 +3,8 @@ package etlcloud
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/url"
@@ -11,10 +13,13 @@ import (
 	"github.com/stdiopt/danda/etl"
 	"github.com/stdiopt/danda/etl/etlio"
 	"gocloud.dev/blob"
+	"gocloud.dev/gcerrors"
 )
 
 type listOptions struct {
-	Delimiter string
+	Delimiter  string
+	StartAfter string
+	Resume     string
 }
 
 type ListOptFunc func(*listOptions)
@@ -25,6 +30,27 @@ func WithDelimiter(d string) ListOptFunc {
 	}
 }
 
+// WithStartAfter skips the objects with keys up to key, key is usually the
+// position previously reported by the BlobListObjects iterator.
+//
+// The blob API has no start after for every provider, so without a delimiter
+// the key parent "directories" are listed with a "/" delimiter to skip the
+// ones before the key, only the objects in the key own directory are listed
+// and skipped.
+func WithStartAfter(key string) ListOptFunc {
+	return func(o *listOptions) {
+		o.StartAfter = key
+	}
+}
+
+// WithResume resumes a BlobListRead iterator at the position it previously
+// reported, see etl.Positioner.
+func WithResume(pos string) ListOptFunc {
+	return func(o *listOptions) {
+		o.Resume = pos
+	}
+}
+
 func makeListOptions(opts ...ListOptFunc) listOptions {
 	o := listOptions{}
 	for _, fn := range opts {
@@ -33,9 +59,141 @@ func makeListOptions(opts ...ListOptFunc) listOptions {
 	return o
 }
 
+// BlobListObjects returns an iterator of *blob.ListObject in the bucket url
+// path, objects are listed in lexicographical key order.
+//
+// The returned iterator implements etl.Positioner with the key of the last
+// object, which can be passed to WithStartAfter. The key is reported as soon
+// as the object is listed, use BlobListRead to resume within the contents of
+// the objects.
 func BlobListObjects(bucketURL string, opts ...ListOptFunc) etl.Iter {
 	o := makeListOptions(opts...)
+	l, err := openLister(bucketURL, o.Delimiter, o.StartAfter, false)
+	if err != nil {
+		return etl.ErrIter(err)
+	}
+	it := etl.MakeIter(etl.Custom[*blob.ListObject]{
+		Next:  l.Next,
+		Close: l.Close,
+	})
+	return etl.PositionBy(it, o.StartAfter, func(obj *blob.ListObject) string {
+		return obj.Key
+	})
+}
+
+// readPosition is the position of a BlobListRead iterator, Rows is the
+// number of values read from the object with Key or 0 if it was read to the
+// end.
+type readPosition struct {
+	Key  string `json:"key"`
+	Rows int    `json:"rows,omitempty"`
+}
+
+// BlobListRead returns an iterator of the values of the iterators returned
+// by fn for each object in the bucket url path, objects are read one at a
+// time in lexicographical key order and directories are skipped.
+//
+// The returned iterator implements etl.Positioner with the key of the object
+// being read and the number of values read from it, which can be passed to
+// WithResume, a resumed object is read again from the start skipping the
+// values already read.
+func BlobListRead(bucketURL string, fn func(*blob.ListObject) etl.Iter, opts ...ListOptFunc) etl.Iter {
+	o := makeListOptions(opts...)
+	pos := readPosition{Key: o.StartAfter}
+	if o.Resume != "" {
+		if err := json.Unmarshal([]byte(o.Resume), &pos); err != nil {
+			return etl.ErrIter(fmt.Errorf("etlcloud.BlobListRead: invalid resume position: %w", err))
+		}
+	}
+	// an object that wasn't read to the end is listed again
+	l, err := openLister(bucketURL, o.Delimiter, pos.Key, pos.Rows > 0)
+	if err != nil {
+		return etl.ErrIter(err)
+	}
+
+	var cur etl.Iter
+	var key string
+	rows, skip := 0, pos.Rows
+	it := etl.MakeIter(etl.Custom[any]{
+		Next: func(ctx context.Context) (any, error) {
+			for {
+				if cur == nil {
+					obj, err := l.Next(ctx)
+					if err != nil {
+						return nil, err
+					}
+					if obj.IsDir {
+						continue
+					}
+					if obj.Key != pos.Key {
+						// the resumed object is gone
+						skip = 0
+					}
+					cur, key, rows = fn(obj), obj.Key, 0
+				}
+				v, err := cur.Next(ctx)
+				if err == etl.EOI {
+					err = cur.Close()
+					cur = nil
+					if err != nil {
+						return nil, err
+					}
+					pos = readPosition{Key: key}
+					continue
+				}
+				if err != nil {
+					return nil, err
+				}
+				rows++
+				if rows <= skip {
+					continue
+				}
+				pos = readPosition{Key: key, Rows: rows}
+				return v, nil
+			}
+		},
+		Close: func() error {
+			var err error
+			if cur != nil {
+				err = cur.Close()
+			}
+			return errors.Join(err, l.Close())
+		},
+	})
+	return etl.WithPosition(it, func() string {
+		if pos.Key == "" {
+			return ""
+		}
+		data, _ := json.Marshal(pos) // nolint: errcheck
+		return string(data)
+	})
+}
+
+// listFrame is a listing that skips the keys up to after, the directories
+// listed by a walk frame are listed in full as they are reached.
+type listFrame struct {
+	it    *blob.ListIterator
+	after string
+	incl  bool
+	walk  bool
+}
 
+// lister lists the objects in a bucket prefix after a key, the listings of
+// the directories being walked are kept in a stack.
+type lister struct {
+	b      *blob.Bucket
+	cancel func()
+	frames []listFrame
+}
+
+// openLister opens the bucket url and lists the objects after the key after,
+// or starting at it if incl is set.
+//
+// Without a delimiter each parent directory of after is listed with a "/"
+// delimiter, the directories before after are skipped without listing their
+// objects and the ones after it are listed as they are reached, which keeps
+// the lexicographical key order.
+func openLister(bucketURL, delimiter, after string, incl bool) (*lister, error) {
 	ctx, cancel := context.WithCancel(context.Background())
 	var prefix string
 	b, err := func() (*blob.Bucket, error) {
@@ -55,42 +213,151 @@ func BlobListObjects(bucketURL string, opts ...ListOptFunc) etl.Iter {
 	}()
 	if err != nil {
 		cancel()
-		return etl.ErrIter(err)
+		return nil, err
 	}
+	l := &lister{b: b, cancel: cancel}
+	if delimiter != "" || !strings.HasPrefix(after, prefix) {
+		l.push(listFrame{
+			it:    l.list(prefix, delimiter),
+			after: after,
+			incl:  incl,
+		})
+		return l, nil
+	}
+	dir := prefix
+	for {
+		i := strings.Index(after[len(dir):], "/")
+		if i == -1 {
+			break
+		}
+		sub := after[:len(dir)+i+1]
+		// sub itself is skipped as its objects are listed by the next frame
+		l.push(listFrame{it: l.list(dir, "/"), after: sub, walk: true})
+		dir = sub
+	}
+	l.push(listFrame{it: l.list(dir, ""), after: after, incl: incl})
+	return l, nil
+}
 
-	bIt := b.List(&blob.ListOptions{Prefix: prefix, Delimiter: o.Delimiter})
-	return etl.MakeIter(etl.Custom[*blob.ListObject]{
-		Next: bIt.Next,
-		Close: func() error {
-			cancel()
-			return b.Close()
-		},
-	})
+func (l *lister) list(prefix, delimiter string) *blob.ListIterator {
+	return l.b.List(&blob.ListOptions{Prefix: prefix, Delimiter: delimiter})
 }
 
-func BlobGetObject(objURL string) etl.Iter {
-	ctx, cancel := context.WithCancel(context.Background())
+func (l *lister) push(f listFrame) {
+	l.frames = append(l.frames, f)
+}
 
-	rd, err := func() (io.ReadCloser, error) {
-		u, err := url.Parse(objURL)
+func (l *lister) Next(ctx context.Context) (*blob.ListObject, error) {
+	for len(l.frames) > 0 {
+		f := l.frames[len(l.frames)-1]
+		obj, err := f.it.Next(ctx)
+		if err == io.EOF {
+			l.frames = l.frames[:len(l.frames)-1]
+			continue
+		}
 		if err != nil {
 			return nil, err
 		}
+		if obj.Key < f.after || (obj.Key == f.after && !f.incl) {
+			continue
+		}
+		if obj.IsDir && f.walk {
+			l.push(listFrame{it: l.list(obj.Key, "")})
+			continue
+		}
+		return obj, nil
+	}
+	return nil, io.EOF
+}
+
+func (l *lister) Close() error {
+	l.cancel()
+	return l.b.Close()
+}
+
+type getOptions struct {
+	retry []etl.RetryOptFunc
+}
+
+type GetOptFunc func(*getOptions)
+
+// WithGetRetry retries opening and reading the object with backoff, a
+// failed read is resumed at the offset it failed. Errors are classified
+// with Retryable unless etl.WithRetryIf is passed.
+func WithGetRetry(opts ...etl.RetryOptFunc) GetOptFunc {
+	return func(o *getOptions) {
+		o.retry = append([]etl.RetryOptFunc{etl.WithRetryIf(Retryable)}, opts...)
+	}
+}
+
+func makeGetOptions(opts ...GetOptFunc) getOptions {
+	o := getOptions{}
+	for _, fn := range opts {
+		fn(&o)
+	}
+	return o
+}
+
+// Retryable reports if err is worth retrying, as network errors and the
+// resource exhausted, deadline exceeded and internal error codes.
+func Retryable(err error) bool {
+	switch gcerrors.Code(err) {
+	case gcerrors.ResourceExhausted, gcerrors.DeadlineExceeded, gcerrors.Internal:
+		return true
+	}
+	return etl.Retryable(err)
+}
+
+// BlobGetObject returns an iterator of the object contents in chunks of
+// []byte.
+func BlobGetObject(objURL string, opts ...GetOptFunc) etl.Iter {
+	o := makeGetOptions(opts...)
+	bctx, cancel := context.WithCancel(context.Background())
+
+	var b *blob.Bucket
+	var key string
+	var rd io.ReadCloser
+	var offset int64
+	// open opens the reader at the current offset
+	open := func(context.Context) error {
+		r, err := b.NewRangeReader(bctx, key, offset, -1, nil)
+		if err != nil {
+			return err
+		}
+		rd = r
+		return nil
+	}
+	// retry calls fn with retries when enabled
+	retry := func(ctx context.Context, fn func(context.Context) error) error {
+		if o.retry == nil {
+			return fn(ctx)
+		}
+		return etl.RetryDo(ctx, fn, o.retry...)
+	}
+
+	err := func() error {
+		u, err := url.Parse(objURL)
+		if err != nil {
+			return err
+		}
 		// in the form of '{scheme}://{host}/{prefix}'
 		burl := fmt.Sprintf("%s://%s", u.Scheme, u.Host)
 		if u.RawQuery != "" {
 			burl += "?" + u.RawQuery
 		}
-		b, err := blob.OpenBucket(ctx, burl)
+		b, err = blob.OpenBucket(bctx, burl)
 		if err != nil {
-			return nil, err
+			return err
 		}
 
-		key := strings.Trim(u.Path, "/")
-		return b.NewReader(ctx, key, nil)
+		key = strings.Trim(u.Path, "/")
+		return retry(bctx, open)
 	}()
 	if err != nil {
 		cancel()
+		if b != nil {
+			b.Close() // nolint: errcheck
+		}
 		return etl.ErrIter(err)
 	}
 
@@ -108,19 +375,45 @@ func BlobGetObject(objURL string) etl.Iter {
 			}
 			// Make buf size configurable
 			buf := make([]byte, 1024)
-			n, err := rd.Read(buf)
-			switch {
-			case err == io.EOF:
-				eof = true
-				if n == 0 {
-					return nil, etl.EOI
+			var n int
+			err := retry(ctx, func(ctx context.Context) error {
+				if rd == nil {
+					if err := open(ctx); err != nil {
+						return err
+					}
+				}
+				var err error
+				n, err = rd.Read(buf)
+				offset += int64(n)
+				switch {
+				case err == io.EOF:
+					eof = true
+				case err != nil:
+					rd.Close() // nolint: errcheck
+					rd = nil
+					if n == 0 {
+						return err
+					}
+					// the data read is returned and the next read reopens
 				}
-			case err != nil:
+				return nil
+			})
+			if err != nil {
 				return nil, err
 			}
+			if eof && n == 0 {
+				return nil, etl.EOI
+			}
 			return buf[:n], nil
 		},
-		Close: rd.Close,
+		Close: func() error {
+			cancel()
+			var err error
+			if rd != nil {
+				err = rd.Close()
+			}
+			return errors.Join(err, b.Close())
+		},
 	})
 }
 
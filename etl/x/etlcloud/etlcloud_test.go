@@ -0,0 +1,295 @@
+package etlcloud
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stdiopt/danda/drow"
+	"github.com/stdiopt/danda/etl"
+	"github.com/stdiopt/danda/etl/etlcsv"
+	"gocloud.dev/blob"
+	"gocloud.dev/blob/driver"
+	"gocloud.dev/gcerrors"
+)
+
+func TestBlobGetObjectRetry(t *testing.T) {
+	data := strings.Repeat("0123456789", 500)
+	fb := &flakyBucket{data: data, failEvery: 700}
+	blob.DefaultURLMux().RegisterBucket("flaky", fb)
+
+	type test struct {
+		opts    []GetOptFunc
+		wantErr bool
+	}
+	run := func(name string, tt test) {
+		t.Helper()
+		t.Run(name, func(t *testing.T) {
+			fb.read = 0
+			it := BlobGetObject("flaky://bucket/obj", tt.opts...)
+			defer it.Close()
+			buf := &bytes.Buffer{}
+			err := etl.Consume(it, func(b []byte) error {
+				buf.Write(b)
+				return nil
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("BlobGetObject() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && buf.String() != data {
+				t.Errorf("BlobGetObject() read %d bytes, want %d", buf.Len(), len(data))
+			}
+		})
+	}
+	run("without retry", test{wantErr: true})
+	run("with retry", test{
+		opts: []GetOptFunc{WithGetRetry(etl.WithBackoff(time.Millisecond, time.Millisecond))},
+	})
+}
+
+func TestBlobListObjectsStartAfter(t *testing.T) {
+	mb := &mapBucket{objs: map[string]string{}}
+	for _, k := range []string{
+		"a.csv", "a/1", "a/2/x", "a/2/y", "a/3", "a0", "b/1", "b/2", "c",
+	} {
+		mb.objs[k] = k
+	}
+	blob.DefaultURLMux().RegisterBucket("maplist", mb)
+
+	type test struct {
+		url        string
+		opts       []ListOptFunc
+		want       []string
+		wantListed int
+	}
+	run := func(name string, tt test) {
+		t.Helper()
+		t.Run(name, func(t *testing.T) {
+			mb.listed = 0
+			it := BlobListObjects(tt.url, tt.opts...)
+			defer it.Close()
+			got := []string{}
+			err := etl.Consume(it, func(obj *blob.ListObject) error {
+				got = append(got, obj.Key)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("BlobListObjects()\nwant: %v\n got: %v", tt.want, got)
+			}
+			if mb.listed != tt.wantListed {
+				t.Errorf("BlobListObjects() listed %d entries, want %d", mb.listed, tt.wantListed)
+			}
+		})
+	}
+	run("all", test{
+		url:        "maplist://bucket",
+		want:       []string{"a.csv", "a/1", "a/2/x", "a/2/y", "a/3", "a0", "b/1", "b/2", "c"},
+		wantListed: 9,
+	})
+	run("start after nested key", test{
+		url:  "maplist://bucket",
+		opts: []ListOptFunc{WithStartAfter("a/2/x")},
+		want: []string{"a/2/y", "a/3", "a0", "b/1", "b/2", "c"},
+		// root: a.csv a/ a0 b/ c, a/: 1 2/ 3, a/2/: x y, b/: 1 2
+		wantListed: 5 + 3 + 2 + 2,
+	})
+	run("start after directory key", test{
+		url:        "maplist://bucket",
+		opts:       []ListOptFunc{WithStartAfter("a/3")},
+		want:       []string{"a0", "b/1", "b/2", "c"},
+		wantListed: 5 + 4 + 2,
+	})
+	run("start after with prefix", test{
+		url:        "maplist://bucket/a",
+		opts:       []ListOptFunc{WithStartAfter("a/1")},
+		want:       []string{"a/2/x", "a/2/y", "a/3"},
+		wantListed: 4,
+	})
+	run("start after outside prefix", test{
+		url:        "maplist://bucket/b",
+		opts:       []ListOptFunc{WithStartAfter("a/1")},
+		want:       []string{"b/1", "b/2"},
+		wantListed: 2,
+	})
+	run("start after with delimiter", test{
+		url:        "maplist://bucket",
+		opts:       []ListOptFunc{WithDelimiter("/"), WithStartAfter("a/")},
+		want:       []string{"a0", "b/", "c"},
+		wantListed: 5,
+	})
+}
+
+func TestBlobListReadResume(t *testing.T) {
+	mb := &mapBucket{objs: map[string]string{
+		"in/1.csv": "id\n1\n2\n3\n",
+		"in/2.csv": "id\n4\n5\n",
+		"in/3.csv": "id\n6\n7\n8\n",
+	}}
+	blob.DefaultURLMux().RegisterBucket("mapread", mb)
+	read := func(obj *blob.ListObject) etl.Iter {
+		return etlcsv.Decode(BlobGetObject("mapread://bucket/" + obj.Key))
+	}
+	ids := func(it etl.Iter, n int) ([]string, string) {
+		t.Helper()
+		defer it.Close()
+		got := []string{}
+		for n < 0 || len(got) < n {
+			v, err := it.Next(context.Background())
+			if err == etl.EOI {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, fmt.Sprint(v.(drow.Row).Value("id")))
+		}
+		pos, _ := etl.PositionOf(it)
+		return got, pos
+	}
+
+	type test struct {
+		stops []int
+	}
+	run := func(name string, tt test) {
+		t.Helper()
+		t.Run(name, func(t *testing.T) {
+			got := []string{}
+			pos := ""
+			// every stop simulates a crash after committing the values read
+			for _, n := range append(tt.stops, -1) {
+				vals, p := ids(BlobListRead("mapread://bucket/in", read, WithResume(pos)), n)
+				got = append(got, vals...)
+				pos = p
+			}
+			want := []string{"1", "2", "3", "4", "5", "6", "7", "8"}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("BlobListRead() resumed\nwant: %v\n got: %v", want, got)
+			}
+		})
+	}
+	run("no crash", test{})
+	run("crash within an object", test{stops: []int{2}})
+	run("crash at the end of an object", test{stops: []int{3}})
+	run("several crashes", test{stops: []int{1, 1, 3, 1, 1}})
+	run("crash before reading", test{stops: []int{0, 4}})
+
+	t.Run("position", func(t *testing.T) {
+		_, pos := ids(BlobListRead("mapread://bucket/in", read), 4)
+		if want := `{"key":"in/2.csv","rows":1}`; pos != want {
+			t.Errorf("Position() = %v, want %v", pos, want)
+		}
+		_, pos = ids(BlobListRead("mapread://bucket/in", read, WithResume(pos)), -1)
+		if want := `{"key":"in/3.csv"}`; pos != want {
+			t.Errorf("Position() = %v, want %v", pos, want)
+		}
+	})
+	t.Run("invalid position", func(t *testing.T) {
+		it := BlobListRead("mapread://bucket/in", read, WithResume("in/2.csv"))
+		defer it.Close()
+		if _, err := it.Next(context.Background()); err == nil {
+			t.Error("Next() error = nil, want error")
+		}
+	})
+}
+
+// mapBucket serves the objects in objs counting the entries listed.
+type mapBucket struct {
+	driver.Bucket
+	objs   map[string]string
+	listed int
+}
+
+func (b *mapBucket) OpenBucketURL(context.Context, *url.URL) (*blob.Bucket, error) {
+	return blob.NewBucket(b), nil
+}
+
+func (b *mapBucket) ListPaged(_ context.Context, opts *driver.ListOptions) (*driver.ListPage, error) {
+	keys := []string{}
+	for k := range b.objs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	page := &driver.ListPage{}
+	for _, k := range keys {
+		if !strings.HasPrefix(k, opts.Prefix) {
+			continue
+		}
+		obj := &driver.ListObject{Key: k, Size: int64(len(b.objs[k]))}
+		if i := strings.Index(k[len(opts.Prefix):], opts.Delimiter); opts.Delimiter != "" && i != -1 {
+			dir := k[:len(opts.Prefix)+i+len(opts.Delimiter)]
+			if n := len(page.Objects); n > 0 && page.Objects[n-1].Key == dir {
+				continue
+			}
+			obj = &driver.ListObject{Key: dir, IsDir: true}
+		}
+		page.Objects = append(page.Objects, obj)
+	}
+	b.listed += len(page.Objects)
+	return page, nil
+}
+
+func (b *mapBucket) NewRangeReader(_ context.Context, key string, offset, _ int64, _ *driver.ReaderOptions) (driver.Reader, error) {
+	data, ok := b.objs[key]
+	if !ok {
+		return nil, fmt.Errorf("%q not found", key)
+	}
+	return &flakyReader{b: &flakyBucket{failEvery: len(data) + 1}, r: strings.NewReader(data[offset:])}, nil
+}
+
+func (b *mapBucket) ErrorCode(error) gcerrors.ErrorCode { return gcerrors.Unknown }
+
+func (b *mapBucket) Close() error { return nil }
+
+// flakyBucket serves the object data failing the reads with a connection
+// reset every failEvery bytes.
+type flakyBucket struct {
+	driver.Bucket
+	data      string
+	failEvery int
+	read      int
+}
+
+func (b *flakyBucket) OpenBucketURL(context.Context, *url.URL) (*blob.Bucket, error) {
+	return blob.NewBucket(b), nil
+}
+
+func (b *flakyBucket) NewRangeReader(_ context.Context, _ string, offset, _ int64, _ *driver.ReaderOptions) (driver.Reader, error) {
+	return &flakyReader{b: b, r: strings.NewReader(b.data[offset:])}, nil
+}
+
+func (b *flakyBucket) ErrorCode(error) gcerrors.ErrorCode { return gcerrors.Unknown }
+
+func (b *flakyBucket) Close() error { return nil }
+
+type flakyReader struct {
+	b *flakyBucket
+	r io.Reader
+}
+
+func (r *flakyReader) Read(p []byte) (int, error) {
+	if r.b.read >= r.b.failEvery {
+		r.b.read = 0
+		return 0, syscall.ECONNRESET
+	}
+	if max := r.b.failEvery - r.b.read; len(p) > max {
+		p = p[:max]
+	}
+	n, err := r.r.Read(p)
+	r.b.read += n
+	return n, err
+}
+
+func (r *flakyReader) Close() error                         { return nil }
+func (r *flakyReader) Attributes() *driver.ReaderAttributes { return &driver.ReaderAttributes{} }
+func (r *flakyReader) As(any) bool                          { return false }
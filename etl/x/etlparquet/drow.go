@@ -310,6 +310,56 @@ func drowSchemaFrom(r drow.Row) (*parquetschema.SchemaDefinition, error) {
 	return root, nil
 }
 
+// drowSchemaFromSchema builds the parquet schema of a drow.Schema with the
+// same types drowSchemaFrom uses for the coerced values.
+func drowSchemaFromSchema(s drow.Schema) (*parquetschema.SchemaDefinition, error) {
+	root := &parquetschema.SchemaDefinition{
+		RootColumn: &parquetschema.ColumnDefinition{
+			SchemaElement: &parquet.SchemaElement{},
+		},
+	}
+	for _, f := range s.Fields {
+		var ptyp parquet.Type
+		var convTyp *parquet.ConvertedType
+		var logTyp *parquet.LogicalType
+
+		rep := parquet.FieldRepetitionType_REQUIRED
+		if f.Nullable {
+			rep = parquet.FieldRepetitionType_OPTIONAL
+		}
+		switch f.Type {
+		case drow.TypeString:
+			ptyp = parquet.Type_BYTE_ARRAY
+			convTyp = convType(parquet.ConvertedType_UTF8)
+			logTyp = &parquet.LogicalType{
+				STRING: &parquet.StringType{},
+			}
+		case drow.TypeInt:
+			ptyp = parquet.Type_INT64
+		case drow.TypeFloat:
+			ptyp = parquet.Type_DOUBLE
+		case drow.TypeBool:
+			ptyp = parquet.Type_BOOLEAN
+		case drow.TypeTime:
+			ptyp = parquet.Type_INT64
+			convTyp = convType(parquet.ConvertedType_TIMESTAMP_MILLIS)
+		default:
+			return nil, fmt.Errorf("etlparquet: field %q: unsupported type %v", f.Name, f.Type)
+		}
+		col := &parquetschema.ColumnDefinition{
+			SchemaElement: &parquet.SchemaElement{
+				Name:           f.Name,
+				Type:           &ptyp,
+				RepetitionType: &rep,
+				ConvertedType:  convTyp,
+				LogicalType:    logTyp,
+			},
+		}
+		root.RootColumn.Children = append(root.RootColumn.Children, col)
+	}
+	return root, nil
+}
+
 func convType(t parquet.ConvertedType) *parquet.ConvertedType {
 	return &t
 }
@@ -139,9 +139,33 @@ func Decode[T any](it Iter, opts ...decodeOptFunc) Iter {
 	})
 }
 
+type encodeOptions struct {
+	schema *drow.Schema
+}
+
+type encodeOptFunc func(*encodeOptions)
+
+// WithEncodeSchema sets the schema used to encode rows, rows are coerced to
+// the schema instead of building the parquet schema from the first row.
+func WithEncodeSchema(s drow.Schema) encodeOptFunc {
+	return func(o *encodeOptions) {
+		o.schema = &s
+	}
+}
+
+func makeEncodeOptions(opts ...encodeOptFunc) encodeOptions {
+	opt := encodeOptions{}
+	for _, fn := range opts {
+		fn(&opt)
+	}
+	return opt
+}
+
 // Encode returns a new iterator that will iterate over encoded parquet []byte
-// data, it creates the schema based on the first received value.
-func Encode(it Iter) Iter {
+// data, it creates the schema based on the first received value unless
+// WithEncodeSchema is used.
+func Encode(it Iter, opts ...encodeOptFunc) Iter {
+	opt := makeEncodeOptions(opts...)
 	runner := func(ctx context.Context, yield etl.Y[[]byte]) error {
 		var pw *goparquet.FileWriter
 		var fw *floor.Writer
@@ -154,8 +178,24 @@ func Encode(it Iter) Iter {
 			}
 		}()
 		return etl.ConsumeContext(ctx, it, func(v any) error {
+			if opt.schema != nil {
+				row, ok := v.(drow.Row)
+				if !ok {
+					return fmt.Errorf("etlparquet.Encode: schema requires drow.Row, got %T", v)
+				}
+				var err error
+				if v, err = opt.schema.Coerce(row); err != nil {
+					return err
+				}
+			}
 			if pw == nil {
-				schema, err := schemaFrom(v)
+				var schema *parquetschema.SchemaDefinition
+				var err error
+				if opt.schema != nil {
+					schema, err = drowSchemaFromSchema(*opt.schema)
+				} else {
+					schema, err = schemaFrom(v)
+				}
 				if err != nil {
 					return err
 				}
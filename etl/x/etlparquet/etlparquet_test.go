@@ -0,0 +1,62 @@
+package etlparquet
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stdiopt/danda/drow"
+	"github.com/stdiopt/danda/etl"
+	"github.com/stdiopt/danda/etl/etldrow"
+)
+
+func TestEncodeSchemaRoundTrip(t *testing.T) {
+	schema := drow.NewSchema(
+		drow.FieldSchema{Name: "id", Type: drow.TypeInt},
+		drow.FieldSchema{Name: "name", Type: drow.TypeString},
+		drow.FieldSchema{Name: "score", Type: drow.TypeFloat, Nullable: true},
+		drow.FieldSchema{Name: "active", Type: drow.TypeBool, Default: false},
+		drow.FieldSchema{Name: "at", Type: drow.TypeTime, Nullable: true},
+	)
+	csv := []drow.Row{
+		{drow.F("id", "1"), drow.F("name", "abc"), drow.F("score", "7.5"), drow.F("active", "true"), drow.F("at", "2022-01-02 03:04:05")},
+		{drow.F("id", " 2"), drow.F("name", "de"), drow.F("score", ""), drow.F("at", "")},
+	}
+	// nullable fields are optional columns decoded as pointers
+	score, at := 7.5, time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)
+	want := []drow.Row{
+		{drow.F("id", int64(1)), drow.F("name", "abc"), drow.F("score", &score), drow.F("active", true), drow.F("at", &at)},
+		{drow.F("id", int64(2)), drow.F("name", "de"), drow.F("score", (*float64)(nil)), drow.F("active", false), drow.F("at", (*time.Time)(nil))},
+	}
+
+	type test struct {
+		it   func() etl.Iter
+		opts []encodeOptFunc
+	}
+	run := func(name string, tt test) {
+		t.Helper()
+		t.Run(name, func(t *testing.T) {
+			got, err := etl.Collect[drow.Row](Decode[drow.Row](Encode(tt.it(), tt.opts...)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			// timestamps are decoded in the local time zone
+			for _, row := range got {
+				if p, ok := row.Value("at").(*time.Time); ok && p != nil {
+					*p = p.UTC()
+				}
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("round trip\nwant: %v\n got: %v", want, got)
+			}
+		})
+	}
+	run("encode schema", test{
+		it:   func() etl.Iter { return etl.Values(csv...) },
+		opts: []encodeOptFunc{WithEncodeSchema(schema)},
+	})
+	run("coerced rows", test{
+		it:   func() etl.Iter { return etldrow.Coerce(etl.Values(csv...), schema, nil) },
+		opts: []encodeOptFunc{WithEncodeSchema(schema)},
+	})
+}
@@ -1,6 +1,9 @@
 package gframe
 
-import "github.com/stdiopt/danda/util/conv"
+import (
+	"github.com/stdiopt/danda/util/conv"
+	"github.com/stdiopt/danda/util/dagg"
+)
 
 // GroupByFunc wrap a function that takes a row and returns a row to be used as
 // the group key.
@@ -79,6 +82,59 @@ func AggFirst(name string, field ...string) aggOptFn {
 	})
 }
 
+// AggMin returns an aggregation option that returns the minimum value of a field.
+func AggMin(name string, field ...string) aggOptFn {
+	return dagg.Min(asName(name, field...), dagg.FieldValue(name))
+}
+
+// AggLast returns an aggregation option that returns the last occurrence of the group.
+func AggLast(name string, field ...string) aggOptFn {
+	return dagg.Last(asName(name, field...), dagg.FieldValue(name))
+}
+
+// AggCountDistinct returns an aggregation option that counts the distinct values of a field.
+func AggCountDistinct(name string, field ...string) aggOptFn {
+	return dagg.CountDistinct(asName(name, field...), dagg.FieldValue(name))
+}
+
+// AggVariance returns an aggregation option that returns the sample variance of a field.
+func AggVariance(name string, field ...string) aggOptFn {
+	return dagg.Variance(asName(name, field...), dagg.FieldValue(name))
+}
+
+// AggStdDev returns an aggregation option that returns the sample standard deviation of a field.
+func AggStdDev(name string, field ...string) aggOptFn {
+	return dagg.StdDev(asName(name, field...), dagg.FieldValue(name))
+}
+
+// AggMedian returns an aggregation option that returns the median of a field.
+func AggMedian(name string, field ...string) aggOptFn {
+	return dagg.Median(asName(name, field...), dagg.FieldValue(name))
+}
+
+// AggPercentile returns an aggregation option that returns the percentile p
+// in [0, 1] of a field.
+func AggPercentile(name string, p float64, field ...string) aggOptFn {
+	return dagg.Percentile(asName(name, field...), dagg.FieldValue(name), p)
+}
+
+// AggCollect returns an aggregation option that collects the values of a field into a []any.
+func AggCollect(name string, field ...string) aggOptFn {
+	return dagg.Collect(asName(name, field...), dagg.FieldValue(name))
+}
+
+// AggApproxCountDistinct returns an aggregation option that estimates the
+// distinct values of a field using HyperLogLog.
+func AggApproxCountDistinct(name string, field ...string) aggOptFn {
+	return dagg.ApproxCountDistinct(asName(name, field...), dagg.FieldValue(name))
+}
+
+// AggApproxPercentile returns an aggregation option that estimates the
+// percentile p in [0, 1] of a field using a t-digest.
+func AggApproxPercentile(name string, p float64, field ...string) aggOptFn {
+	return dagg.ApproxPercentile(asName(name, field...), dagg.FieldValue(name), p)
+}
+
 func asName(name string, field ...string) string {
 	if len(field) > 0 {
 		return field[0]
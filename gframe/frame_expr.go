@@ -0,0 +1,61 @@
+package gframe
+
+import (
+	"fmt"
+
+	"github.com/stdiopt/danda/drow/expr"
+)
+
+// FilterExpr is like Filter with the rows that match the expression src,
+// see package drow/expr for the syntax.
+func (f Frame) FilterExpr(src string) Frame {
+	e, err := expr.CompileFilter(src)
+	if err != nil {
+		return ErrFrame(err)
+	}
+	var eerr error
+	res := f.Filter(func(row Row) bool {
+		if eerr != nil {
+			return false
+		}
+		var ok bool
+		ok, eerr = e.Match(row)
+		return ok
+	})
+	if eerr != nil {
+		return ErrFrame(eerr)
+	}
+	return res
+}
+
+// MapExpr is like Map with the fields set by the assignment expressions in
+// order, as in "total = price * qty".
+func (f Frame) MapExpr(assigns ...string) Frame {
+	exprs := make([]*expr.Expr, len(assigns))
+	for i, src := range assigns {
+		e, err := expr.Compile(src)
+		if err == nil && e.Name() == "" {
+			err = fmt.Errorf("gframe.MapExpr: %q is not an assignment", src)
+		}
+		if err != nil {
+			return ErrFrame(err)
+		}
+		exprs[i] = e
+	}
+	var eerr error
+	res := f.Map(func(row Row) Row {
+		for _, e := range exprs {
+			r, err := e.Assign(row)
+			if err != nil {
+				eerr = err
+				return row
+			}
+			row = r
+		}
+		return row
+	})
+	if eerr != nil {
+		return ErrFrame(eerr)
+	}
+	return res
+}
@@ -53,6 +53,56 @@ func (g FrameGroupBy) Mean(field string, as ...string) FrameGroupBy {
 	return g.with(AggMean(field, as...))
 }
 
+// Min returns the smallest value in the specific field.
+func (g FrameGroupBy) Min(field string, as ...string) FrameGroupBy {
+	return g.with(AggMin(field, as...))
+}
+
+// Last returns the last value of the specific field in the group.
+func (g FrameGroupBy) Last(field string, as ...string) FrameGroupBy {
+	return g.with(AggLast(field, as...))
+}
+
+// CountDistinct counts the distinct values of the specific field.
+func (g FrameGroupBy) CountDistinct(field string, as ...string) FrameGroupBy {
+	return g.with(AggCountDistinct(field, as...))
+}
+
+// Variance returns the sample variance of the specific field.
+func (g FrameGroupBy) Variance(field string, as ...string) FrameGroupBy {
+	return g.with(AggVariance(field, as...))
+}
+
+// StdDev returns the sample standard deviation of the specific field.
+func (g FrameGroupBy) StdDev(field string, as ...string) FrameGroupBy {
+	return g.with(AggStdDev(field, as...))
+}
+
+// Median returns the median of the specific field.
+func (g FrameGroupBy) Median(field string, as ...string) FrameGroupBy {
+	return g.with(AggMedian(field, as...))
+}
+
+// Percentile returns the percentile p in [0, 1] of the specific field.
+func (g FrameGroupBy) Percentile(field string, p float64, as ...string) FrameGroupBy {
+	return g.with(AggPercentile(field, p, as...))
+}
+
+// Collect collects the values of the specific field into a []any.
+func (g FrameGroupBy) Collect(field string, as ...string) FrameGroupBy {
+	return g.with(AggCollect(field, as...))
+}
+
+// ApproxCountDistinct estimates the distinct values of the specific field.
+func (g FrameGroupBy) ApproxCountDistinct(field string, as ...string) FrameGroupBy {
+	return g.with(AggApproxCountDistinct(field, as...))
+}
+
+// ApproxPercentile estimates the percentile p in [0, 1] of the specific field.
+func (g FrameGroupBy) ApproxPercentile(field string, p float64, as ...string) FrameGroupBy {
+	return g.with(AggApproxPercentile(field, p, as...))
+}
+
 // Custom adds a custom reduce function to the groupby operation.
 func (g FrameGroupBy) Custom(opts ...aggOptFn) FrameGroupBy {
 	return g.with(opts...)
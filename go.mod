@@ -5,10 +5,14 @@ go 1.19
 require (
 	github.com/cockroachdb/apd v1.1.0
 	github.com/fraugster/parquet-go v0.12.0
+	github.com/go-sql-driver/mysql v1.7.1
 	github.com/krolaw/zipstream v0.0.0-20180621105154-0a2661891f94
+	github.com/lib/pq v1.10.9
+	github.com/mattn/go-sqlite3 v1.14.22
 	gocloud.dev v0.34.0
 	golang.org/x/exp v0.0.0-20231006140011-7918f672742d
 	golang.org/x/sync v0.4.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -0,0 +1,336 @@
+package dagg
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stdiopt/danda/util/conv"
+	"github.com/stdiopt/danda/util/sketch"
+)
+
+// The aggregators below take a func that extracts the value to aggregate
+// from T, nil values and nil pointers are ignored by all aggregators except
+// First and Last.
+// Numeric aggregators convert values with conv.Conv and ignore strings that
+// are not numbers.
+
+// FieldValue returns a value func that extracts the field name from a Row.
+func FieldValue(name string) func(Row) any {
+	return func(r Row) any {
+		return r.At(name).Value
+	}
+}
+
+// reduce adds a reduce func with a typed accumulator, the accumulator is
+// created by init on the first value of each group.
+func reduce[T, S any](name string, init func() S, fn func(S, T) S, final func(S) any) OptFn[T] {
+	return func(a *Agg[T]) {
+		a.Reduce(name,
+			func(acc any, v T) any {
+				s, ok := acc.(S)
+				if !ok {
+					s = init()
+				}
+				return fn(s, v)
+			},
+			func(acc any) any {
+				s, ok := acc.(S)
+				if !ok {
+					s = init()
+				}
+				return final(s)
+			},
+		)
+	}
+}
+
+// Count counts the non nil values, if fn is nil all values are counted.
+func Count[T any](name string, fn func(T) any) OptFn[T] {
+	return reduce(name,
+		func() int { return 0 },
+		func(n int, v T) int {
+			if fn != nil && conv.Deref(fn(v)) == nil {
+				return n
+			}
+			return n + 1
+		},
+		func(n int) any { return n },
+	)
+}
+
+// Sum sums the values as float64.
+func Sum[T any](name string, fn func(T) any) OptFn[T] {
+	return reduce(name,
+		func() float64 { return 0 },
+		func(s float64, v T) float64 {
+			if f, ok := toFloat(fn(v)); ok {
+				return s + f
+			}
+			return s
+		},
+		func(s float64) any { return s },
+	)
+}
+
+// Min returns the smallest value, numbers, strings and time.Time are
+// compared naturally, other types by their string representation.
+func Min[T any](name string, fn func(T) any) OptFn[T] {
+	return extreme(name, fn, -1)
+}
+
+// Max returns the biggest value, see Min.
+func Max[T any](name string, fn func(T) any) OptFn[T] {
+	return extreme(name, fn, 1)
+}
+
+func extreme[T any](name string, fn func(T) any, sign int) OptFn[T] {
+	type state struct {
+		v   any
+		set bool
+	}
+	return reduce(name,
+		func() *state { return &state{} },
+		func(s *state, v T) *state {
+			x := conv.Deref(fn(v))
+			if x == nil {
+				return s
+			}
+			if !s.set || compare(x, s.v)*sign > 0 {
+				s.v, s.set = x, true
+			}
+			return s
+		},
+		func(s *state) any { return s.v },
+	)
+}
+
+// First returns the first value of the group.
+func First[T any](name string, fn func(T) any) OptFn[T] {
+	type state struct {
+		v   any
+		set bool
+	}
+	return reduce(name,
+		func() *state { return &state{} },
+		func(s *state, v T) *state {
+			if !s.set {
+				s.v, s.set = fn(v), true
+			}
+			return s
+		},
+		func(s *state) any { return s.v },
+	)
+}
+
+// Last returns the last value of the group.
+func Last[T any](name string, fn func(T) any) OptFn[T] {
+	type state struct{ v any }
+	return reduce(name,
+		func() *state { return &state{} },
+		func(s *state, v T) *state {
+			s.v = fn(v)
+			return s
+		},
+		func(s *state) any { return s.v },
+	)
+}
+
+// Mean returns the average of the values, NaN if there are no values.
+func Mean[T any](name string, fn func(T) any) OptFn[T] {
+	return moments(name, fn, func(s *momentsState) any {
+		if s.n == 0 {
+			return math.NaN()
+		}
+		return s.mean
+	})
+}
+
+// Variance returns the sample variance of the values.
+func Variance[T any](name string, fn func(T) any) OptFn[T] {
+	return moments(name, fn, func(s *momentsState) any {
+		return s.variance()
+	})
+}
+
+// StdDev returns the sample standard deviation of the values.
+func StdDev[T any](name string, fn func(T) any) OptFn[T] {
+	return moments(name, fn, func(s *momentsState) any {
+		return math.Sqrt(s.variance())
+	})
+}
+
+// momentsState accumulates the mean and variance with Welford's algorithm.
+type momentsState struct {
+	n    int
+	mean float64
+	m2   float64
+}
+
+func (s *momentsState) variance() float64 {
+	if s.n < 2 {
+		return math.NaN()
+	}
+	return s.m2 / float64(s.n-1)
+}
+
+func moments[T any](name string, fn func(T) any, final func(*momentsState) any) OptFn[T] {
+	return reduce(name,
+		func() *momentsState { return &momentsState{} },
+		func(s *momentsState, v T) *momentsState {
+			x, ok := toFloat(fn(v))
+			if !ok {
+				return s
+			}
+			s.n++
+			d := x - s.mean
+			s.mean += d / float64(s.n)
+			s.m2 += d * (x - s.mean)
+			return s
+		},
+		final,
+	)
+}
+
+// Median returns the exact median, all values of the group are kept in
+// memory, see ApproxPercentile for big groups.
+func Median[T any](name string, fn func(T) any) OptFn[T] {
+	return Percentile(name, fn, 0.5)
+}
+
+// Percentile returns the exact percentile p in [0, 1] with linear
+// interpolation, all values of the group are kept in memory.
+func Percentile[T any](name string, fn func(T) any, p float64) OptFn[T] {
+	type state struct{ vs []float64 }
+	return reduce(name,
+		func() *state { return &state{} },
+		func(s *state, v T) *state {
+			if x, ok := toFloat(fn(v)); ok {
+				s.vs = append(s.vs, x)
+			}
+			return s
+		},
+		func(s *state) any {
+			if len(s.vs) == 0 {
+				return math.NaN()
+			}
+			sort.Float64s(s.vs)
+			pos := p * float64(len(s.vs)-1)
+			lo := int(math.Floor(pos))
+			hi := int(math.Ceil(pos))
+			if lo < 0 {
+				return s.vs[0]
+			}
+			if hi >= len(s.vs) {
+				return s.vs[len(s.vs)-1]
+			}
+			return s.vs[lo] + (s.vs[hi]-s.vs[lo])*(pos-float64(lo))
+		},
+	)
+}
+
+// CountDistinct returns the exact number of distinct values.
+func CountDistinct[T any](name string, fn func(T) any) OptFn[T] {
+	type state struct{ seen map[any]struct{} }
+	return reduce(name,
+		func() *state { return &state{seen: map[any]struct{}{}} },
+		func(s *state, v T) *state {
+			if x := conv.Deref(fn(v)); x != nil {
+				s.seen[groupKey(x)] = struct{}{}
+			}
+			return s
+		},
+		func(s *state) any { return len(s.seen) },
+	)
+}
+
+// Collect returns a []any with all the values of the group.
+func Collect[T any](name string, fn func(T) any) OptFn[T] {
+	type state struct{ vs []any }
+	return reduce(name,
+		func() *state { return &state{vs: []any{}} },
+		func(s *state, v T) *state {
+			if x := fn(v); conv.Deref(x) != nil {
+				s.vs = append(s.vs, x)
+			}
+			return s
+		},
+		func(s *state) any { return s.vs },
+	)
+}
+
+// ApproxCountDistinct returns the estimated number of distinct values using
+// a HyperLogLog with about 0.8% standard error and fixed memory.
+func ApproxCountDistinct[T any](name string, fn func(T) any) OptFn[T] {
+	return reduce(name,
+		func() *sketch.HyperLogLog { return sketch.NewHyperLogLog(14) },
+		func(h *sketch.HyperLogLog, v T) *sketch.HyperLogLog {
+			if x := conv.Deref(fn(v)); x != nil {
+				h.Add(x)
+			}
+			return h
+		},
+		func(h *sketch.HyperLogLog) any { return int(h.Count()) },
+	)
+}
+
+// ApproxPercentile returns the estimated percentile p in [0, 1] using a
+// t-digest with fixed memory.
+func ApproxPercentile[T any](name string, fn func(T) any, p float64) OptFn[T] {
+	return reduce(name,
+		func() *sketch.TDigest { return sketch.NewTDigest(100) },
+		func(d *sketch.TDigest, v T) *sketch.TDigest {
+			if x, ok := toFloat(fn(v)); ok {
+				d.Add(x)
+			}
+			return d
+		},
+		func(d *sketch.TDigest) any { return d.Quantile(p) },
+	)
+}
+
+// toFloat converts v to a float64, it fails on nil, nil pointers and strings
+// that are not numbers.
+func toFloat(v any) (float64, bool) {
+	switch v := conv.Deref(v).(type) {
+	case nil:
+		return 0, false
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f, err == nil
+	case []byte:
+		f, err := strconv.ParseFloat(strings.TrimSpace(string(v)), 64)
+		return f, err == nil
+	default:
+		return conv.Conv[float64](0, v), true
+	}
+}
+
+// compare returns -1, 0 or 1 comparing a to b.
+func compare(a, b any) int {
+	switch a := a.(type) {
+	case string:
+		if b, ok := b.(string); ok {
+			return strings.Compare(a, b)
+		}
+	case time.Time:
+		if b, ok := b.(time.Time); ok {
+			return a.Compare(b)
+		}
+	case int, int8, int16, int32, int64,
+		uint, uint8, uint16, uint32, uint64,
+		float32, float64:
+		fa, fb := conv.Conv[float64](0, a), conv.Conv[float64](0, b)
+		switch {
+		case fa < fb:
+			return -1
+		case fa > fb:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
@@ -3,9 +3,12 @@ package dagg
 
 import (
 	"fmt"
+	"io"
+	"reflect"
+	"strings"
 
 	"github.com/stdiopt/danda/drow"
-	"github.com/stdiopt/danda/util/set"
+	"github.com/stdiopt/danda/util/conv"
 )
 
 type (
@@ -30,14 +33,29 @@ type optField[T any] struct {
 }
 
 // Agg is an aggregation struct with methods to perform aggregations.
+//
+// Groups are kept in a hash index in the order they are first seen, by
+// default all groups are kept in memory until Each is called.
+// With Sorted the input is expected to be sorted by group and each group is
+// finished when the key changes, with Spill values of new groups are
+// written to disk once the number of groups exceeds a budget.
 type Agg[T any] struct {
-	// opts aggOptions
-	groupMap set.Set[any]
+	index map[any]int
+	keys  []any
 
 	grpFn GroupFn[T]
 	aggs  []optField[T]
 
 	rows []Row
+
+	sorted bool
+	ready  []Row
+	// last group value and the direction of the group changes in sorted
+	// mode.
+	last  any
+	order int
+
+	spill *spiller[T]
 }
 
 // GroupBy sets the group function for the aggregation.
@@ -50,6 +68,41 @@ func (o *Agg[T]) Reduce(name string, reduceFunc func(any, T) any, finalFunc func
 	o.aggs = append(o.aggs, optField[T]{name, reduceFunc, finalFunc})
 }
 
+// Sorted sets the aggregation to expect values sorted by group, a group is
+// finished as soon as a value with a different group is added and can be
+// retrieved with Pop.
+// Add returns an error if a group arrives out of order, either ascending or
+// descending as set by the first change of group.
+func (o *Agg[T]) Sorted() {
+	o.sorted = true
+}
+
+// Spill sets the maximum number of groups kept in memory, values of new
+// groups beyond that are written to temporary files in dir partitioned by
+// group and aggregated one partition at a time by Each.
+// Values are encoded with encoding/gob unless SpillCodec is used.
+func (o *Agg[T]) Spill(budget int, dir string) {
+	if o.spill == nil {
+		o.spill = newSpiller[T]()
+	}
+	o.spill.budget = budget
+	o.spill.dir = dir
+}
+
+// SpillCodec sets the funcs used to encode and decode spilled values.
+func (o *Agg[T]) SpillCodec(newEncoder func(io.Writer) func(T) error, newDecoder func(io.Reader) func() (T, error)) {
+	if o.spill == nil {
+		o.spill = newSpiller[T]()
+	}
+	o.spill.newEncoder = newEncoder
+	o.spill.newDecoder = newDecoder
+}
+
+// Len returns the number of groups in memory.
+func (o *Agg[T]) Len() int {
+	return len(o.rows)
+}
+
 // Add adds a value to be processed and aggregated.
 func (o *Agg[T]) Add(value T) error {
 	if o.grpFn == nil {
@@ -59,11 +112,27 @@ func (o *Agg[T]) Add(value T) error {
 	if err != nil {
 		return err
 	}
+	k := groupKey(gv)
 
-	ri, ok := o.groupMap.IndexOrAdd(gv)
+	ri, ok := o.index[k]
+	if !ok && o.sorted && len(o.rows) > 0 {
+		if err := o.checkOrder(gv); err != nil {
+			return err
+		}
+		o.ready = append(o.ready, o.row(0))
+		o.reset()
+	}
 	if !ok {
-		row := make(Row, len(o.aggs))
-		o.rows = append(o.rows, row)
+		if o.spill != nil && o.spill.budget > 0 && len(o.rows) >= o.spill.budget {
+			return o.spill.add(k, value)
+		}
+		if o.index == nil {
+			o.index = map[any]int{}
+		}
+		ri = len(o.rows)
+		o.index[k] = ri
+		o.keys = append(o.keys, gv)
+		o.rows = append(o.rows, make(Row, len(o.aggs)))
 	}
 
 	for i, a := range o.aggs {
@@ -74,30 +143,49 @@ func (o *Agg[T]) Add(value T) error {
 	return nil
 }
 
-// Each passes the produced aggregation row by calling fn
+// Pop returns the next finished group in sorted mode.
+func (o *Agg[T]) Pop() (Row, bool) {
+	if len(o.ready) == 0 {
+		return nil, false
+	}
+	r := o.ready[0]
+	o.ready = o.ready[1:]
+	return r, true
+}
+
+// Each passes the produced aggregation row by calling fn, spilled partitions
+// are aggregated after the groups in memory and removed.
 func (o *Agg[T]) Each(fn func(Row) error) error {
-	for i, r := range o.rows {
-		sr, ok := o.groupMap.Data[i].(Row)
-		if !ok {
-			sr = Row{Field{Name: "group_by", Value: o.groupMap.Data[i]}}
+	for len(o.ready) > 0 {
+		r, _ := o.Pop()
+		if err := fn(r); err != nil {
+			return err
 		}
-		rc := make(Row, len(sr)+len(r))
-		copy(rc, sr)
-
-		rd := rc[len(sr):]
-		// Apply final transformation
-		for fi, a := range o.aggs {
-			if a.finalFunc == nil {
-				rd[fi] = r[fi]
-				continue
-			}
-			rd[fi] = Field{Name: r[fi].Name, Value: a.finalFunc(r[fi].Value)}
+	}
+	for i := range o.rows {
+		if err := fn(o.row(i)); err != nil {
+			return err
 		}
-		if err := fn(rc); err != nil {
+	}
+	if o.spill == nil {
+		return nil
+	}
+	defer o.spill.close() // nolint: errcheck
+	return o.spill.each(func(values func(func(T) error) error) error {
+		sub := &Agg[T]{grpFn: o.grpFn, aggs: o.aggs}
+		if err := values(sub.Add); err != nil {
 			return err
 		}
+		return sub.Each(fn)
+	})
+}
+
+// Close removes any spilled files.
+func (o *Agg[T]) Close() error {
+	if o.spill == nil {
+		return nil
 	}
-	return nil
+	return o.spill.close()
 }
 
 func (o *Agg[T]) Result() ([]Row, error) {
@@ -108,3 +196,86 @@ func (o *Agg[T]) Result() ([]Row, error) {
 	})
 	return rows, err
 }
+
+// row returns the result row for the group i.
+func (o *Agg[T]) row(i int) Row {
+	r := o.rows[i]
+	sr, ok := o.keys[i].(Row)
+	if !ok {
+		sr = Row{Field{Name: "group_by", Value: o.keys[i]}}
+	}
+	rc := make(Row, len(sr)+len(r))
+	copy(rc, sr)
+
+	rd := rc[len(sr):]
+	// Apply final transformation
+	for fi, a := range o.aggs {
+		if a.finalFunc == nil {
+			rd[fi] = r[fi]
+			continue
+		}
+		rd[fi] = Field{Name: r[fi].Name, Value: a.finalFunc(r[fi].Value)}
+	}
+	return rc
+}
+
+// checkOrder checks if the group value gv follows the current group in the
+// same direction of the previous changes.
+func (o *Agg[T]) checkOrder(gv any) error {
+	c := compareGroup(o.keys[0], gv)
+	switch {
+	case c == 0:
+	case o.order == 0:
+		o.order = c
+	case c != o.order:
+		return fmt.Errorf("group %v out of order after %v", gv, o.keys[0])
+	}
+	return nil
+}
+
+func (o *Agg[T]) reset() {
+	o.index = nil
+	o.keys = nil
+	o.rows = nil
+}
+
+// rowKey is the hashable representation of a Row group.
+type rowKey string
+
+// compareGroup returns -1, 0 or 1 comparing the group values a and b, Rows
+// are compared field by field.
+func compareGroup(a, b any) int {
+	ra, aok := a.(Row)
+	rb, bok := b.(Row)
+	if !aok || !bok {
+		return compare(conv.Deref(a), conv.Deref(b))
+	}
+	for i := 0; i < len(ra) && i < len(rb); i++ {
+		if c := compareGroup(ra[i].Value, rb[i].Value); c != 0 {
+			return c
+		}
+	}
+	return compare(len(ra), len(rb))
+}
+
+// groupKey returns a hashable key for the group value v, pointers are
+// dereferenced and Rows and other non comparable values are encoded as
+// strings.
+func groupKey(v any) any {
+	v = conv.Deref(v)
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case Row:
+		var sb strings.Builder
+		for _, f := range v {
+			fv := conv.Deref(f.Value)
+			fmt.Fprintf(&sb, "%s\x00%T\x00%v\x1f", f.Name, fv, groupKey(fv))
+		}
+		return rowKey(sb.String())
+	}
+	if !reflect.TypeOf(v).Comparable() {
+		return rowKey(fmt.Sprintf("%T\x00%#v", v, v))
+	}
+	return v
+}
@@ -0,0 +1,248 @@
+package dagg_test
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/stdiopt/danda/drow"
+	"github.com/stdiopt/danda/util/dagg"
+)
+
+type Row = drow.Row
+
+func TestAggregators(t *testing.T) {
+	type test struct {
+		opt  dagg.OptFn[Row]
+		want any
+	}
+
+	rows := []Row{
+		{drow.F("g", "a"), drow.F("v", 4), drow.F("s", "x")},
+		{drow.F("g", "a"), drow.F("v", 1.5), drow.F("s", "z")},
+		{drow.F("g", "a"), drow.F[any]("v", nil), drow.F("s", "y")},
+		{drow.F("g", "a"), drow.F("v", int64(7)), drow.F("s", "x")},
+		{drow.F("g", "a"), drow.F("v", uint8(2)), drow.F[any]("s", nil)},
+	}
+	v := dagg.FieldValue("v")
+	s := dagg.FieldValue("s")
+
+	run := func(name string, tt test) {
+		t.Helper()
+		t.Run(name, func(t *testing.T) {
+			t.Helper()
+			a := dagg.Agg[Row]{}
+			a.GroupBy(func(r Row) (any, error) { return r.At("g").Value, nil })
+			tt.opt(&a)
+			for _, r := range rows {
+				if err := a.Add(r); err != nil {
+					t.Fatal(err)
+				}
+			}
+			res, err := a.Result()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(res) != 1 {
+				t.Fatalf("Result() = %v groups, want 1", len(res))
+			}
+			got := res[0].At("r").Value
+			if f, ok := tt.want.(float64); ok {
+				if g, ok := got.(float64); !ok || math.Abs(g-f) > 1e-9 {
+					t.Errorf("result = %v, want %v", got, tt.want)
+				}
+				return
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("result = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	run("count", test{opt: dagg.Count("r", v), want: 4})
+	run("count all", test{opt: dagg.Count[Row]("r", nil), want: 5})
+	run("sum", test{opt: dagg.Sum("r", v), want: 14.5})
+	run("min", test{opt: dagg.Min("r", v), want: 1.5})
+	run("max", test{opt: dagg.Max("r", v), want: int64(7)})
+	run("min string", test{opt: dagg.Min("r", s), want: "x"})
+	run("max string", test{opt: dagg.Max("r", s), want: "z"})
+	run("first", test{opt: dagg.First("r", s), want: "x"})
+	run("last", test{opt: dagg.Last("r", s), want: nil})
+	run("mean", test{opt: dagg.Mean("r", v), want: 3.625})
+	run("variance", test{opt: dagg.Variance("r", v), want: 18.6875 / 3})
+	run("stddev", test{opt: dagg.StdDev("r", v), want: math.Sqrt(18.6875 / 3)})
+	run("median", test{opt: dagg.Median("r", v), want: 3.0})
+	run("percentile", test{opt: dagg.Percentile("r", v, 1), want: 7.0})
+	run("count distinct", test{opt: dagg.CountDistinct("r", s), want: 3})
+	run("collect", test{opt: dagg.Collect("r", s), want: []any{"x", "z", "y", "x"}})
+	run("approx count distinct", test{opt: dagg.ApproxCountDistinct("r", s), want: 3})
+	run("approx percentile", test{opt: dagg.ApproxPercentile("r", v, 0), want: 1.5})
+}
+
+func TestAggregatorsSkipValues(t *testing.T) {
+	type test struct {
+		opt  dagg.OptFn[any]
+		want any
+	}
+	ten := 10
+	values := []any{"3", " 2.5 ", "n/a", (*int)(nil), &ten, []byte("1")}
+	v := func(x any) any { return x }
+
+	run := func(name string, tt test) {
+		t.Helper()
+		t.Run(name, func(t *testing.T) {
+			t.Helper()
+			a := dagg.Agg[any]{}
+			a.GroupBy(func(any) (any, error) { return nil, nil })
+			tt.opt(&a)
+			for _, x := range values {
+				if err := a.Add(x); err != nil {
+					t.Fatal(err)
+				}
+			}
+			res, err := a.Result()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := res[0].At("r").Value; fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("result = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	run("count", test{opt: dagg.Count("r", v), want: 5})
+	run("sum", test{opt: dagg.Sum("r", v), want: 16.5})
+	run("mean", test{opt: dagg.Mean("r", v), want: 4.125})
+	run("median", test{opt: dagg.Median("r", v), want: 2.75})
+	run("count distinct", test{opt: dagg.CountDistinct("r", v), want: 5})
+	run("collect", test{opt: dagg.Collect("r", v), want: []any{"3", " 2.5 ", "n/a", &ten, []byte("1")}})
+}
+
+func TestAggSorted(t *testing.T) {
+	a := dagg.Agg[int]{}
+	a.GroupBy(func(v int) (any, error) { return v / 10, nil })
+	a.Sorted()
+	dagg.Count[int]("n", nil)(&a)
+
+	var popped []string
+	for _, v := range []int{1, 2, 3, 11, 12, 25} {
+		if err := a.Add(v); err != nil {
+			t.Fatal(err)
+		}
+		for r, ok := a.Pop(); ok; r, ok = a.Pop() {
+			popped = append(popped, fmt.Sprint(r))
+		}
+	}
+	if want := "[{group_by: 0, n: 3} {group_by: 1, n: 2}]"; fmt.Sprint(popped) != want {
+		t.Errorf("Pop() = %v, want %v", popped, want)
+	}
+	res, err := a.Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "[{group_by: 2, n: 1}]"; fmt.Sprint(res) != want {
+		t.Errorf("Result() = %v, want %v", res, want)
+	}
+}
+
+func TestAggSortedOrder(t *testing.T) {
+	type test struct {
+		values  []int
+		wantErr bool
+	}
+	run := func(name string, tt test) {
+		t.Helper()
+		t.Run(name, func(t *testing.T) {
+			a := dagg.Agg[int]{}
+			a.GroupBy(func(v int) (any, error) { return v / 10, nil })
+			a.Sorted()
+			var err error
+			for _, v := range tt.values {
+				if err = a.Add(v); err != nil {
+					break
+				}
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Add() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+	run("ascending", test{values: []int{1, 11, 21}})
+	run("descending", test{values: []int{21, 11, 1}})
+	run("repeated group", test{values: []int{1, 11, 2}, wantErr: true})
+	run("earlier group", test{values: []int{1, 11, 21, 5}, wantErr: true})
+	run("direction change", test{values: []int{21, 11, 31}, wantErr: true})
+}
+
+func TestAggSortedRows(t *testing.T) {
+	a := dagg.Agg[Row]{}
+	a.GroupBy(func(r Row) (any, error) { return r.Select("a", "b"), nil })
+	a.Sorted()
+	for _, r := range []Row{
+		{drow.F("a", 1), drow.F("b", "x")},
+		{drow.F("a", 1), drow.F("b", "y")},
+		{drow.F("a", 2), drow.F("b", "a")},
+	} {
+		if err := a.Add(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := a.Add(Row{drow.F("a", 1), drow.F("b", "z")})
+	if err == nil {
+		t.Error("Add() out of order row group, want error")
+	}
+}
+
+func TestAggPointerGroups(t *testing.T) {
+	a := dagg.Agg[*string]{}
+	a.GroupBy(func(v *string) (any, error) { return v, nil })
+	dagg.Count[*string]("n", nil)(&a)
+
+	x1, x2, y := "x", "x", "y"
+	var null *string
+	for _, v := range []*string{&x1, &y, &x2, null, nil} {
+		if err := a.Add(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	res, err := a.Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != 3 {
+		t.Fatalf("Result() = %v, want 3 groups", res)
+	}
+	for i, want := range []int{2, 1, 2} {
+		if got := res[i].At("n").Int(); got != want {
+			t.Errorf("group %d n = %v, want %v", i, got, want)
+		}
+	}
+}
+
+func TestAggSpill(t *testing.T) {
+	a := dagg.Agg[int]{}
+	a.GroupBy(func(v int) (any, error) { return v % 10, nil })
+	a.Spill(3, t.TempDir())
+	dagg.Sum[int]("sum", func(v int) any { return v })(&a)
+
+	for i := 0; i < 100; i++ {
+		if err := a.Add(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if a.Len() != 3 {
+		t.Errorf("Len() = %v, want 3", a.Len())
+	}
+	res, err := a.Result()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[int]float64{}
+	for _, r := range res {
+		got[r.At("group_by").Int()] = r.At("sum").Float64()
+	}
+	for g := 0; g < 10; g++ {
+		if want := float64(g*10 + 450); got[g] != want {
+			t.Errorf("group %d sum = %v, want %v", g, got[g], want)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package dagg
+
+import (
+	"bufio"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+)
+
+// spillPartitions is the number of files values are partitioned into.
+const spillPartitions = 16
+
+type spillFile[T any] struct {
+	f   *os.File
+	w   *bufio.Writer
+	enc func(T) error
+}
+
+// spiller writes values of groups that don't fit in memory to partition
+// files, the same group always goes to the same partition.
+type spiller[T any] struct {
+	budget     int
+	dir        string
+	newEncoder func(io.Writer) func(T) error
+	newDecoder func(io.Reader) func() (T, error)
+
+	parts []*spillFile[T]
+}
+
+func newSpiller[T any]() *spiller[T] {
+	return &spiller[T]{
+		newEncoder: func(w io.Writer) func(T) error {
+			enc := gob.NewEncoder(w)
+			return func(v T) error {
+				return enc.Encode(&v)
+			}
+		},
+		newDecoder: func(r io.Reader) func() (T, error) {
+			dec := gob.NewDecoder(r)
+			return func() (T, error) {
+				var v T
+				err := dec.Decode(&v)
+				return v, err
+			}
+		},
+	}
+}
+
+func (s *spiller[T]) add(k any, v T) error {
+	if s.parts == nil {
+		s.parts = make([]*spillFile[T], spillPartitions)
+	}
+	h := fnv.New32a()
+	fmt.Fprint(h, k)
+	pi := h.Sum32() % spillPartitions
+
+	p := s.parts[pi]
+	if p == nil {
+		f, err := os.CreateTemp(s.dir, "dagg-*")
+		if err != nil {
+			return err
+		}
+		w := bufio.NewWriter(f)
+		p = &spillFile[T]{f: f, w: w, enc: s.newEncoder(w)}
+		s.parts[pi] = p
+	}
+	if err := p.enc(v); err != nil {
+		return fmt.Errorf("dagg: spill encoding: %w", err)
+	}
+	return nil
+}
+
+// each calls fn for each partition with a func that reads its values.
+func (s *spiller[T]) each(fn func(values func(func(T) error) error) error) error {
+	for _, p := range s.parts {
+		if p == nil {
+			continue
+		}
+		if err := p.w.Flush(); err != nil {
+			return err
+		}
+		if _, err := p.f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		dec := s.newDecoder(bufio.NewReader(p.f))
+		err := fn(func(add func(T) error) error {
+			for {
+				v, err := dec()
+				if err == io.EOF {
+					return nil
+				}
+				if err != nil {
+					return fmt.Errorf("dagg: spill decoding: %w", err)
+				}
+				if err := add(v); err != nil {
+					return err
+				}
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *spiller[T]) close() error {
+	var err error
+	for _, p := range s.parts {
+		if p == nil {
+			continue
+		}
+		err = errors.Join(err, p.f.Close(), os.Remove(p.f.Name()))
+	}
+	s.parts = nil
+	return err
+}
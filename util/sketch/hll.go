@@ -0,0 +1,100 @@
+// Package sketch provides probabilistic data structures to summarize big
+// streams in constant memory.
+package sketch
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/bits"
+)
+
+// HyperLogLog estimates the number of distinct values added to it, the
+// standard error is about 1.04/sqrt(2^precision).
+type HyperLogLog struct {
+	p    uint8
+	regs []uint8
+}
+
+// NewHyperLogLog returns a HyperLogLog with 2^precision registers, precision
+// is clamped to [4, 18].
+func NewHyperLogLog(precision uint8) *HyperLogLog {
+	if precision < 4 {
+		precision = 4
+	}
+	if precision > 18 {
+		precision = 18
+	}
+	return &HyperLogLog{
+		p:    precision,
+		regs: make([]uint8, 1<<precision),
+	}
+}
+
+// Add adds the value v, values are hashed by their fmt representation.
+func (h *HyperLogLog) Add(v any) {
+	f := fnv.New64a()
+	switch v := v.(type) {
+	case string:
+		f.Write([]byte(v)) // nolint: errcheck
+	case []byte:
+		f.Write(v) // nolint: errcheck
+	default:
+		fmt.Fprintf(f, "%T:%v", v, v)
+	}
+	h.AddHash(f.Sum64())
+}
+
+// AddHash adds a 64bit hash of a value.
+func (h *HyperLogLog) AddHash(x uint64) {
+	x = mix64(x)
+	idx := x >> (64 - h.p)
+	w := x<<h.p | 1<<(h.p-1)
+	rho := uint8(bits.LeadingZeros64(w)) + 1
+	if rho > h.regs[idx] {
+		h.regs[idx] = rho
+	}
+}
+
+// Count returns the estimated number of distinct values.
+func (h *HyperLogLog) Count() uint64 {
+	m := float64(len(h.regs))
+	sum := 0.0
+	zeros := 0
+	for _, r := range h.regs {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	alpha := 0.7213 / (1 + 1.079/m)
+	est := alpha * m * m / sum
+	// small range correction
+	if est <= 2.5*m && zeros > 0 {
+		est = m * math.Log(m/float64(zeros))
+	}
+	return uint64(est + 0.5)
+}
+
+// Merge merges o into h, both must have the same precision.
+func (h *HyperLogLog) Merge(o *HyperLogLog) error {
+	if h.p != o.p {
+		return fmt.Errorf("sketch: merging HyperLogLog with different precision: %d, %d", h.p, o.p)
+	}
+	for i, r := range o.regs {
+		if r > h.regs[i] {
+			h.regs[i] = r
+		}
+	}
+	return nil
+}
+
+// mix64 is the splitmix64 finalizer, it spreads the fnv bits.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
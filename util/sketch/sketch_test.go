@@ -0,0 +1,104 @@
+package sketch_test
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stdiopt/danda/util/sketch"
+)
+
+func TestHyperLogLog(t *testing.T) {
+	type test struct {
+		n         int
+		precision uint8
+		tolerance float64
+	}
+
+	run := func(name string, tt test) {
+		t.Helper()
+		t.Run(name, func(t *testing.T) {
+			t.Helper()
+			h := sketch.NewHyperLogLog(tt.precision)
+			for i := 0; i < tt.n; i++ {
+				// add every value twice
+				h.Add(fmt.Sprint("value-", i))
+				h.Add(fmt.Sprint("value-", i))
+			}
+			got := float64(h.Count())
+			if diff := math.Abs(got-float64(tt.n)) / float64(tt.n); diff > tt.tolerance {
+				t.Errorf("Count() = %v, want %v (±%v)", got, tt.n, tt.tolerance)
+			}
+		})
+	}
+
+	run("small", test{n: 100, precision: 14, tolerance: 0.02})
+	run("medium", test{n: 10_000, precision: 14, tolerance: 0.03})
+	run("large", test{n: 200_000, precision: 14, tolerance: 0.03})
+	run("low precision", test{n: 50_000, precision: 10, tolerance: 0.1})
+}
+
+func TestHyperLogLogMerge(t *testing.T) {
+	a, b := sketch.NewHyperLogLog(14), sketch.NewHyperLogLog(14)
+	for i := 0; i < 10_000; i++ {
+		a.Add(i)
+		b.Add(i + 5_000)
+	}
+	if err := a.Merge(b); err != nil {
+		t.Fatal(err)
+	}
+	if got := float64(a.Count()); math.Abs(got-15_000)/15_000 > 0.03 {
+		t.Errorf("Count() = %v, want 15000", got)
+	}
+	if err := a.Merge(sketch.NewHyperLogLog(10)); err == nil {
+		t.Errorf("Merge() with different precision should fail")
+	}
+}
+
+func TestTDigest(t *testing.T) {
+	type test struct {
+		values    func(i int) float64
+		n         int
+		q         float64
+		want      float64
+		tolerance float64
+	}
+
+	uniform := func(i int) float64 { return float64(i) }
+	rnd := rand.New(rand.NewSource(1))
+	shuffled := rnd.Perm(100_000)
+
+	run := func(name string, tt test) {
+		t.Helper()
+		t.Run(name, func(t *testing.T) {
+			t.Helper()
+			d := sketch.NewTDigest(100)
+			for i := 0; i < tt.n; i++ {
+				d.Add(tt.values(i))
+			}
+			if got := d.Quantile(tt.q); math.Abs(got-tt.want) > tt.tolerance {
+				t.Errorf("Quantile(%v) = %v, want %v (±%v)", tt.q, got, tt.want, tt.tolerance)
+			}
+		})
+	}
+
+	run("median", test{values: uniform, n: 100_000, q: 0.5, want: 50_000, tolerance: 500})
+	run("p99", test{values: uniform, n: 100_000, q: 0.99, want: 99_000, tolerance: 200})
+	run("p01 shuffled", test{
+		values:    func(i int) float64 { return float64(shuffled[i]) },
+		n:         100_000,
+		q:         0.01,
+		want:      1_000,
+		tolerance: 200,
+	})
+	run("min", test{values: uniform, n: 1000, q: 0, want: 0})
+	run("max", test{values: uniform, n: 1000, q: 1, want: 999})
+	run("single", test{values: func(int) float64 { return 42 }, n: 1, q: 0.5, want: 42})
+}
+
+func TestTDigestEmpty(t *testing.T) {
+	if got := sketch.NewTDigest(100).Quantile(0.5); !math.IsNaN(got) {
+		t.Errorf("Quantile() = %v, want NaN", got)
+	}
+}
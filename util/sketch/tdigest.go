@@ -0,0 +1,131 @@
+package sketch
+
+import (
+	"math"
+	"sort"
+)
+
+type centroid struct {
+	mean   float64
+	weight float64
+}
+
+// TDigest estimates quantiles of a stream of numbers, accuracy is higher on
+// the tails and grows with the compression.
+type TDigest struct {
+	compression float64
+	centroids   []centroid
+	buffer      []centroid
+	count       float64
+	min, max    float64
+}
+
+// NewTDigest returns a TDigest with the compression, a typical value is 100.
+func NewTDigest(compression float64) *TDigest {
+	if compression < 20 {
+		compression = 20
+	}
+	return &TDigest{
+		compression: compression,
+		min:         math.Inf(1),
+		max:         math.Inf(-1),
+	}
+}
+
+// Add adds a value.
+func (t *TDigest) Add(x float64) {
+	t.AddWeighted(x, 1)
+}
+
+// AddWeighted adds a value with weight w.
+func (t *TDigest) AddWeighted(x, w float64) {
+	if math.IsNaN(x) || w <= 0 {
+		return
+	}
+	t.buffer = append(t.buffer, centroid{x, w})
+	t.count += w
+	t.min = math.Min(t.min, x)
+	t.max = math.Max(t.max, x)
+	if len(t.buffer) >= int(5*t.compression) {
+		t.compress()
+	}
+}
+
+// Count returns the total weight added.
+func (t *TDigest) Count() float64 {
+	return t.count
+}
+
+// Merge adds the centroids of o into t.
+func (t *TDigest) Merge(o *TDigest) {
+	o.compress()
+	t.buffer = append(t.buffer, o.centroids...)
+	t.count += o.count
+	t.min = math.Min(t.min, o.min)
+	t.max = math.Max(t.max, o.max)
+	t.compress()
+}
+
+// Quantile returns the estimated value at quantile q in [0, 1], NaN if no
+// values were added.
+func (t *TDigest) Quantile(q float64) float64 {
+	t.compress()
+	if len(t.centroids) == 0 {
+		return math.NaN()
+	}
+	if q <= 0 {
+		return t.min
+	}
+	if q >= 1 {
+		return t.max
+	}
+	target := q * t.count
+	prevMid, prevMean := 0.0, t.min
+	cum := 0.0
+	for _, c := range t.centroids {
+		mid := cum + c.weight/2
+		if target < mid {
+			return lerp(prevMid, prevMean, mid, c.mean, target)
+		}
+		prevMid, prevMean = mid, c.mean
+		cum += c.weight
+	}
+	return lerp(prevMid, prevMean, t.count, t.max, target)
+}
+
+// compress merges the buffer into the centroids.
+func (t *TDigest) compress() {
+	if len(t.buffer) == 0 {
+		return
+	}
+	all := append(t.centroids, t.buffer...)
+	t.buffer = t.buffer[:0]
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].mean < all[j].mean
+	})
+
+	out := make([]centroid, 0, len(all))
+	cur := all[0]
+	sofar := 0.0
+	for _, c := range all[1:] {
+		proposed := cur.weight + c.weight
+		q := (sofar + proposed/2) / t.count
+		limit := 4 * t.count * q * (1 - q) / t.compression
+		if proposed <= limit {
+			cur.mean += (c.mean - cur.mean) * c.weight / proposed
+			cur.weight = proposed
+			continue
+		}
+		out = append(out, cur)
+		sofar += cur.weight
+		cur = c
+	}
+	t.centroids = append(out, cur)
+}
+
+func lerp(x0, y0, x1, y1, x float64) float64 {
+	if x1 == x0 {
+		return y0
+	}
+	return y0 + (y1-y0)*(x-x0)/(x1-x0)
+}